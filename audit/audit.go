@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Init creates the audit log indexes
+func Init() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.AuditLogsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "target", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create audit log indexes: %v", err)
+	}
+}
+
+// Record saves an audit log entry. Failing to record is logged rather than
+// returned, so an audit write never undoes the action it describes.
+func Record(ctx context.Context, entry models.AuditLog) {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	if _, err := config.AuditLogsCollection.InsertOne(ctx, entry); err != nil {
+		log.Printf("⚠️  Failed to record audit log %s: %v", entry.Action, err)
+	}
+}
+
+// List returns the entries matching filter, newest first
+func List(ctx context.Context, filter bson.M, limit int64) ([]models.AuditLog, error) {
+	cursor, err := config.AuditLogsCollection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditLog{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
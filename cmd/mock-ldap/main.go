@@ -0,0 +1,83 @@
+// Command mock-ldap is a minimal read-only LDAP server for trying the
+// directory sync locally. It serves the in-memory server from
+// directory/ldaptest: simple binds and searches with the usual filters,
+// including Active Directory's bitwise matching rules, and paged results.
+//
+//	go run ./cmd/mock-ldap -addr :3890
+//
+// then set LDAP_URL=ldap://localhost:3890, LDAP_BASE_DN=ou=people,dc=flowkit,dc=local,
+// LDAP_BIND_DN=cn=sync,dc=flowkit,dc=local and LDAP_BIND_PASSWORD=secret.
+// Without -users a few sample people are served, including a disabled
+// account, one in an unknown department and one in the HR-Team group
+// (try LDAP_ROLE_MAP=HR-Team=hr). -users reads entries from a
+// JSON file instead:
+//
+//	[{"dn": "cn=Jane Doe,ou=people,dc=flowkit,dc=local",
+//	  "attributes": {"objectClass": ["person"], "mail": ["jane.doe@flowkit.com"], ...}}]
+//
+// The file is read again on every search, so entries can be edited between
+// sync runs.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"os"
+
+	"github.com/flowkit/backend/directory/ldaptest"
+)
+
+var (
+	addr         = flag.String("addr", ":3890", "address to listen on")
+	bindDN       = flag.String("bind-dn", "cn=sync,dc=flowkit,dc=local", "DN to accept binds from; empty allows anonymous searches")
+	bindPassword = flag.String("bind-password", "secret", "password for -bind-dn")
+	usersFile    = flag.String("users", "", "JSON file of entries; empty serves sample people")
+)
+
+var sampleEntries = []ldaptest.Entry{
+	ldaptest.Person("Jane Doe", "Jane", "Doe", "jane.doe@flowkit.com", "NOC", "FK-1001", "512"),
+	ldaptest.Person("John Smith", "John", "Smith", "john.smith@flowkit.com", "Accounts", "FK-1002", "512", "Staff", "HR-Team"),
+	ldaptest.Person("Amaka Obi", "Amaka", "Obi", "amaka.obi@flowkit.com", "Customer Service", "FK-1003", "512"),
+	ldaptest.Person("Tunde Bello", "Tunde", "Bello", "tunde.bello@flowkit.com", "VAS", "FK-1004", "514"), // Disabled
+	ldaptest.Person("Sam Lee", "Sam", "Lee", "sam.lee@flowkit.com", "Research", "FK-1005", "512"),        // Unknown department
+}
+
+func main() {
+	flag.Parse()
+
+	if _, err := loadEntries(); err != nil {
+		log.Fatal("Failed to load entries:", err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal("Failed to listen:", err)
+	}
+	log.Printf("📒 Mock LDAP server listening on %s", *addr)
+
+	server := &ldaptest.Server{
+		BindDN:       *bindDN,
+		BindPassword: *bindPassword,
+		Entries:      loadEntries,
+		Logf:         log.Printf,
+	}
+	log.Fatal(server.Serve(listener))
+}
+
+// loadEntries returns the entries to serve
+func loadEntries() ([]ldaptest.Entry, error) {
+	if *usersFile == "" {
+		return sampleEntries, nil
+	}
+	data, err := os.ReadFile(*usersFile)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ldaptest.Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,308 @@
+// Command mock-oidc is a minimal OpenID Connect provider for trying single
+// sign-on locally. It supports discovery, the authorization code flow with
+// PKCE (S256) and RS256-signed ID tokens. The sign-in page lets you choose
+// the claims to send, so provisioning and department/role mapping can be
+// exercised without a real identity provider.
+//
+//	go run ./cmd/mock-oidc -addr :9400
+//
+// then set OIDC_ISSUER=http://localhost:9400 and OIDC_CLIENT_ID=flowkit.
+// With -auto the sign-in page is skipped and the default claims are sent
+// straight away, which suits scripted runs.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	keyID   = "mock-1"
+	codeTTL = time.Minute
+)
+
+var (
+	addr         = flag.String("addr", ":9400", "address to listen on")
+	issuer       = flag.String("issuer", "http://localhost:9400", "issuer URL, as the API reaches it")
+	clientID     = flag.String("client-id", "flowkit", "client ID to accept")
+	clientSecret = flag.String("client-secret", "", "client secret to require; empty accepts public clients")
+	auto         = flag.Bool("auto", false, "skip the sign-in page and send the default claims")
+
+	defaultEmail      = flag.String("email", "jane.doe@flowkit.com", "default email claim")
+	defaultGivenName  = flag.String("given-name", "Jane", "default given_name claim")
+	defaultFamilyName = flag.String("family-name", "Doe", "default family_name claim")
+	defaultDepartment = flag.String("department", "NOC", "default department claim")
+	defaultRoles      = flag.String("roles", "employee", "default roles claim, comma separated")
+)
+
+// grant is an issued authorization code waiting to be exchanged
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+	expiresAt     time.Time
+}
+
+type provider struct {
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func main() {
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+	p := &provider{key: key, grants: map[string]grant{}}
+
+	http.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	http.HandleFunc("/jwks", p.jwks)
+	http.HandleFunc("/authorize", p.authorize)
+	http.HandleFunc("/token", p.token)
+
+	log.Printf("🔐 Mock OIDC provider for client %q listening on %s (issuer %s)", *clientID, *addr, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// discovery serves the provider metadata
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                *issuer,
+		"authorization_endpoint":                *issuer + "/authorize",
+		"token_endpoint":                        *issuer + "/token",
+		"jwks_uri":                              *issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+// jwks serves the public signing key
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+var signInPage = template.Must(template.New("signin").Parse(`<!DOCTYPE html>
+<html><head><title>Mock OIDC sign-in</title></head>
+<body style="font-family: sans-serif; max-width: 420px; margin: 40px auto">
+<h2>Mock OIDC sign-in</h2>
+<form method="post" action="/authorize?{{.Query}}">
+<p><label>Email<br><input name="email" value="{{.Email}}" size="40"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+<p><label>Given name<br><input name="given_name" value="{{.GivenName}}" size="40"></label></p>
+<p><label>Family name<br><input name="family_name" value="{{.FamilyName}}" size="40"></label></p>
+<p><label>Department<br><input name="department" value="{{.Department}}" size="40"></label></p>
+<p><label>Roles (comma separated)<br><input name="roles" value="{{.Roles}}" size="40"></label></p>
+<p><button type="submit">Sign in</button> <button type="submit" name="deny" value="1">Deny</button></p>
+</form>
+</body></html>`))
+
+// authorize shows the sign-in page (GET) and issues an authorization code
+// for the submitted claims (POST)
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != *clientID || redirectURI == "" {
+		http.Error(w, "unknown client or missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	back := func(values url.Values) {
+		values.Set("state", query.Get("state"))
+		http.Redirect(w, r, redirectURI+"?"+values.Encode(), http.StatusFound)
+	}
+	if query.Get("response_type") != "code" {
+		back(url.Values{"error": {"unsupported_response_type"}})
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		back(url.Values{"error": {"invalid_request"}, "error_description": {"PKCE with S256 is required"}})
+		return
+	}
+
+	form := url.Values{
+		"email":          {*defaultEmail},
+		"email_verified": {"true"},
+		"given_name":     {*defaultGivenName},
+		"family_name":    {*defaultFamilyName},
+		"department":     {*defaultDepartment},
+		"roles":          {*defaultRoles},
+	}
+	if r.Method == http.MethodGet && !*auto {
+		email := *defaultEmail
+		if hint := query.Get("login_hint"); hint != "" {
+			email = hint
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		signInPage.Execute(w, map[string]string{
+			"Query":      query.Encode(),
+			"Email":      email,
+			"GivenName":  *defaultGivenName,
+			"FamilyName": *defaultFamilyName,
+			"Department": *defaultDepartment,
+			"Roles":      *defaultRoles,
+		})
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("deny") != "" {
+			back(url.Values{"error": {"access_denied"}, "error_description": {"The user denied the request"}})
+			return
+		}
+		form = r.PostForm
+	}
+
+	roles := []string{}
+	for _, role := range strings.Split(form.Get("roles"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	email := strings.TrimSpace(form.Get("email"))
+	claims := jwt.MapClaims{
+		"sub":            "mock|" + strings.ToLower(email),
+		"email":          email,
+		"email_verified": form.Get("email_verified") == "true",
+		"given_name":     form.Get("given_name"),
+		"family_name":    form.Get("family_name"),
+		"name":           strings.TrimSpace(form.Get("given_name") + " " + form.Get("family_name")),
+		"department":     form.Get("department"),
+		"roles":          roles,
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.grants[code] = grant{
+		redirectURI:   redirectURI,
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		claims:        claims,
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	back(url.Values{"code": {code}})
+}
+
+// token exchanges an authorization code for an ID token
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != *clientID || subtle.ConstantTimeCompare([]byte(secret), []byte(*clientSecret)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// Codes work once
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(g.expiresAt) || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": *issuer,
+		"aud": *clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
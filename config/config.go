@@ -5,16 +5,42 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	DB               *mongo.Database
-	UsersCollection  *mongo.Collection
-	LeavesCollection *mongo.Collection
+	DB                          *mongo.Database
+	UsersCollection             *mongo.Collection
+	LeavesCollection            *mongo.Collection
+	CancellationsCollection     *mongo.Collection
+	ExtensionsCollection        *mongo.Collection
+	AttachmentsCollection       *mongo.Collection
+	CommentsCollection          *mongo.Collection
+	NotificationsCollection     *mongo.Collection
+	EventsCollection            *mongo.Collection
+	WebhooksCollection          *mongo.Collection
+	WebhookDeliveriesCollection *mongo.Collection
+	OutboxCollection            *mongo.Collection
+	JobsCollection              *mongo.Collection
+	JobRunsCollection           *mongo.Collection
+	SessionsCollection          *mongo.Collection
+	PasswordResetsCollection    *mongo.Collection
+	RateLimitsCollection        *mongo.Collection
+	SettingsCollection          *mongo.Collection
+	LoginChallengesCollection   *mongo.Collection
+	LoginAttemptsCollection     *mongo.Collection
+	AuditLogsCollection         *mongo.Collection
+	OIDCLoginsCollection        *mongo.Collection
+	APIKeysCollection           *mongo.Collection
+	RolesCollection             *mongo.Collection
+
+	transactionsSupported bool
 )
 
 // LoadEnv loads environment variables from .env file
@@ -76,7 +102,149 @@ func ConnectDB(ctx context.Context) (*mongo.Client, error) {
 
 // InitDB initializes database collections
 func InitDB(client *mongo.Client) {
-	DB = client.Database("flowkit_leave_management")
+	UseDatabase(client, "flowkit_leave_management")
+}
+
+// UseDatabase points the collections at the named database, e.g. a
+// throwaway database in tests
+func UseDatabase(client *mongo.Client, name string) {
+	DB = client.Database(name)
 	UsersCollection = DB.Collection("users")
 	LeavesCollection = DB.Collection("leaves")
+	CancellationsCollection = DB.Collection("cancellations")
+	ExtensionsCollection = DB.Collection("extensions")
+	AttachmentsCollection = DB.Collection("attachments")
+	CommentsCollection = DB.Collection("comments")
+	NotificationsCollection = DB.Collection("notifications")
+	EventsCollection = DB.Collection("events")
+	WebhooksCollection = DB.Collection("webhooks")
+	WebhookDeliveriesCollection = DB.Collection("webhook_deliveries")
+	OutboxCollection = DB.Collection("outbox")
+	JobsCollection = DB.Collection("jobs")
+	JobRunsCollection = DB.Collection("job_runs")
+	SessionsCollection = DB.Collection("sessions")
+	PasswordResetsCollection = DB.Collection("password_resets")
+	RateLimitsCollection = DB.Collection("rate_limits")
+	SettingsCollection = DB.Collection("settings")
+	LoginChallengesCollection = DB.Collection("login_challenges")
+	LoginAttemptsCollection = DB.Collection("login_attempts")
+	AuditLogsCollection = DB.Collection("audit_logs")
+	OIDCLoginsCollection = DB.Collection("oidc_logins")
+	APIKeysCollection = DB.Collection("api_keys")
+	RolesCollection = DB.Collection("roles")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	transactionsSupported = supportsTransactions(ctx, client)
+	if !transactionsSupported {
+		log.Println("⚠️  MongoDB is not a replica set, leave changes and their events are written without transactions")
+	}
+}
+
+// supportsTransactions reports whether the server is a replica set member or
+// mongos, the deployments that support multi-document transactions
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
+}
+
+// WithTransaction runs fn in a multi-document transaction so its writes, and
+// any events it publishes, commit together. fn must use the context it is
+// given and may be retried. On a standalone server fn runs without one.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !transactionsSupported {
+		return fn(ctx)
+	}
+
+	session, err := DB.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+// GetApprovalPath reads a comma-separated approval path such as "HOD,HR" from
+// the environment. "none" means requests are approved without review.
+func GetApprovalPath(key string, fallback []string) []string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	if strings.EqualFold(value, "none") {
+		return []string{}
+	}
+
+	path := []string{}
+	for _, stage := range strings.Split(value, ",") {
+		stage = strings.ToUpper(strings.TrimSpace(stage))
+		if stage == "HOD" || stage == "HR" || stage == "GED" {
+			path = append(path, stage)
+		} else if stage != "" {
+			log.Printf("Warning: ignoring unknown approval stage %q in %s", stage, key)
+		}
+	}
+	return path
+}
+
+// GetLeaveTypeLimits reads per-leave-type day limits such as
+// "Sick Leave:2,Other:5" from the environment
+func GetLeaveTypeLimits(key string, fallback map[string]int) map[string]int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+
+	limits := map[string]int{}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			log.Printf("Warning: ignoring malformed entry %q in %s", entry, key)
+			continue
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || days < 0 {
+			log.Printf("Warning: ignoring malformed entry %q in %s", entry, key)
+			continue
+		}
+		limits[strings.TrimSpace(parts[0])] = days
+	}
+	return limits
+}
+
+// GetInt64 reads an integer setting from the environment
+func GetInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(key)), 10, 64)
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// GetString reads a setting from the environment, or fallback when it is unset or empty
+func GetString(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetBool reads a true/false setting from the environment
+func GetBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return value
 }
@@ -0,0 +1,213 @@
+package directory
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Active Directory flags a disabled account with this userAccountControl bit
+const adAccountDisabled = 0x2
+
+const dialTimeout = 15 * time.Second
+
+// Config describes the LDAP server and where its users are
+type Config struct {
+	URL                string // ldap://host:389 or ldaps://host:636
+	BindDN             string
+	BindPassword       string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BaseDN             string
+	Filter             string
+	PageSize           uint32
+	Mapping            Mapping
+	RoleMap            map[string]string // Lower-cased group DN or CN to role
+}
+
+// Mapping names the LDAP attributes that hold each user field
+type Mapping struct {
+	FirstName  string
+	LastName   string
+	Email      string
+	Department string
+	StaffID    string
+	Groups     string
+}
+
+// Entry is a directory user, mapped onto user fields
+type Entry struct {
+	DN         string   `json:"dn"`
+	FirstName  string   `json:"firstName"`
+	LastName   string   `json:"lastName"`
+	Email      string   `json:"email"`
+	Department string   `json:"department"`
+	StaffID    string   `json:"staffId"`
+	Groups     []string `json:"groups,omitempty"`
+	Role       string   `json:"role,omitempty"` // From LDAP_ROLE_MAP; "" when no group is mapped
+	Disabled   bool     `json:"disabled"`       // Disabled in Active Directory
+}
+
+// Enabled reports whether a directory is configured
+func Enabled() bool {
+	return os.Getenv("LDAP_URL") != "" && os.Getenv("LDAP_BASE_DN") != ""
+}
+
+// FromEnv reads the directory settings from the LDAP_* variables. The
+// defaults suit Active Directory; OpenLDAP usually wants
+// LDAP_ATTR_STAFF_ID=employeeNumber.
+func FromEnv() Config {
+	return Config{
+		URL:                os.Getenv("LDAP_URL"),
+		BindDN:             os.Getenv("LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+		StartTLS:           config.GetBool("LDAP_START_TLS", false),
+		InsecureSkipVerify: config.GetBool("LDAP_INSECURE_SKIP_VERIFY", false),
+		BaseDN:             os.Getenv("LDAP_BASE_DN"),
+		Filter:             config.GetString("LDAP_USER_FILTER", "(&(objectClass=person)(mail=*))"),
+		PageSize:           uint32(config.GetInt64("LDAP_PAGE_SIZE", 500)),
+		Mapping: Mapping{
+			FirstName:  config.GetString("LDAP_ATTR_FIRST_NAME", "givenName"),
+			LastName:   config.GetString("LDAP_ATTR_LAST_NAME", "sn"),
+			Email:      config.GetString("LDAP_ATTR_EMAIL", "mail"),
+			Department: config.GetString("LDAP_ATTR_DEPARTMENT", "department"),
+			StaffID:    config.GetString("LDAP_ATTR_STAFF_ID", "employeeID"),
+			Groups:     config.GetString("LDAP_ATTR_GROUPS", "memberOf"),
+		},
+		RoleMap: ParseRoleMap(os.Getenv("LDAP_ROLE_MAP")),
+	}
+}
+
+// ParseRoleMap reads LDAP_ROLE_MAP, pairs of group and role separated by
+// semicolons, e.g. "HR-Team=hr;CN=IT Admins,OU=Groups,DC=corp,DC=local=admin".
+// A group is named by its DN or just its CN; the role follows the last "=".
+func ParseRoleMap(value string) map[string]string {
+	roles := map[string]string{}
+	for _, pair := range strings.Split(value, ";") {
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			continue
+		}
+		group, role := strings.ToLower(strings.TrimSpace(pair[:i])), strings.TrimSpace(pair[i+1:])
+		if group != "" && role != "" {
+			roles[group] = role
+		}
+	}
+	return roles
+}
+
+// Role maps an entry's groups onto a role through the role map. When several
+// groups match, the most privileged role wins. It returns "" when none does.
+func (cfg Config) Role(groups []string) string {
+	if len(cfg.RoleMap) == 0 {
+		return ""
+	}
+	roles := []string{}
+	for _, group := range groups {
+		if role, ok := cfg.RoleMap[strings.ToLower(strings.TrimSpace(group))]; ok {
+			roles = append(roles, role)
+		} else if role, ok := cfg.RoleMap[strings.ToLower(groupCN(group))]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return models.HighestRole(roles)
+}
+
+// groupCN returns the common name of a group DN, or "" if it has none
+func groupCN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Search binds to the directory and returns every user under the base DN
+// matching the filter
+func Search(cfg Config) ([]Entry, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	conn, err := ldap.DialURL(cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: dialTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.URL, err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(time.Minute)
+
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind as %s: %w", cfg.BindDN, err)
+		}
+	}
+
+	m := cfg.Mapping
+	request := ldap.NewSearchRequest(
+		cfg.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, 0, false,
+		cfg.Filter,
+		[]string{m.FirstName, m.LastName, m.Email, m.Department, m.StaffID, m.Groups, "userAccountControl"},
+		nil,
+	)
+	pageSize := cfg.PageSize
+	if pageSize == 0 {
+		pageSize = 500
+	}
+	result, err := conn.SearchWithPaging(request, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		entries = append(entries, cfg.entry(e))
+	}
+	return entries, nil
+}
+
+// entry maps a directory entry onto user fields
+func (cfg Config) entry(e *ldap.Entry) Entry {
+	m := cfg.Mapping
+	entry := Entry{
+		DN:         e.DN,
+		FirstName:  strings.TrimSpace(e.GetEqualFoldAttributeValue(m.FirstName)),
+		LastName:   strings.TrimSpace(e.GetEqualFoldAttributeValue(m.LastName)),
+		Email:      strings.TrimSpace(e.GetEqualFoldAttributeValue(m.Email)),
+		Department: strings.TrimSpace(e.GetEqualFoldAttributeValue(m.Department)),
+		StaffID:    strings.TrimSpace(e.GetEqualFoldAttributeValue(m.StaffID)),
+	}
+	if m.Groups != "" {
+		entry.Groups = e.GetEqualFoldAttributeValues(m.Groups)
+		entry.Role = cfg.Role(entry.Groups)
+	}
+	if flags, err := strconv.ParseInt(e.GetEqualFoldAttributeValue("userAccountControl"), 10, 64); err == nil {
+		entry.Disabled = flags&adAccountDisabled != 0
+	}
+	return entry
+}
@@ -0,0 +1,173 @@
+package directory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowkit/backend/directory/ldaptest"
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestParseRoleMap(t *testing.T) {
+	got := ParseRoleMap(" HR-Team = hr ;CN=IT Admins,OU=Groups,DC=corp,DC=local=admin;;broken; =ged;Leads=")
+	want := map[string]string{
+		"hr-team": "hr",
+		"cn=it admins,ou=groups,dc=corp,dc=local": "admin",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRoleMap = %v, want %v", got, want)
+	}
+}
+
+func TestConfigRole(t *testing.T) {
+	cfg := Config{RoleMap: ParseRoleMap("HR-Team=hr;CN=IT Admins,OU=Groups,DC=corp,DC=local=admin;Directors=ged")}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   string
+	}{
+		{name: "by CN", groups: []string{"CN=HR-Team,OU=Groups,DC=corp,DC=local"}, want: "hr"},
+		{name: "by DN ignoring case", groups: []string{"cn=it admins,ou=groups,dc=corp,dc=local"}, want: "admin"},
+		{name: "most privileged wins", groups: []string{"CN=Directors,OU=Groups", "CN=HR-Team,OU=Groups"}, want: "ged"},
+		{name: "DN of another group with a mapped CN elsewhere", groups: []string{"CN=IT Admins,OU=Other,DC=corp,DC=local"}, want: ""},
+		{name: "unmapped groups", groups: []string{"CN=Staff,OU=Groups"}, want: ""},
+		{name: "no groups", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.Role(tt.groups); got != tt.want {
+				t.Errorf("Role(%v) = %q, want %q", tt.groups, got, tt.want)
+			}
+		})
+	}
+
+	if got := (Config{}).Role([]string{"CN=HR-Team,OU=Groups"}); got != "" {
+		t.Errorf("Role without a role map = %q, want empty", got)
+	}
+}
+
+func TestConfigEntry(t *testing.T) {
+	cfg := Config{
+		Mapping: Mapping{
+			FirstName:  "givenName",
+			LastName:   "sn",
+			Email:      "mail",
+			Department: "department",
+			StaffID:    "employeeNumber",
+			Groups:     "memberOf",
+		},
+		RoleMap: ParseRoleMap("HR-Team=hr"),
+	}
+
+	entry := cfg.entry(ldap.NewEntry("cn=Jane Doe,ou=people,dc=flowkit,dc=local", map[string][]string{
+		"GIVENNAME":          {" Jane "},
+		"sn":                 {"Doe"},
+		"mail":               {"jane.doe@flowkit.com"},
+		"department":         {"NOC"},
+		"employeeNumber":     {"FK-1001"},
+		"memberOf":           {"cn=Staff,ou=groups,dc=flowkit,dc=local", "cn=HR-Team,ou=groups,dc=flowkit,dc=local"},
+		"userAccountControl": {"514"},
+	}))
+
+	want := Entry{
+		DN:         "cn=Jane Doe,ou=people,dc=flowkit,dc=local",
+		FirstName:  "Jane",
+		LastName:   "Doe",
+		Email:      "jane.doe@flowkit.com",
+		Department: "NOC",
+		StaffID:    "FK-1001",
+		Groups:     []string{"cn=Staff,ou=groups,dc=flowkit,dc=local", "cn=HR-Team,ou=groups,dc=flowkit,dc=local"},
+		Role:       "hr",
+		Disabled:   true,
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("entry = %+v\nwant    %+v", entry, want)
+	}
+
+	enabled := cfg.entry(ldap.NewEntry("cn=John,ou=people", map[string][]string{"userAccountControl": {"512"}}))
+	if enabled.Disabled || enabled.Role != "" {
+		t.Errorf("entry = %+v, want enabled with no role", enabled)
+	}
+}
+
+const (
+	testBindDN   = "cn=sync,dc=flowkit,dc=local"
+	testPassword = "secret"
+)
+
+// testConfig returns the settings FromEnv defaults to, for server
+func testConfig(server *ldaptest.Server) Config {
+	cfg := FromEnv()
+	cfg.URL = server.URL
+	cfg.BindDN = testBindDN
+	cfg.BindPassword = testPassword
+	cfg.BaseDN = "ou=people,dc=flowkit,dc=local"
+	cfg.RoleMap = ParseRoleMap("HR-Team=hr")
+	return cfg
+}
+
+func TestSearch(t *testing.T) {
+	server := ldaptest.NewServer(t, testBindDN, testPassword, []ldaptest.Entry{
+		ldaptest.Person("Jane Doe", "Jane", "Doe", "jane.doe@flowkit.com", "NOC", "FK-1001", "512"),
+		ldaptest.Person("John Smith", "John", "Smith", "john.smith@flowkit.com", "Accounts", "FK-1002", "512", "Staff", "HR-Team"),
+		ldaptest.Person("Tunde Bello", "Tunde", "Bello", "tunde.bello@flowkit.com", "VAS", "FK-1004", "514"),
+		ldaptest.Person("Amaka Obi", "Amaka", "Obi", "amaka.obi@flowkit.com", "Customer Service", "FK-1003", "512"),
+		ldaptest.Person("Sam Lee", "Sam", "Lee", "sam.lee@flowkit.com", "Research", "FK-1005", "512"),
+		// Filtered out: no mail, and outside the base DN
+		{DN: "cn=Printer,ou=people,dc=flowkit,dc=local", Attributes: map[string][]string{"objectClass": {"person"}}},
+		{DN: "cn=Admin,ou=service,dc=flowkit,dc=local", Attributes: map[string][]string{"objectClass": {"person"}, "mail": {"admin@flowkit.com"}}},
+	})
+	cfg := testConfig(server)
+	cfg.PageSize = 2
+
+	entries, err := Search(cfg)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if pages := server.Pages(); pages != 3 {
+		t.Errorf("pages = %d, want 5 entries read 2 at a time", pages)
+	}
+
+	emails := []string{}
+	for _, entry := range entries {
+		emails = append(emails, entry.Email)
+	}
+	want := []string{"jane.doe@flowkit.com", "john.smith@flowkit.com", "tunde.bello@flowkit.com", "amaka.obi@flowkit.com", "sam.lee@flowkit.com"}
+	if !reflect.DeepEqual(emails, want) {
+		t.Fatalf("emails = %v, want %v", emails, want)
+	}
+
+	john := entries[1]
+	if john.FirstName != "John" || john.LastName != "Smith" || john.Department != "Accounts" || john.StaffID != "FK-1002" || john.Role != "hr" || john.Disabled {
+		t.Errorf("john = %+v", john)
+	}
+	if !entries[2].Disabled {
+		t.Errorf("tunde = %+v, want disabled", entries[2])
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	server := ldaptest.NewServer(t, testBindDN, testPassword, nil)
+
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr string
+	}{
+		{name: "wrong password", change: func(cfg *Config) { cfg.BindPassword = "wrong" }, wantErr: "failed to bind"},
+		{name: "anonymous", change: func(cfg *Config) { cfg.BindDN = "" }, wantErr: "search failed"},
+		{name: "StartTLS refused", change: func(cfg *Config) { cfg.StartTLS = true }, wantErr: "failed to start TLS"},
+		{name: "no server", change: func(cfg *Config) { cfg.URL = "ldap://127.0.0.1:1" }, wantErr: "failed to connect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(server)
+			tt.change(&cfg)
+			if _, err := Search(cfg); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+// Package ldaptest runs a minimal read-only LDAP server in process, for
+// tests and cmd/mock-ldap. It supports simple binds and searches with the
+// usual filters, including Active Directory's bitwise matching rules, and
+// the paged results control, over entries held in memory.
+package ldaptest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Active Directory's bitwise AND and OR matching rules
+const (
+	matchingRuleBitAnd = "1.2.840.113556.1.4.803"
+	matchingRuleBitOr  = "1.2.840.113556.1.4.804"
+)
+
+// Entry is a directory entry
+type Entry struct {
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// values returns an attribute's values, matching its name without case
+func (e Entry) values(name string) []string {
+	for attr, values := range e.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Person returns an Active Directory style user under
+// ou=people,dc=flowkit,dc=local, a member of the named groups under
+// ou=groups. accountControl is the userAccountControl value; 514 is disabled.
+func Person(cn, given, sn, mail, department, employeeID, accountControl string, groups ...string) Entry {
+	e := Entry{
+		DN: "cn=" + cn + ",ou=people,dc=flowkit,dc=local",
+		Attributes: map[string][]string{
+			"objectClass":        {"top", "person", "organizationalPerson", "user"},
+			"cn":                 {cn},
+			"givenName":          {given},
+			"sn":                 {sn},
+			"mail":               {mail},
+			"department":         {department},
+			"employeeID":         {employeeID},
+			"userAccountControl": {accountControl},
+		},
+	}
+	for _, group := range groups {
+		e.Attributes["memberOf"] = append(e.Attributes["memberOf"], "cn="+group+",ou=groups,dc=flowkit,dc=local")
+	}
+	return e
+}
+
+// Server answers LDAP requests
+type Server struct {
+	URL          string // ldap://host:port, set by NewServer
+	BindDN       string // DN to accept binds from; empty allows anonymous searches
+	BindPassword string
+	Entries      func() ([]Entry, error)                  // Read on every search
+	Logf         func(format string, args ...interface{}) // Optional
+
+	mu    sync.Mutex
+	pages int
+}
+
+// NewServer starts a server for entries on a local port, accepting binds as
+// bindDN with password, closed when the test ends
+func NewServer(t testing.TB, bindDN, password string, entries []Entry) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	s := &Server{
+		URL:          "ldap://" + listener.Addr().String(),
+		BindDN:       bindDN,
+		BindPassword: password,
+		Entries:      func() ([]Entry, error) { return entries, nil },
+	}
+	go s.Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// Pages returns how many pages of search results the server has sent
+func (s *Server) Pages() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pages
+}
+
+// Serve answers connections on listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err != nil {
+			s.logf("⚠️  Accept failed: %v", err)
+			continue
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// serve answers the requests on one connection until the client unbinds
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	bound := s.BindDN == ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logf("⚠️  Read failed: %v", err)
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code, message := int64(ldap.LDAPResultSuccess), ""
+			name, password := text(op.Children[1]), text(op.Children[2])
+			if s.BindDN != "" && (!sameDN(name, s.BindDN) || password != s.BindPassword) {
+				code, message = ldap.LDAPResultInvalidCredentials, "invalid credentials"
+			}
+			bound = code == ldap.LDAPResultSuccess
+			s.logf("bind %q: %s", name, resultName(code))
+			s.reply(conn, id, result(ldap.ApplicationBindResponse, code, message), nil)
+
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				s.reply(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights, "bind first"), nil)
+				continue
+			}
+			s.search(conn, id, op, pagingControl(packet))
+
+		case ldap.ApplicationExtendedRequest:
+			// Including StartTLS
+			s.reply(conn, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "extended operations are not supported"), nil)
+
+		case ldap.ApplicationUnbindRequest:
+			return
+
+		case ldap.ApplicationAbandonRequest:
+			// Nothing runs long enough to abandon
+
+		default:
+			s.logf("⚠️  Unsupported operation %d", op.Tag)
+			return
+		}
+	}
+}
+
+// pagingControl returns the paged results control sent with a request, if any
+func pagingControl(packet *ber.Packet) *ldap.ControlPaging {
+	if len(packet.Children) < 3 {
+		return nil
+	}
+	for _, child := range packet.Children[2].Children {
+		control, err := ldap.DecodeControl(child)
+		if paging, ok := control.(*ldap.ControlPaging); err == nil && ok {
+			return paging
+		}
+	}
+	return nil
+}
+
+// search answers a search request with the matching entries, a page at a
+// time when the client asks for paged results
+func (s *Server) search(conn net.Conn, id int64, op *ber.Packet, paging *ldap.ControlPaging) {
+	base := text(op.Children[0])
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var requested []string
+	for _, attr := range op.Children[7].Children {
+		requested = append(requested, text(attr))
+	}
+
+	entries, err := s.Entries()
+	if err != nil {
+		s.logf("⚠️  Failed to load entries: %v", err)
+		s.reply(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultOther, "failed to load entries"), nil)
+		return
+	}
+
+	var matched []Entry
+	for _, e := range entries {
+		if inScope(e.DN, base, scope) && matches(filter, e) {
+			matched = append(matched, e)
+		}
+	}
+
+	// The cookie is the offset of the next page
+	var response ldap.Control
+	if paging != nil {
+		offset, _ := strconv.Atoi(string(paging.Cookie))
+		if offset > len(matched) {
+			offset = len(matched)
+		}
+		end := len(matched)
+		if size := int(paging.PagingSize); size > 0 && offset+size < end {
+			end = offset + size
+		}
+		next := ""
+		if end < len(matched) {
+			next = strconv.Itoa(end)
+		}
+		matched = matched[offset:end]
+		response = &ldap.ControlPaging{Cookie: []byte(next)}
+	}
+
+	for _, e := range matched {
+		s.reply(conn, id, searchEntry(e, requested), nil)
+	}
+	s.mu.Lock()
+	s.pages++
+	s.mu.Unlock()
+	s.logf("search %q: %d entries", base, len(matched))
+	s.reply(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""), response)
+}
+
+// inScope reports whether dn falls within a search of base
+func inScope(dn, base string, scope int64) bool {
+	dn, base = normalizeDN(dn), normalizeDN(base)
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		parts := strings.SplitN(dn, ",", 2)
+		return len(parts) == 2 && parts[1] == base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+// matches evaluates a search filter against an entry
+func matches(filter *ber.Packet, e Entry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(child, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(child, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !matches(filter.Children[0], e)
+	case ldap.FilterPresent:
+		return len(e.values(filter.Data.String())) > 0
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		want := strings.ToLower(text(filter.Children[1]))
+		for _, value := range e.values(text(filter.Children[0])) {
+			value = strings.ToLower(value)
+			switch {
+			case filter.Tag == ldap.FilterGreaterOrEqual && value >= want,
+				filter.Tag == ldap.FilterLessOrEqual && value <= want,
+				filter.Tag != ldap.FilterGreaterOrEqual && filter.Tag != ldap.FilterLessOrEqual && value == want:
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		for _, value := range e.values(text(filter.Children[0])) {
+			if substringsMatch(strings.ToLower(value), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterExtensibleMatch:
+		var rule, attr, want string
+		for _, child := range filter.Children {
+			switch child.Tag {
+			case 1:
+				rule = text(child)
+			case 2:
+				attr = text(child)
+			case 3:
+				want = text(child)
+			}
+		}
+		for _, value := range e.values(attr) {
+			if extensibleMatch(rule, value, want) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// substringsMatch checks value against the initial, any and final parts of
+// a substrings filter
+func substringsMatch(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		s := strings.ToLower(text(part))
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, s) {
+				return false
+			}
+			value = value[len(s):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, s)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// extensibleMatch applies a matching rule, such as Active Directory's
+// bitwise tests on userAccountControl
+func extensibleMatch(rule, value, want string) bool {
+	switch rule {
+	case matchingRuleBitAnd, matchingRuleBitOr:
+		v, err1 := strconv.ParseInt(value, 10, 64)
+		w, err2 := strconv.ParseInt(want, 10, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		if rule == matchingRuleBitAnd {
+			return v&w == w
+		}
+		return v&w != 0
+	}
+	return strings.EqualFold(value, want)
+}
+
+// searchEntry encodes an entry with the requested attributes
+func searchEntry(e Entry, requested []string) *ber.Packet {
+	all := len(requested) == 0
+	for _, attr := range requested {
+		if attr == "*" {
+			all = true
+		}
+	}
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "Object Name"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.Attributes {
+		wanted := all
+		for _, attr := range requested {
+			wanted = wanted || strings.EqualFold(attr, name)
+		}
+		if !wanted {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return op
+}
+
+// result encodes an LDAPResult with the given response tag
+func result(tag ber.Tag, code int64, message string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return op
+}
+
+// reply sends one response message, with control when it is not nil
+func (s *Server) reply(conn net.Conn, id int64, op *ber.Packet, control ldap.Control) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+	if control != nil {
+		controls := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		controls.AppendChild(control.Encode())
+		packet.AppendChild(controls)
+	}
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		s.logf("⚠️  Write failed: %v", err)
+	}
+}
+
+// text returns the string in a packet, whether or not the decoder filled in its value
+func text(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	return p.Data.String()
+}
+
+// normalizeDN lower-cases a DN and drops the spaces around its separators
+func normalizeDN(dn string) string {
+	if strings.TrimSpace(dn) == "" {
+		return ""
+	}
+	parts := strings.Split(strings.ToLower(dn), ",")
+	for i, part := range parts {
+		name, value, _ := strings.Cut(part, "=")
+		parts[i] = strings.TrimSpace(name) + "=" + strings.TrimSpace(value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func sameDN(a, b string) bool {
+	return normalizeDN(a) == normalizeDN(b)
+}
+
+func resultName(code int64) string {
+	if name, ok := ldap.LDAPResultCodeMap[uint16(code)]; ok {
+		return name
+	}
+	return strconv.FormatInt(code, 10)
+}
@@ -0,0 +1,182 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eventRetention is how long published events are kept for replay
+const eventRetention = 7 * 24 * time.Hour
+
+// The bus delivers events to live listeners such as SSE connections. Events are
+// stored in MongoDB and read back through a change stream, so a listener on
+// one API instance sees events published on every other instance. Without a
+// replica set change streams are unavailable and delivery stays in-process.
+var (
+	store     *mongo.Collection
+	streaming atomic.Bool
+
+	listenersMu sync.RWMutex
+	listeners   = map[primitive.ObjectID]map[chan Event]bool{}
+)
+
+// StartBus stores published events in coll and starts watching it for events
+// published by any instance
+func StartBus(ctx context.Context, coll *mongo.Collection) {
+	store = coll
+
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "occurredAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(eventRetention.Seconds()))},
+		{Keys: bson.D{{Key: "recipients", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "employee", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create event indexes: %v", err)
+	}
+
+	// Stored events are what live listeners and replays read from
+	Subscribe("stream", broadcast)
+
+	stream, err := coll.Watch(context.Background(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+	})
+	if err != nil {
+		log.Printf("⚠️  Change streams unavailable, live events stay on this instance: %v", err)
+		return
+	}
+
+	streaming.Store(true)
+	go watch(stream)
+	log.Println("📡 Event bus watching for events from all instances")
+}
+
+// watch delivers every event inserted by any instance to local listeners
+func watch(stream *mongo.ChangeStream) {
+	defer stream.Close(context.Background())
+
+	for stream.Next(context.Background()) {
+		var change struct {
+			FullDocument Event `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&change); err != nil {
+			log.Printf("⚠️  Failed to decode event from change stream: %v", err)
+			continue
+		}
+		deliver(change.FullDocument)
+	}
+
+	// Fall back to in-process delivery so this instance keeps working
+	log.Printf("⚠️  Event change stream closed: %v", stream.Err())
+	streaming.Store(false)
+}
+
+// broadcast stores an event for replay and delivers it to listeners, either
+// through the change stream or directly when there is none
+func broadcast(ctx context.Context, event Event) error {
+	_, err := store.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		// Stored by an earlier attempt, listeners already have it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !streaming.Load() {
+		deliver(event)
+	}
+	return nil
+}
+
+// deliver passes an event to the listeners of everyone it concerns. Listeners
+// that are not keeping up miss the event and catch up on reconnect.
+func deliver(event Event) {
+	listenersMu.RLock()
+	defer listenersMu.RUnlock()
+
+	for _, userID := range Audience(event) {
+		for ch := range listeners[userID] {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+// Audience returns the users an event concerns: its recipients and the
+// employee whose leave it is
+func Audience(event Event) []primitive.ObjectID {
+	audience := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{primitive.NilObjectID: true}
+	for _, id := range append([]primitive.ObjectID{event.Employee}, event.Recipients...) {
+		if !seen[id] {
+			seen[id] = true
+			audience = append(audience, id)
+		}
+	}
+	return audience
+}
+
+// Listen registers a live listener for events concerning userID. The returned
+// function unregisters it and must be called when the listener goes away.
+func Listen(userID primitive.ObjectID) (<-chan Event, func()) {
+	ch := make(chan Event, 32)
+
+	listenersMu.Lock()
+	if listeners[userID] == nil {
+		listeners[userID] = map[chan Event]bool{}
+	}
+	listeners[userID][ch] = true
+	listenersMu.Unlock()
+
+	return ch, func() {
+		listenersMu.Lock()
+		delete(listeners[userID], ch)
+		if len(listeners[userID]) == 0 {
+			delete(listeners, userID)
+		}
+		listenersMu.Unlock()
+	}
+}
+
+// Since returns stored events concerning userID published after the event
+// with ID after, oldest first
+func Since(ctx context.Context, userID, after primitive.ObjectID) ([]Event, error) {
+	if store == nil {
+		return nil, nil
+	}
+
+	cursor, err := store.Find(
+		ctx,
+		bson.M{
+			"_id": bson.M{"$gt": after},
+			"$or": []bson.M{{"recipients": userID}, {"employee": userID}},
+		},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(500),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stored []Event
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// IsAfter reports whether event ID a was issued after b
+func IsAfter(a, b primitive.ObjectID) bool {
+	return bytes.Compare(a[:], b[:]) > 0
+}
@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Leave lifecycle event types
+const (
+	LeaveCreated       = "leave.created"
+	LeaveStageApproved = "leave.stage_approved"
+	LeaveStageRejected = "leave.stage_rejected"
+	LeaveApproved      = "leave.approved"
+	LeaveCancelled     = "leave.cancelled"
+	LeaveReturned      = "leave.returned"
+	LeaveExtended      = "leave.extended"
+	RelieverAssigned   = "leave.reliever_assigned"
+	LeaveRecalled      = "leave.recalled"
+	LeaveCommented     = "leave.commented"
+	LeaveMentioned     = "leave.mentioned"
+	ApprovalReminder   = "leave.approval_reminder"
+	LeaveEscalated     = "leave.escalated"
+	LeaveStartingSoon  = "leave.starting_soon"
+)
+
+// Types lists every event type, in the order shown to users
+var Types = []string{
+	LeaveCreated, LeaveStageApproved, LeaveStageRejected, LeaveApproved,
+	LeaveCancelled, LeaveReturned, LeaveExtended, RelieverAssigned, LeaveRecalled,
+	LeaveCommented, LeaveMentioned, ApprovalReminder, LeaveEscalated,
+	LeaveStartingSoon,
+}
+
+// Event describes something that happened to a leave request
+type Event struct {
+	ID         primitive.ObjectID     `bson:"_id" json:"id"`
+	Type       string                 `bson:"type" json:"type"`
+	LeaveID    primitive.ObjectID     `bson:"leaveId" json:"leaveId"`
+	Employee   primitive.ObjectID     `bson:"employee" json:"employee"`
+	Actor      primitive.ObjectID     `bson:"actor,omitempty" json:"actor,omitempty"`
+	Recipients []primitive.ObjectID   `bson:"recipients" json:"recipients"` // Users the event should be surfaced to
+	Data       map[string]interface{} `bson:"data,omitempty" json:"data,omitempty"`
+	OccurredAt time.Time              `bson:"occurredAt" json:"occurredAt"`
+}
+
+// Handler receives published events. Handlers may see the same event more
+// than once and should use the event ID as an idempotency key.
+type Handler func(ctx context.Context, event Event) error
+
+// sink is a named handler the dispatcher tracks delivery for
+type sink struct {
+	name    string
+	handler Handler
+}
+
+var (
+	mu    sync.RWMutex
+	sinks []sink
+)
+
+// Subscribe registers a handler for every published event. The name records
+// which handlers have processed an event so retries only repeat failed ones.
+func Subscribe(name string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = append(sinks, sink{name: name, handler: handler})
+}
+
+// Publish records an event in the outbox for delivery to all subscribed
+// handlers. Pass the context of a transaction to publish the event only if the
+// transaction commits.
+func Publish(ctx context.Context, event Event) error {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	// Without an outbox there is nothing to retry from, so deliver straight away
+	if outbox == nil {
+		deliverNow(ctx, event)
+		return nil
+	}
+
+	return enqueue(ctx, event)
+}
+
+// subscribers returns a snapshot of the registered sinks
+func subscribers() []sink {
+	mu.RLock()
+	defer mu.RUnlock()
+	snapshot := make([]sink, len(sinks))
+	copy(snapshot, sinks)
+	return snapshot
+}
+
+// deliverNow passes an event to every sink once, logging failures
+func deliverNow(ctx context.Context, event Event) {
+	for _, s := range subscribers() {
+		if err := s.handler(ctx, event); err != nil {
+			log.Printf("⚠️  %s failed to handle %s for leave %s: %v", s.name, event.Type, event.LeaveID.Hex(), err)
+		}
+	}
+}
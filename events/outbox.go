@@ -0,0 +1,239 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outbox message statuses
+const (
+	OutboxPending    = "pending"
+	OutboxDispatched = "dispatched"
+	OutboxFailed     = "failed"
+)
+
+const (
+	maxDispatchAttempts = 10
+	firstRetryDelay     = 15 * time.Second // Doubles after every failed attempt
+	dispatchPoll        = 2 * time.Second
+	dispatchLease       = time.Minute
+	dispatchedRetention = 7 * 24 * time.Hour
+
+	// StuckAfter is how long a message may wait before it counts as stuck
+	StuckAfter = 5 * time.Minute
+)
+
+// OutboxMessage is an event waiting to be, or already, handed to the sinks.
+// Its ID is the event ID, which sinks use as the idempotency key.
+type OutboxMessage struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	Event         Event              `bson:"event" json:"event"`
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	Completed     []string           `bson:"completed" json:"completed"` // Sinks that have handled the event
+	LastError     string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	DispatchedAt  *time.Time         `bson:"dispatchedAt,omitempty" json:"dispatchedAt,omitempty"`
+}
+
+// The outbox makes publishing reliable: an event is written next to the leave
+// and balance changes it describes, in the same transaction, and a dispatcher
+// hands it to every sink until each has accepted it.
+var (
+	outbox  *mongo.Collection
+	wakeups = make(chan struct{}, 1)
+)
+
+// StartOutbox records published events in coll and starts the dispatcher
+// that drains it. Call it once every sink has subscribed, as a message counts
+// as dispatched when the sinks registered at the time have accepted it.
+func StartOutbox(ctx context.Context, coll *mongo.Collection) {
+	outbox = coll
+
+	_, err := coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		{Keys: bson.D{{Key: "dispatchedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(dispatchedRetention.Seconds()))},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create outbox indexes: %v", err)
+	}
+
+	go dispatchWorker()
+}
+
+// enqueue writes an event to the outbox using the caller's context, so it
+// commits or rolls back with the caller's transaction
+func enqueue(ctx context.Context, event Event) error {
+	now := time.Now()
+	_, err := outbox.InsertOne(ctx, OutboxMessage{
+		ID:            event.ID,
+		Event:         event,
+		Status:        OutboxPending,
+		Completed:     []string{},
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The message may not be visible until the transaction commits; the poll
+	// picks it up if this wakeup is too early
+	wake()
+	return nil
+}
+
+// wake nudges the dispatcher to look for due messages now
+func wake() {
+	select {
+	case wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchWorker drains due outbox messages, polling for retries, messages
+// committed after their wakeup and messages written by other instances
+func dispatchWorker() {
+	ticker := time.NewTicker(dispatchPoll)
+	defer ticker.Stop()
+
+	for {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), dispatchLease)
+			message, err := claim(ctx)
+			if err != nil {
+				cancel()
+				if err != mongo.ErrNoDocuments {
+					log.Printf("⚠️  Failed to claim outbox message: %v", err)
+				}
+				break
+			}
+			dispatch(ctx, message)
+			cancel()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wakeups:
+		}
+	}
+}
+
+// claim leases the oldest due message so no other instance dispatches it meanwhile
+func claim(ctx context.Context) (*OutboxMessage, error) {
+	now := time.Now()
+
+	var message OutboxMessage
+	err := outbox.FindOneAndUpdate(
+		ctx,
+		bson.M{"status": OutboxPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": now.Add(dispatchLease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// dispatch hands a message to every sink that has not yet accepted it and
+// records the outcome, retrying with exponential backoff on failure
+func dispatch(ctx context.Context, message *OutboxMessage) {
+	done := map[string]bool{}
+	for _, name := range message.Completed {
+		done[name] = true
+	}
+
+	var lastErr error
+	for _, s := range subscribers() {
+		if done[s.name] {
+			continue
+		}
+		if err := s.handler(ctx, message.Event); err != nil {
+			log.Printf("⚠️  %s failed to handle %s for leave %s: %v", s.name, message.Event.Type, message.Event.LeaveID.Hex(), err)
+			lastErr = err
+			continue
+		}
+		message.Completed = append(message.Completed, s.name)
+	}
+
+	now := time.Now()
+	attempts := message.Attempts + 1
+	set := bson.M{
+		"attempts":  attempts,
+		"completed": message.Completed,
+	}
+
+	switch {
+	case lastErr == nil:
+		set["status"] = OutboxDispatched
+		set["dispatchedAt"] = now
+		set["lastError"] = ""
+	case attempts >= maxDispatchAttempts:
+		set["status"] = OutboxFailed
+		set["lastError"] = lastErr.Error()
+		log.Printf("⚠️  Outbox message %s failed after %d attempts: %v", message.ID.Hex(), attempts, lastErr)
+	default:
+		set["nextAttemptAt"] = now.Add(firstRetryDelay << (attempts - 1))
+		set["lastError"] = lastErr.Error()
+	}
+
+	if _, err := outbox.UpdateOne(ctx, bson.M{"_id": message.ID}, bson.M{"$set": set}); err != nil {
+		log.Printf("⚠️  Failed to record outbox message %s: %v", message.ID.Hex(), err)
+	}
+}
+
+// StuckMessages returns messages that have failed for good or have been
+// waiting longer than StuckAfter, oldest first
+func StuckMessages(ctx context.Context, limit int64) ([]OutboxMessage, error) {
+	cursor, err := outbox.Find(
+		ctx,
+		bson.M{"$or": []bson.M{
+			{"status": OutboxFailed},
+			{"status": OutboxPending, "createdAt": bson.M{"$lt": time.Now().Add(-StuckAfter)}},
+		}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []OutboxMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Retry puts an undispatched message back in the queue with a fresh set of
+// attempts. Sinks that already accepted it are not called again.
+func Retry(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := outbox.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": bson.M{"$ne": OutboxDispatched}},
+		bson.M{"$set": bson.M{
+			"status":        OutboxPending,
+			"attempts":      0,
+			"nextAttemptAt": time.Now(),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+
+	wake()
+	return true, nil
+}
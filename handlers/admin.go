@@ -12,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -31,14 +32,15 @@ type AdminCreateUserRequest struct {
 
 // AdminUpdateUserRequest represents admin user update data
 type AdminUpdateUserRequest struct {
-	FirstName  string `json:"firstName,omitempty"`
-	LastName   string `json:"lastName,omitempty"`
-	Email      string `json:"email,omitempty"`
-	Department string `json:"department,omitempty"`
-	Role       string `json:"role,omitempty"`
-	IsHOD      *bool  `json:"isHOD,omitempty"`
-	StaffID    string `json:"staffId,omitempty"`
-	IsActive   *bool  `json:"isActive,omitempty"`
+	FirstName  string  `json:"firstName,omitempty"`
+	LastName   string  `json:"lastName,omitempty"`
+	Email      string  `json:"email,omitempty"`
+	Department string  `json:"department,omitempty"`
+	Role       string  `json:"role,omitempty"`
+	IsHOD      *bool   `json:"isHOD,omitempty"`
+	Deputy     *string `json:"deputy,omitempty"` // Alternate approver; empty string clears it
+	StaffID    string  `json:"staffId,omitempty"`
+	IsActive   *bool   `json:"isActive,omitempty"`
 }
 
 // AdminUpdateLeaveBalanceRequest represents leave balance adjustment
@@ -82,6 +84,20 @@ func AdminCreateUser(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Users may only be added to departments the admin manages, and only
+	// with roles the admin could grant
+	if !checkDepartmentCovered(c, models.PermUserManage, req.Department) {
+		return
+	}
+	roles := middleware.GetRoles(ctx)
+	if !checkRoleGrant(c, roles, req.Role, middleware.PrimaryRoleScope(roles, req.Role, req.Department)) {
+		return
+	}
+	// Heads of department decide at the HOD stage, so the flag is a grant too
+	if req.IsHOD && !checkDepartmentCovered(c, models.PermRoleManage, req.Department) {
+		return
+	}
+
 	// Check if user already exists
 	var existingUser models.User
 	err := config.UsersCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existingUser)
@@ -190,6 +206,11 @@ func AdminUpdateUser(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	target, ok := loadManagedUser(ctx, c, userID, models.PermUserManage)
+	if !ok {
+		return
+	}
+
 	// Build update fields
 	updateFields := bson.M{"updatedAt": time.Now()}
 
@@ -223,6 +244,9 @@ func AdminUpdateUser(c *gin.Context) {
 			})
 			return
 		}
+		if !checkDepartmentCovered(c, models.PermUserManage, req.Department) {
+			return
+		}
 		updateFields["department"] = req.Department
 	}
 	if req.Role != "" {
@@ -235,21 +259,84 @@ func AdminUpdateUser(c *gin.Context) {
 		}
 		updateFields["role"] = req.Role
 	}
+
+	// Changing the role, or moving a departmental role to another
+	// department, takes the old grant away and gives the new one
+	newRole, newDepartment := target.Role, target.Department
+	if req.Role != "" {
+		newRole = req.Role
+	}
+	if req.Department != "" {
+		newDepartment = req.Department
+	}
+	roles := middleware.GetRoles(ctx)
+	oldScope := middleware.PrimaryRoleScope(roles, target.Role, target.Department)
+	newScope := middleware.PrimaryRoleScope(roles, newRole, newDepartment)
+	if newRole != target.Role || newScope != oldScope {
+		if !checkRoleGrant(c, roles, target.Role, oldScope) || !checkRoleGrant(c, roles, newRole, newScope) {
+			return
+		}
+	}
 	if req.StaffID != "" {
 		updateFields["staffId"] = req.StaffID
 	}
+	// Heads of department decide at the HOD stage for their department, so
+	// setting, clearing or moving the flag takes role.manage there
+	isHOD := target.IsHOD
 	if req.IsHOD != nil {
-		updateFields["isHOD"] = *req.IsHOD
+		isHOD = *req.IsHOD
+		updateFields["isHOD"] = isHOD
+	}
+	if isHOD != target.IsHOD || newDepartment != target.Department {
+		if target.IsHOD && !checkDepartmentCovered(c, models.PermRoleManage, target.Department) {
+			return
+		}
+		if isHOD && !checkDepartmentCovered(c, models.PermRoleManage, newDepartment) {
+			return
+		}
 	}
 	if req.IsActive != nil {
 		updateFields["isActive"] = *req.IsActive
 	}
 
+	unsetFields := bson.M{}
+	if req.Deputy != nil {
+		if *req.Deputy == "" {
+			unsetFields["deputy"] = ""
+		} else {
+			deputyID, err := primitive.ObjectIDFromHex(*req.Deputy)
+			if err != nil || deputyID == userID {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": "Invalid deputy",
+				})
+				return
+			}
+
+			// Deputies stand in as approvers, so they must be able to approve
+			var deputy models.User
+			err = config.UsersCollection.FindOne(ctx, bson.M{"_id": deputyID}).Decode(&deputy)
+			if err != nil || !deputy.IsActive || !canApprove(ctx, &deputy) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": "Deputy must be an active user who can approve leave",
+				})
+				return
+			}
+			updateFields["deputy"] = deputyID
+		}
+	}
+
+	update := bson.M{"$set": updateFields}
+	if len(unsetFields) > 0 {
+		update["$unset"] = unsetFields
+	}
+
 	// Update user
 	result, err := config.UsersCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": userID},
-		bson.M{"$set": updateFields},
+		update,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -300,6 +387,10 @@ func AdminDeactivateUser(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if _, ok := loadManagedUser(ctx, c, userID, models.PermUserManage); !ok {
+		return
+	}
+
 	// Prevent admin from deactivating themselves
 	currentUserID, err := middleware.GetCurrentUserID(c)
 	if err == nil && currentUserID == userID {
@@ -355,6 +446,10 @@ func AdminActivateUser(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if _, ok := loadManagedUser(ctx, c, userID, models.PermUserManage); !ok {
+		return
+	}
+
 	result, err := config.UsersCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": userID},
@@ -477,6 +572,10 @@ func AdminUpdateUserLeaveBalance(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if _, ok := loadManagedUser(ctx, c, userID, models.PermBalanceAdjust); !ok {
+		return
+	}
+
 	// Build update fields for leave balance
 	updateFields := bson.M{"updatedAt": time.Now()}
 
@@ -557,6 +656,10 @@ func AdminResetUserPassword(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if _, ok := loadManagedUser(ctx, c, userID, models.PermUserManage); !ok {
+		return
+	}
+
 	// Hash new password
 	hashedPassword, err := utils.HashPassword(req.NewPassword)
 	if err != nil {
@@ -592,8 +695,56 @@ func AdminResetUserPassword(c *gin.Context) {
 		return
 	}
 
+	// The old password may be compromised, so end every session it opened
+	if _, err := middleware.RevokeUserSessions(ctx, userID, primitive.NilObjectID, "password reset by admin"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Password reset, but failed to sign out existing sessions",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Password reset successfully",
 	})
 }
+
+// checkDepartmentCovered writes a 403 response and returns false unless the
+// current user holds perm over department
+func checkDepartmentCovered(c *gin.Context, perm, department string) bool {
+	if middleware.GetCurrentGrants(c).Covers(perm, department) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"success": false,
+		"message": "You do not have '" + perm + "' for the " + department + " department",
+	})
+	return false
+}
+
+// loadManagedUser loads the user being acted on, writing an error response
+// and returning false unless the current user holds perm over their
+// department
+func loadManagedUser(ctx context.Context, c *gin.Context, userID primitive.ObjectID, perm string) (*models.User, bool) {
+	var user models.User
+	err := config.UsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch user",
+		})
+		return nil, false
+	}
+	if !checkDepartmentCovered(c, perm, user.Department) {
+		return nil, false
+	}
+	return &user, true
+}
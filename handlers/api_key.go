@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/audit"
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdminCreateAPIKey issues an API key (admin only). The key is returned
+// once and cannot be shown again.
+func AdminCreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Name is required",
+		})
+		return
+	}
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range req.Scopes {
+		if _, ok := models.APIKeyScopes[scope]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Unknown scope '" + scope + "'",
+			})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := int64(req.ExpiresInDays)
+	if days == 0 {
+		days = config.GetInt64("API_KEY_TTL_DAYS", 365)
+	}
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+
+	key, prefix, hash, err := middleware.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate API key",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	apiKey := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		CreatedBy: adminID,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, int(days)),
+	}
+	if _, err := config.APIKeysCollection.InsertOne(ctx, apiKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to create API key",
+		})
+		return
+	}
+
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditAPIKeyCreated,
+		Actor:     adminID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"apiKey": apiKey.ID, "name": name, "scopes": scopes, "expiresAt": apiKey.ExpiresAt},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "API key created. Copy it now; it will not be shown again.",
+		"key":     key,
+		"apiKey":  apiKey,
+	})
+}
+
+// AdminGetAPIKeys lists API keys, newest first, with the scopes keys can
+// be issued with (admin only)
+func AdminGetAPIKeys(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.APIKeysCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch API keys",
+		})
+		return
+	}
+	apiKeys := []models.APIKey{}
+	if err := cursor.All(ctx, &apiKeys); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode API keys",
+		})
+		return
+	}
+
+	now := time.Now()
+	keys := make([]gin.H, 0, len(apiKeys))
+	for i := range apiKeys {
+		keys = append(keys, gin.H{
+			"apiKey": apiKeys[i],
+			"active": apiKeys[i].IsActive(now),
+		})
+	}
+
+	scopes := make([]gin.H, 0, len(models.APIKeyScopes))
+	for scope, description := range models.APIKeyScopes {
+		scopes = append(scopes, gin.H{"scope": scope, "description": description})
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		return scopes[i]["scope"].(string) < scopes[j]["scope"].(string)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"count":   len(keys),
+		"keys":    keys,
+		"scopes":  scopes,
+	})
+}
+
+// AdminRevokeAPIKey revokes an API key at once (admin only)
+func AdminRevokeAPIKey(c *gin.Context) {
+	keyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid API key ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+	result, err := config.APIKeysCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": keyID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now(), "revokedBy": adminID}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to revoke API key",
+		})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "API key not found or already revoked",
+		})
+		return
+	}
+
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditAPIKeyRevoked,
+		Actor:     adminID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"apiKey": keyID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API key revoked",
+	})
+}
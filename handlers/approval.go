@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
 	"github.com/flowkit/backend/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,7 +16,6 @@ import (
 // HODApproveLeave allows HOD to approve leave requests from their department
 func HODApproveLeave(c *gin.Context) {
 	leaveID := c.Param("id")
-	userID := c.GetString("userID")
 
 	// Validate leave ID
 	leaveObjID, err := primitive.ObjectIDFromHex(leaveID)
@@ -24,9 +24,9 @@ func HODApproveLeave(c *gin.Context) {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	userObjID, err := middleware.GetCurrentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -48,12 +48,6 @@ func HODApproveLeave(c *gin.Context) {
 		return
 	}
 
-	// Check if user is actually a HOD
-	if !hod.IsHOD {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only HODs can approve at this stage"})
-		return
-	}
-
 	// Get the leave request
 	var leave models.Leave
 	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveObjID}).Decode(&leave)
@@ -62,17 +56,33 @@ func HODApproveLeave(c *gin.Context) {
 		return
 	}
 
-	// Get employee details to check department
-	var employee models.User
-	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request has been returned to the employee for changes"})
+		return
+	}
+
+	// HOD stage is not part of the workflow for this leave
+	if leave.HODApprovalStatus == "skipped" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "HOD approval is not required for this leave request"})
+		return
+	}
+
+	// The department's HOD decides, unless the stage was delegated
+	if err := checkStageAuthority(ctx, &leave, &hod, "HOD"); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if HOD is from the same department as the employee
-	if hod.Department != employee.Department {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only approve leave requests from your department"})
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, "HOD", userObjID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Some leave types need supporting documents before they can be approved
+	if err := checkAttachmentRequirement(ctx, &leave); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -98,7 +108,24 @@ func HODApproveLeave(c *gin.Context) {
 		},
 	}
 
-	_, err = config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update)
+	// Later stages may have been left out of this leave's approval path
+	if leave.IsFinalStage("HOD") {
+		update["$set"].(bson.M)["status"] = "Approved"
+	}
+
+	leave.HODApprovalStatus = "approved"
+	leave.HODApprover = userObjID
+	if leave.IsFinalStage("HOD") {
+		leave.Status = "Approved"
+	}
+
+	// Save the decision and let the employee and the next approvers know
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update); err != nil {
+			return err
+		}
+		return publishStageDecision(ctx, &leave, "HOD", leave.PendingStage(), true, userObjID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leave request"})
 		return
@@ -113,7 +140,6 @@ func HODApproveLeave(c *gin.Context) {
 // HODRejectLeave allows HOD to reject leave requests from their department
 func HODRejectLeave(c *gin.Context) {
 	leaveID := c.Param("id")
-	userID := c.GetString("userID")
 
 	// Validate leave ID
 	leaveObjID, err := primitive.ObjectIDFromHex(leaveID)
@@ -122,9 +148,9 @@ func HODRejectLeave(c *gin.Context) {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	userObjID, err := middleware.GetCurrentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -146,12 +172,6 @@ func HODRejectLeave(c *gin.Context) {
 		return
 	}
 
-	// Check if user is actually a HOD
-	if !hod.IsHOD {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only HODs can reject at this stage"})
-		return
-	}
-
 	// Get the leave request
 	var leave models.Leave
 	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveObjID}).Decode(&leave)
@@ -160,39 +180,33 @@ func HODRejectLeave(c *gin.Context) {
 		return
 	}
 
-	// Get employee details to check department
-	var employee models.User
-	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request has been returned to the employee for changes"})
 		return
 	}
 
-	// Check if HOD is from the same department as the employee
-	if hod.Department != employee.Department {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only reject leave requests from your department"})
+	// HOD stage is not part of the workflow for this leave
+	if leave.HODApprovalStatus == "skipped" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "HOD approval is not required for this leave request"})
 		return
 	}
 
-	// Check if already processed
-	if leave.HODApprovalStatus == "rejected" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request already rejected by HOD"})
+	// The department's HOD decides, unless the stage was delegated
+	if err := checkStageAuthority(ctx, &leave, &hod, "HOD"); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Refund leave days to employee
-	_, err = config.UsersCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leave.Employee},
-		bson.M{
-			"$inc": bson.M{
-				"leaveBalance.available": leave.TotalDays,
-				"leaveBalance.used":      -leave.TotalDays,
-			},
-		},
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee leave balance"})
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, "HOD", userObjID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check if already processed
+	if leave.HODApprovalStatus == "rejected" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request already rejected by HOD"})
 		return
 	}
 
@@ -209,7 +223,19 @@ func HODRejectLeave(c *gin.Context) {
 		},
 	}
 
-	_, err = config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update)
+	leave.HODApprovalStatus = "rejected"
+	leave.Status = "Rejected"
+
+	// Refund the days, reject the leave and let the employee know together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := refundLeaveDays(ctx, leave.Employee, leave.TotalDays); err != nil {
+			return err
+		}
+		if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update); err != nil {
+			return err
+		}
+		return publishStageDecision(ctx, &leave, "HOD", "", false, userObjID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leave request"})
 		return
@@ -224,7 +250,6 @@ func HODRejectLeave(c *gin.Context) {
 // HRApproveLeave allows HR to approve leave requests that have been approved by HOD
 func HRApproveLeave(c *gin.Context) {
 	leaveID := c.Param("id")
-	userID := c.GetString("userID")
 
 	// Validate leave ID
 	leaveObjID, err := primitive.ObjectIDFromHex(leaveID)
@@ -233,9 +258,9 @@ func HRApproveLeave(c *gin.Context) {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	userObjID, err := middleware.GetCurrentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -256,12 +281,24 @@ func HRApproveLeave(c *gin.Context) {
 		return
 	}
 
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request has been returned to the employee for changes"})
+		return
+	}
+
 	// Check if HOD has approved first
-	if leave.HODApprovalStatus != "approved" {
+	if !models.IsStageCleared(leave.HODApprovalStatus) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Leave request must be approved by HOD first"})
 		return
 	}
 
+	// HR stage is not part of the workflow for this leave
+	if leave.HRApprovalStatus == "skipped" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "HR approval is not required for this leave request"})
+		return
+	}
+
 	// Check if already processed by HR
 	if leave.HRApprovalStatus == "approved" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request already approved by HR"})
@@ -272,6 +309,25 @@ func HRApproveLeave(c *gin.Context) {
 		return
 	}
 
+	// Check the user may decide at the HR stage
+	user, _ := middleware.GetCurrentUser(c)
+	if err := checkStageAuthority(ctx, &leave, user, "HR"); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, "HR", userObjID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Some leave types need supporting documents before they can be approved
+	if err := checkAttachmentRequirement(ctx, &leave); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Update leave with HR approval
 	now := time.Now()
 	update := bson.M{
@@ -284,7 +340,24 @@ func HRApproveLeave(c *gin.Context) {
 		},
 	}
 
-	_, err = config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update)
+	// GED may have been left out of this leave's approval path
+	if leave.IsFinalStage("HR") {
+		update["$set"].(bson.M)["status"] = "Approved"
+	}
+
+	leave.HRApprovalStatus = "approved"
+	leave.HRApprover = userObjID
+	if leave.IsFinalStage("HR") {
+		leave.Status = "Approved"
+	}
+
+	// Save the decision and let the employee and the next approvers know
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update); err != nil {
+			return err
+		}
+		return publishStageDecision(ctx, &leave, "HR", leave.PendingStage(), true, userObjID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leave request"})
 		return
@@ -299,7 +372,6 @@ func HRApproveLeave(c *gin.Context) {
 // HRRejectLeave allows HR to reject leave requests
 func HRRejectLeave(c *gin.Context) {
 	leaveID := c.Param("id")
-	userID := c.GetString("userID")
 
 	// Validate leave ID
 	leaveObjID, err := primitive.ObjectIDFromHex(leaveID)
@@ -308,9 +380,9 @@ func HRRejectLeave(c *gin.Context) {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	userObjID, err := middleware.GetCurrentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -331,31 +403,40 @@ func HRRejectLeave(c *gin.Context) {
 		return
 	}
 
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request has been returned to the employee for changes"})
+		return
+	}
+
 	// Check if HOD has approved first
-	if leave.HODApprovalStatus != "approved" {
+	if !models.IsStageCleared(leave.HODApprovalStatus) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Leave request must be approved by HOD before HR can review"})
 		return
 	}
 
+	// HR stage is not part of the workflow for this leave
+	if leave.HRApprovalStatus == "skipped" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "HR approval is not required for this leave request"})
+		return
+	}
+
 	// Check if already processed by HR
 	if leave.HRApprovalStatus == "rejected" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request already rejected by HR"})
 		return
 	}
 
-	// Refund leave days to employee
-	_, err = config.UsersCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leave.Employee},
-		bson.M{
-			"$inc": bson.M{
-				"leaveBalance.available": leave.TotalDays,
-				"leaveBalance.used":      -leave.TotalDays,
-			},
-		},
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee leave balance"})
+	// Check the user may decide at the HR stage
+	user, _ := middleware.GetCurrentUser(c)
+	if err := checkStageAuthority(ctx, &leave, user, "HR"); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, "HR", userObjID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -372,7 +453,19 @@ func HRRejectLeave(c *gin.Context) {
 		},
 	}
 
-	_, err = config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update)
+	leave.HRApprovalStatus = "rejected"
+	leave.Status = "Rejected"
+
+	// Refund the days, reject the leave and let the employee know together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := refundLeaveDays(ctx, leave.Employee, leave.TotalDays); err != nil {
+			return err
+		}
+		if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update); err != nil {
+			return err
+		}
+		return publishStageDecision(ctx, &leave, "HR", "", false, userObjID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leave request"})
 		return
@@ -387,7 +480,6 @@ func HRRejectLeave(c *gin.Context) {
 // GEDApproveLeave allows GED to give final approval to leave requests
 func GEDApproveLeave(c *gin.Context) {
 	leaveID := c.Param("id")
-	userID := c.GetString("userID")
 
 	// Validate leave ID
 	leaveObjID, err := primitive.ObjectIDFromHex(leaveID)
@@ -396,9 +488,9 @@ func GEDApproveLeave(c *gin.Context) {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	userObjID, err := middleware.GetCurrentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -419,16 +511,28 @@ func GEDApproveLeave(c *gin.Context) {
 		return
 	}
 
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request has been returned to the employee for changes"})
+		return
+	}
+
 	// Check if HOD and HR have approved first
-	if leave.HODApprovalStatus != "approved" {
+	if !models.IsStageCleared(leave.HODApprovalStatus) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Leave request must be approved by HOD first"})
 		return
 	}
-	if leave.HRApprovalStatus != "approved" {
+	if !models.IsStageCleared(leave.HRApprovalStatus) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Leave request must be approved by HR first"})
 		return
 	}
 
+	// GED stage is not part of the workflow for this leave
+	if leave.GEDApprovalStatus == "skipped" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "GED approval is not required for this leave request"})
+		return
+	}
+
 	// Check if already processed by GED
 	if leave.GEDApprovalStatus == "approved" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request already approved by GED"})
@@ -439,6 +543,25 @@ func GEDApproveLeave(c *gin.Context) {
 		return
 	}
 
+	// Check the user may decide at the GED stage
+	user, _ := middleware.GetCurrentUser(c)
+	if err := checkStageAuthority(ctx, &leave, user, "GED"); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, "GED", userObjID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Some leave types need supporting documents before they can be approved
+	if err := checkAttachmentRequirement(ctx, &leave); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Update leave with GED approval - this makes it fully approved
 	now := time.Now()
 	update := bson.M{
@@ -452,7 +575,19 @@ func GEDApproveLeave(c *gin.Context) {
 		},
 	}
 
-	_, err = config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update)
+	leave.GEDApprovalStatus = "approved"
+	leave.GEDApprover = userObjID
+	if leave.IsFinalStage("GED") {
+		leave.Status = "Approved"
+	}
+
+	// Save the decision and let the employee and the next approvers know
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update); err != nil {
+			return err
+		}
+		return publishStageDecision(ctx, &leave, "GED", leave.PendingStage(), true, userObjID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leave request"})
 		return
@@ -467,7 +602,6 @@ func GEDApproveLeave(c *gin.Context) {
 // GEDRejectLeave allows GED to reject leave requests
 func GEDRejectLeave(c *gin.Context) {
 	leaveID := c.Param("id")
-	userID := c.GetString("userID")
 
 	// Validate leave ID
 	leaveObjID, err := primitive.ObjectIDFromHex(leaveID)
@@ -476,9 +610,9 @@ func GEDRejectLeave(c *gin.Context) {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	userObjID, err := middleware.GetCurrentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -499,35 +633,44 @@ func GEDRejectLeave(c *gin.Context) {
 		return
 	}
 
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request has been returned to the employee for changes"})
+		return
+	}
+
 	// Check if HOD and HR have approved first
-	if leave.HODApprovalStatus != "approved" {
+	if !models.IsStageCleared(leave.HODApprovalStatus) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Leave request must be approved by HOD before GED can review"})
 		return
 	}
-	if leave.HRApprovalStatus != "approved" {
+	if !models.IsStageCleared(leave.HRApprovalStatus) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Leave request must be approved by HR before GED can review"})
 		return
 	}
 
+	// GED stage is not part of the workflow for this leave
+	if leave.GEDApprovalStatus == "skipped" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "GED approval is not required for this leave request"})
+		return
+	}
+
 	// Check if already processed by GED
 	if leave.GEDApprovalStatus == "rejected" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request already rejected by GED"})
 		return
 	}
 
-	// Refund leave days to employee
-	_, err = config.UsersCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leave.Employee},
-		bson.M{
-			"$inc": bson.M{
-				"leaveBalance.available": leave.TotalDays,
-				"leaveBalance.used":      -leave.TotalDays,
-			},
-		},
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee leave balance"})
+	// Check the user may decide at the GED stage
+	user, _ := middleware.GetCurrentUser(c)
+	if err := checkStageAuthority(ctx, &leave, user, "GED"); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, "GED", userObjID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -544,7 +687,19 @@ func GEDRejectLeave(c *gin.Context) {
 		},
 	}
 
-	_, err = config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update)
+	leave.GEDApprovalStatus = "rejected"
+	leave.Status = "Rejected"
+
+	// Refund the days, reject the leave and let the employee know together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := refundLeaveDays(ctx, leave.Employee, leave.TotalDays); err != nil {
+			return err
+		}
+		if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update); err != nil {
+			return err
+		}
+		return publishStageDecision(ctx, &leave, "GED", "", false, userObjID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leave request"})
 		return
@@ -558,10 +713,9 @@ func GEDRejectLeave(c *gin.Context) {
 
 // GetHODLeaves returns leave requests for HOD to review (from their department)
 func GetHODLeaves(c *gin.Context) {
-	userID := c.GetString("userID")
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	userObjID, err := middleware.GetCurrentUserID(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
@@ -576,35 +730,47 @@ func GetHODLeaves(c *gin.Context) {
 		return
 	}
 
-	if !hod.IsHOD {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Only HODs can access this endpoint"})
-		return
-	}
+	// Leaves routed to this user as an alternate approver
+	filter := bson.M{"hodDelegate": userObjID}
 
-	// Get all employees from the HOD's department
-	cursor, err := config.UsersCollection.Find(ctx, bson.M{
-		"department": hod.Department,
-		"isActive":   true,
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch department employees"})
-		return
-	}
-	defer cursor.Close(ctx)
+	// Departments the user approves for at the HOD stage
+	grants := middleware.UserGrants(ctx, &hod)
+	departments, all := grants.Departments(models.PermLeaveApproveHOD)
 
-	var departmentEmployeeIDs []primitive.ObjectID
-	for cursor.Next(ctx) {
-		var user models.User
-		if err := cursor.Decode(&user); err == nil {
-			departmentEmployeeIDs = append(departmentEmployeeIDs, user.ID)
+	if all || len(departments) > 0 {
+		// Get all employees from those departments
+		employeeFilter := bson.M{"isActive": true}
+		if !all {
+			employeeFilter["department"] = bson.M{"$in": departments}
 		}
+		cursor, err := config.UsersCollection.Find(ctx, employeeFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch department employees"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var departmentEmployeeIDs []primitive.ObjectID
+		for cursor.Next(ctx) {
+			var user models.User
+			if err := cursor.Decode(&user); err == nil {
+				departmentEmployeeIDs = append(departmentEmployeeIDs, user.ID)
+			}
+		}
+
+		// Department leaves that have not been routed elsewhere, plus delegated ones
+		filter = bson.M{"$or": []bson.M{
+			{
+				"employee":    bson.M{"$in": departmentEmployeeIDs},
+				"isActive":    true,
+				"hodDelegate": bson.M{"$exists": false},
+			},
+			{"hodDelegate": userObjID},
+		}}
 	}
 
 	// Get leave requests from department employees
-	leaveCursor, err := config.LeavesCollection.Find(ctx, bson.M{
-		"employee": bson.M{"$in": departmentEmployeeIDs},
-		"isActive": true,
-	})
+	leaveCursor, err := config.LeavesCollection.Find(ctx, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
 		return
@@ -671,13 +837,24 @@ func GetHODLeaves(c *gin.Context) {
 
 // GetHRLeaves returns leave requests for HR to review (HOD approved only)
 func GetHRLeaves(c *gin.Context) {
+	userObjID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Get leave requests that have been approved by HOD but not yet processed by HR
 	cursor, err := config.LeavesCollection.Find(ctx, bson.M{
-		"hodApprovalStatus": "approved",
+		"hodApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
 		"isActive":          true,
+		"employee":          bson.M{"$ne": userObjID}, // Approvers never review their own leave
+		"$or": []bson.M{
+			{"hrDelegate": bson.M{"$exists": false}},
+			{"hrDelegate": userObjID},
+		},
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
@@ -692,17 +869,23 @@ func GetHRLeaves(c *gin.Context) {
 	}
 
 	// Populate employee data for each leave
-	leaveResponses := make([]gin.H, len(leaves))
-	for i, leave := range leaves {
+	grants := middleware.GetCurrentGrants(c)
+	leaveResponses := make([]gin.H, 0, len(leaves))
+	for _, leave := range leaves {
 		// Get employee info
 		var employee models.User
 		config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
 
+		// Only departments the user approves for, plus leave routed to them
+		if leave.HRDelegate != userObjID && !coversStage(grants, "HR", employee.Department) {
+			continue
+		}
+
 		// Get reliever info
 		var reliever models.User
 		config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Reliever}).Decode(&reliever)
 
-		leaveResponses[i] = gin.H{
+		leaveResponses = append(leaveResponses, gin.H{
 			"id": leave.ID,
 			"employee": gin.H{
 				"id":         employee.ID,
@@ -734,7 +917,7 @@ func GetHRLeaves(c *gin.Context) {
 			"isEditable":         leave.IsEditable,
 			"isActive":           leave.IsActive,
 			"createdAt":          leave.CreatedAt,
-		}
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -745,14 +928,25 @@ func GetHRLeaves(c *gin.Context) {
 
 // GetGEDLeaves returns leave requests for GED to review (HOD and HR approved only)
 func GetGEDLeaves(c *gin.Context) {
+	userObjID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Get leave requests that have been approved by both HOD and HR
 	cursor, err := config.LeavesCollection.Find(ctx, bson.M{
-		"hodApprovalStatus": "approved",
-		"hrApprovalStatus":  "approved",
+		"hodApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
+		"hrApprovalStatus":  bson.M{"$in": models.ClearedApprovalStageStatuses},
 		"isActive":          true,
+		"employee":          bson.M{"$ne": userObjID}, // Approvers never review their own leave
+		"$or": []bson.M{
+			{"gedDelegate": bson.M{"$exists": false}},
+			{"gedDelegate": userObjID},
+		},
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leave requests"})
@@ -767,17 +961,23 @@ func GetGEDLeaves(c *gin.Context) {
 	}
 
 	// Populate employee data for each leave
-	leaveResponses := make([]gin.H, len(leaves))
-	for i, leave := range leaves {
+	grants := middleware.GetCurrentGrants(c)
+	leaveResponses := make([]gin.H, 0, len(leaves))
+	for _, leave := range leaves {
 		// Get employee info
 		var employee models.User
 		config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
 
+		// Only departments the user approves for, plus leave routed to them
+		if leave.GEDDelegate != userObjID && !coversStage(grants, "GED", employee.Department) {
+			continue
+		}
+
 		// Get reliever info
 		var reliever models.User
 		config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Reliever}).Decode(&reliever)
 
-		leaveResponses[i] = gin.H{
+		leaveResponses = append(leaveResponses, gin.H{
 			"id": leave.ID,
 			"employee": gin.H{
 				"id":         employee.ID,
@@ -809,7 +1009,7 @@ func GetGEDLeaves(c *gin.Context) {
 			"isEditable":         leave.IsEditable,
 			"isActive":           leave.IsActive,
 			"createdAt":          leave.CreatedAt,
-		}
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Separation-of-duties violations
+var (
+	ErrSelfApproval        = errors.New("You cannot approve or reject your own leave request")
+	ErrDuplicateStageActor = errors.New("You have already acted on another stage of this leave request")
+	ErrStageDelegated      = errors.New("This stage has been routed to an alternate approver")
+)
+
+// checkSeparationOfDuties verifies that approverID may act on the given stage ("HOD", "HR" or "GED")
+func checkSeparationOfDuties(leave *models.Leave, stage string, approverID primitive.ObjectID) error {
+	// Nobody approves their own leave, whatever their role
+	if leave.Employee == approverID {
+		return ErrSelfApproval
+	}
+
+	// The same person may not sign off two stages of one request
+	stageApprovers := map[string]primitive.ObjectID{
+		"HOD": leave.HODApprover,
+		"HR":  leave.HRApprover,
+		"GED": leave.GEDApprover,
+	}
+	for s, id := range stageApprovers {
+		if s != stage && !id.IsZero() && id == approverID {
+			return ErrDuplicateStageActor
+		}
+	}
+	for _, step := range leave.ApprovalFlow {
+		if step.Role != stage && step.Approver == approverID {
+			return ErrDuplicateStageActor
+		}
+	}
+
+	// Stages routed to an alternate approver can only be handled by that approver
+	delegate := stageDelegate(leave, stage)
+	if !delegate.IsZero() && delegate != approverID {
+		return ErrStageDelegated
+	}
+
+	return nil
+}
+
+// stageDelegate returns the alternate approver assigned to a stage, if any
+func stageDelegate(leave *models.Leave, stage string) primitive.ObjectID {
+	switch stage {
+	case "HOD":
+		return leave.HODDelegate
+	case "HR":
+		return leave.HRDelegate
+	case "GED":
+		return leave.GEDDelegate
+	}
+	return primitive.NilObjectID
+}
+
+// routeApprovals assigns alternate approvers when the employee would otherwise
+// approve their own leave, judged by the stage permissions they hold over
+// their own department. Their leave goes to their deputy at those stages; at
+// the HOD stage it is skipped entirely when no deputy is set, and at HR and
+// GED any other approver can act on it.
+func routeApprovals(ctx context.Context, employee *models.User, leave *models.Leave) {
+	deputy := validDeputy(ctx, employee)
+	grants := middleware.UserGrants(ctx, employee)
+
+	if approvesOwnStage(grants, employee, "HOD") {
+		if !deputy.IsZero() {
+			leave.HODDelegate = deputy
+		} else {
+			leave.HODApprovalStatus = "skipped"
+			leave.HODApprovalComment = "HOD stage skipped: requester is the head of department"
+			leave.Stage = 2
+			leave.IsEditable = false
+		}
+	}
+	if approvesOwnStage(grants, employee, "HR") {
+		leave.HRDelegate = deputy
+	}
+	if approvesOwnStage(grants, employee, "GED") {
+		leave.GEDDelegate = deputy
+	}
+}
+
+// approvesOwnStage reports whether employee holds the permission for stage
+// over their own department, so their leave would otherwise come to them
+func approvesOwnStage(grants models.Grants, employee *models.User, stage string) bool {
+	return grants.Covers(models.StagePermission(stage), employee.Department)
+}
+
+// validDeputy returns the user's deputy if they can currently act as an approver
+func validDeputy(ctx context.Context, user *models.User) primitive.ObjectID {
+	if user.Deputy.IsZero() || user.Deputy == user.ID {
+		return primitive.NilObjectID
+	}
+
+	var deputy models.User
+	err := config.UsersCollection.FindOne(ctx, bson.M{"_id": user.Deputy}).Decode(&deputy)
+	if err != nil || !deputy.IsActive || !canApprove(ctx, &deputy) {
+		return primitive.NilObjectID
+	}
+
+	return deputy.ID
+}
+
+// stageFieldPrefix returns the bson field prefix used for a stage's approval fields
+func stageFieldPrefix(stage string) string {
+	switch stage {
+	case "HOD":
+		return "hod"
+	case "HR":
+		return "hr"
+	case "GED":
+		return "ged"
+	}
+	return ""
+}
+
+// employeeDepartment returns the department of the employee who requested leave
+func employeeDepartment(ctx context.Context, leave *models.Leave) (string, error) {
+	var employee models.User
+	err := config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}, options.FindOne().SetProjection(bson.M{"department": 1})).Decode(&employee)
+	if err != nil {
+		return "", err
+	}
+	return employee.Department, nil
+}
+
+// isLeaveApprover reports whether user approves or has approved leave at any
+// stage, or may see leave from the employee's department
+func isLeaveApprover(ctx context.Context, leave *models.Leave, user *models.User) bool {
+	for _, id := range []primitive.ObjectID{
+		leave.HODDelegate, leave.HRDelegate, leave.GEDDelegate,
+		leave.HODApprover, leave.HRApprover, leave.GEDApprover,
+	} {
+		if !id.IsZero() && id == user.ID {
+			return true
+		}
+	}
+	for _, step := range leave.ApprovalFlow {
+		if step.Approver == user.ID {
+			return true
+		}
+	}
+
+	grants := middleware.UserGrants(ctx, user)
+	if !grants.Has(models.PermLeaveView) {
+		return false
+	}
+	department, err := employeeDepartment(ctx, leave)
+	return err == nil && grants.Covers(models.PermLeaveView, department)
+}
+
+// canManageLeave reports whether the current user may change leave on its
+// employee's behalf
+func canManageLeave(ctx context.Context, c *gin.Context, leave *models.Leave) bool {
+	grants := middleware.GetCurrentGrants(c)
+	if !grants.Has(models.PermLeaveManage) {
+		return false
+	}
+	department, err := employeeDepartment(ctx, leave)
+	return err == nil && grants.Covers(models.PermLeaveManage, department)
+}
+
+// canApprove reports whether user may decide leave at some stage, as
+// deputies must
+func canApprove(ctx context.Context, user *models.User) bool {
+	return middleware.UserGrants(ctx, user).HasAny(models.ApprovePermissions...)
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/storage"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Leave types that need supporting documents when longer than the given number of working days
+var defaultAttachmentRequiredAbove = map[string]int{"Sick Leave": 2}
+
+// defaultAttachmentMaxBytes caps the size of a single attachment
+const defaultAttachmentMaxBytes int64 = 5 << 20
+
+// ErrAttachmentRequired is returned when a leave cannot be approved without supporting documents
+var ErrAttachmentRequired = errors.New("A supporting document must be attached before this leave can be approved")
+
+// attachmentRequired reports whether the leave's type and length call for an attachment
+func attachmentRequired(leave *models.Leave) bool {
+	limits := config.GetLeaveTypeLimits("ATTACHMENT_REQUIRED_ABOVE_DAYS", defaultAttachmentRequiredAbove)
+	limit, ok := limits[leave.LeaveType]
+	return ok && leave.TotalDays > limit
+}
+
+// checkAttachmentRequirement blocks approval of leave that still lacks a required attachment
+func checkAttachmentRequirement(ctx context.Context, leave *models.Leave) error {
+	if !attachmentRequired(leave) {
+		return nil
+	}
+
+	count, err := config.AttachmentsCollection.CountDocuments(ctx, bson.M{"leave": leave.ID})
+	if err != nil {
+		return errors.New("Failed to check leave attachments")
+	}
+	if count == 0 {
+		return ErrAttachmentRequired
+	}
+	return nil
+}
+
+// canViewAttachments reports whether user may see a leave's attachments: the
+// employee, anyone who approves or has approved the leave, and HR
+func canViewAttachments(ctx context.Context, leave *models.Leave, user *models.User) bool {
+	return leave.Employee == user.ID || isLeaveApprover(ctx, leave, user)
+}
+
+// canUploadAttachments reports whether user may attach documents to a leave
+func canUploadAttachments(ctx context.Context, leave *models.Leave, user *models.User) bool {
+	return leave.Employee == user.ID || canManageAttachments(ctx, leave, user)
+}
+
+// canManageAttachments reports whether user may add and remove attachments
+// on leave from the employee's department
+func canManageAttachments(ctx context.Context, leave *models.Leave, user *models.User) bool {
+	grants := middleware.UserGrants(ctx, user)
+	if !grants.Has(models.PermLeaveAttachments) {
+		return false
+	}
+	department, err := employeeDepartment(ctx, leave)
+	return err == nil && grants.Covers(models.PermLeaveAttachments, department)
+}
+
+// loadLeaveForAttachments fetches the leave named in the route and the current
+// user, writing an error response and returning false if either is unavailable
+func loadLeaveForAttachments(ctx context.Context, c *gin.Context) (*models.Leave, *models.User, bool) {
+	leaveID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return nil, nil, false
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return nil, nil, false
+	}
+
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return nil, nil, false
+	}
+
+	if !canViewAttachments(ctx, &leave, user) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You do not have access to this leave's attachments",
+		})
+		return nil, nil, false
+	}
+
+	return &leave, user, true
+}
+
+// UploadLeaveAttachment stores a supporting document against a leave request
+func UploadLeaveAttachment(c *gin.Context) {
+	maxBytes := config.GetInt64("ATTACHMENT_MAX_BYTES", defaultAttachmentMaxBytes)
+
+	// Leave headroom for the multipart envelope; the file size is checked below
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+(1<<20))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	leave, user, ok := loadLeaveForAttachments(ctx, c)
+	if !ok {
+		return
+	}
+
+	if !canUploadAttachments(ctx, leave, user) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Only the employee or HR can attach documents to this leave",
+		})
+		return
+	}
+
+	if leave.Status == "Rejected" || leave.Status == "Cancelled" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Cannot attach documents to " + strings.ToLower(leave.Status) + " leave",
+		})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"success": false,
+				"message": "Attachment is too large",
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "A file is required",
+		})
+		return
+	}
+
+	if header.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"message": "Attachment is too large",
+		})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Failed to read uploaded file",
+		})
+		return
+	}
+	defer file.Close()
+
+	// Detect the type from the contents rather than trusting the client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Failed to read uploaded file",
+		})
+		return
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !models.IsAllowedAttachmentType(contentType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"success": false,
+			"message": "Only PDF, JPEG and PNG files can be attached",
+		})
+		return
+	}
+
+	attachment := models.Attachment{
+		ID:          primitive.NewObjectID(),
+		Leave:       leave.ID,
+		FileName:    attachmentFileName(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		UploadedBy:  user.ID,
+		CreatedAt:   time.Now(),
+	}
+	attachment.StorageKey = "leaves/" + leave.ID.Hex() + "/" + attachment.ID.Hex()
+
+	if err := storage.Attachments.Put(ctx, attachment.StorageKey, io.MultiReader(bytes.NewReader(head), file)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to store attachment",
+		})
+		return
+	}
+
+	_, err = config.AttachmentsCollection.InsertOne(ctx, attachment)
+	if err != nil {
+		// Rollback: remove the stored file if the record could not be saved
+		storage.Attachments.Delete(ctx, attachment.StorageKey)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to save attachment",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":    true,
+		"message":    "Attachment uploaded successfully",
+		"attachment": attachment,
+	})
+}
+
+// GetLeaveAttachments lists the attachments on a leave request
+func GetLeaveAttachments(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leave, _, ok := loadLeaveForAttachments(ctx, c)
+	if !ok {
+		return
+	}
+
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	cursor, err := config.AttachmentsCollection.Find(ctx, bson.M{"leave": leave.ID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch attachments",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	attachments := []models.Attachment{}
+	if err := cursor.All(ctx, &attachments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode attachments",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":            true,
+		"count":              len(attachments),
+		"attachmentRequired": attachmentRequired(leave),
+		"attachments":        attachments,
+	})
+}
+
+// DownloadLeaveAttachment streams an attachment's file
+func DownloadLeaveAttachment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	leave, _, ok := loadLeaveForAttachments(ctx, c)
+	if !ok {
+		return
+	}
+
+	attachment, ok := findLeaveAttachment(ctx, c, leave)
+	if !ok {
+		return
+	}
+
+	reader, err := storage.Attachments.Open(ctx, attachment.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Attachment file not found",
+		})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+	})
+}
+
+// DeleteLeaveAttachment removes an attachment while the leave is still under review
+func DeleteLeaveAttachment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leave, user, ok := loadLeaveForAttachments(ctx, c)
+	if !ok {
+		return
+	}
+
+	attachment, ok := findLeaveAttachment(ctx, c, leave)
+	if !ok {
+		return
+	}
+
+	if attachment.UploadedBy != user.ID && !canManageAttachments(ctx, leave, user) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You can only remove attachments you uploaded",
+		})
+		return
+	}
+
+	// Documents that supported an approval are kept
+	if leave.Status != "Pending" && leave.Status != "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Attachments can only be removed while the leave is under review",
+		})
+		return
+	}
+
+	_, err := config.AttachmentsCollection.DeleteOne(ctx, bson.M{"_id": attachment.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete attachment",
+		})
+		return
+	}
+	storage.Attachments.Delete(ctx, attachment.StorageKey)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Attachment deleted successfully",
+	})
+}
+
+// findLeaveAttachment fetches the attachment named in the route, which must belong to leave
+func findLeaveAttachment(ctx context.Context, c *gin.Context, leave *models.Leave) (*models.Attachment, bool) {
+	attachmentID, err := primitive.ObjectIDFromHex(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid attachment ID",
+		})
+		return nil, false
+	}
+
+	var attachment models.Attachment
+	err = config.AttachmentsCollection.FindOne(ctx, bson.M{"_id": attachmentID, "leave": leave.ID}).Decode(&attachment)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Attachment not found",
+		})
+		return nil, false
+	}
+
+	return &attachment, true
+}
+
+// attachmentFileName strips any client-supplied path from an uploaded file name
+func attachmentFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	return name
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flowkit/backend/audit"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AdminGetAuditLogs returns audit log entries, newest first (admin only).
+// Supports ?action=, ?user= (entries about or by that user) and ?limit=N
+// (default 50, max 500).
+func AdminGetAuditLogs(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	filter := bson.M{}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+	if user := c.Query("user"); user != "" {
+		userID, err := primitive.ObjectIDFromHex(user)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid user ID",
+			})
+			return
+		}
+		filter["$or"] = bson.A{bson.M{"target": userID}, bson.M{"actor": userID}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entries, err := audit.List(ctx, filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch audit logs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"count":   len(entries),
+		"logs":    entries,
+	})
+}
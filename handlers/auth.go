@@ -99,8 +99,8 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := middleware.GenerateToken(user.ID)
+	// Start a session
+	tokens, err := middleware.StartSession(ctx, user.ID, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -109,12 +109,11 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"success": true,
-		"message": "Registration successful",
-		"token":   token,
-		"user":    user.ToResponse(),
-	})
+	response := tokens.JSON()
+	response["success"] = true
+	response["message"] = "Registration successful"
+	response["user"] = user.ToResponse()
+	c.JSON(http.StatusCreated, response)
 }
 
 // Login handles user login
@@ -131,10 +130,26 @@ func Login(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Accounts and addresses with recent failures have to wait between tries
+	wait, locked, err := checkLoginThrottle(ctx, req.Email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to process login",
+		})
+		return
+	}
+	if wait > 0 {
+		rejectThrottledLogin(c, wait, locked)
+		return
+	}
+
 	// Find user by email
 	var user models.User
-	err := config.UsersCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	err = config.UsersCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
 	if err != nil {
+		// Unknown emails count too, so guessing at accounts is throttled the same way
+		recordLoginFailure(ctx, req.Email, c.ClientIP(), primitive.NilObjectID)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"message": "Invalid credentials",
@@ -153,6 +168,7 @@ func Login(c *gin.Context) {
 
 	// Check password
 	if !utils.CheckPassword(req.Password, user.Password) {
+		recordLoginFailure(ctx, req.Email, c.ClientIP(), user.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"message": "Invalid credentials",
@@ -160,8 +176,33 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := middleware.GenerateToken(user.ID)
+	// With two-factor authentication the password only gets as far as asking for a code
+	if user.TwoFactorEnabled {
+		challengeToken, err := startLoginChallenge(ctx, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to start sign-in",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":           true,
+			"message":           "Enter the code from your authenticator app",
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+			"expiresIn":         int64(loginChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	// Failures are forgotten only once sign-in is complete, so knowing the
+	// password does not reset the count against guessing the code
+	clearLoginFailures(ctx, req.Email)
+
+	// Start a session
+	tokens, err := middleware.StartSession(ctx, user.ID, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -170,11 +211,96 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	response := tokens.JSON()
+	response["success"] = true
+	response["message"] = "Login successful"
+	response["user"] = user.ToResponse()
+	if twoFactorRequired(ctx, &user) {
+		response["twoFactorSetupRequired"] = true
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and refresh
+// token. Each refresh token works once; reusing one signs the session out.
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, tokens, err := middleware.RefreshSession(ctx, req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err == middleware.ErrRefreshTokenReused {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Refresh token has already been used. Please sign in again.",
+		})
+		return
+	}
+	if err == middleware.ErrInvalidRefreshToken {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid or expired refresh token",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to refresh session",
+		})
+		return
+	}
+
+	var user models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": session.User}).Decode(&user)
+	if err != nil || !user.IsActive {
+		middleware.RevokeSession(ctx, session.ID, "user deactivated")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Account has been deactivated. Please contact administrator.",
+		})
+		return
+	}
+
+	response := tokens.JSON()
+	response["success"] = true
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout ends the session a refresh token belongs to
+func Logout(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Signing out twice is not an error, so an unknown token is ignored
+	if _, err := middleware.RevokeRefreshToken(ctx, req.RefreshToken, "logged out"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to log out",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Login successful",
-		"token":   token,
-		"user":    user.ToResponse(),
+		"message": "Logged out successfully",
 	})
 }
 
@@ -190,8 +316,9 @@ func GetMe(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"user":    user.ToResponse(),
+		"success":     true,
+		"user":        user.ToResponse(),
+		"permissions": middleware.GetCurrentGrants(c).List(),
 	})
 }
 
@@ -265,8 +392,24 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
-	// Generate new token
-	token, err := middleware.GenerateToken(userID)
+	// Sign out every other device, and keep this one with a fresh access token
+	sessionID, err := middleware.GetCurrentSessionID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Session not found",
+		})
+		return
+	}
+	if _, err := middleware.RevokeUserSessions(ctx, userID, sessionID, "password changed"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to sign out other sessions",
+		})
+		return
+	}
+
+	token, err := middleware.GenerateToken(userID, sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
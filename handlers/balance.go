@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInsufficientBalance is returned when an employee does not have enough days available
+var ErrInsufficientBalance = errors.New("insufficient leave balance")
+
+// refundLeaveDays returns days to an employee's available balance
+func refundLeaveDays(ctx context.Context, employeeID primitive.ObjectID, days int) error {
+	if days == 0 {
+		return nil
+	}
+
+	_, err := config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": employeeID},
+		bson.M{
+			"$inc": bson.M{
+				"leaveBalance.available": days,
+				"leaveBalance.used":      -days,
+			},
+			"$set": bson.M{"updatedAt": time.Now()},
+		},
+	)
+	return err
+}
+
+// deductLeaveDays takes days from an employee's available balance, failing if
+// the balance is insufficient
+func deductLeaveDays(ctx context.Context, employeeID primitive.ObjectID, days int) error {
+	if days == 0 {
+		return nil
+	}
+
+	result, err := config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": employeeID, "leaveBalance.available": bson.M{"$gte": days}},
+		bson.M{
+			"$inc": bson.M{
+				"leaveBalance.available": -days,
+				"leaveBalance.used":      days,
+			},
+			"$set": bson.M{"updatedAt": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInsufficientBalance
+	}
+	return nil
+}
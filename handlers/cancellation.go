@@ -0,0 +1,757 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InitCancellations creates the cancellation request indexes. At most one
+// request per leave may be pending.
+func InitCancellations() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.CancellationsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "leave", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": "Pending"}),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create cancellation indexes: %v", err)
+	}
+}
+
+// cancellableLeaveStatuses are the leave statuses an approved cancellation
+// can still be applied to
+var cancellableLeaveStatuses = []string{"Approved", "Active"}
+
+// Default approval path for cancelling approved leave
+var defaultCancellationPath = []string{"HOD", "HR"}
+
+// RequestLeaveCancellation files a request to cancel all or the remaining part of an approved leave
+func RequestLeaveCancellation(c *gin.Context) {
+	idParam := c.Param("id")
+	leaveID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return
+	}
+
+	var req models.CreateCancellationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var fromDate *time.Time
+	if req.FromDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.FromDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid from date format. Use YYYY-MM-DD",
+			})
+			return
+		}
+		fromDate = &parsed
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get leave
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+
+	// Check ownership
+	if leave.Employee != user.ID && !canManageLeave(ctx, c, &leave) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Not authorized to cancel this leave request",
+		})
+		return
+	}
+
+	fileCancellation(ctx, c, &leave, user, fromDate, req.Reason)
+}
+
+// fileCancellation creates a cancellation request for an approved or active leave
+// and writes the response. With an empty approval path it is applied immediately.
+func fileCancellation(ctx context.Context, c *gin.Context, leave *models.Leave, user *models.User, fromDate *time.Time, reason string) {
+	if leave.Status != "Approved" && leave.Status != "Active" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Only approved or active leave requires a cancellation request",
+		})
+		return
+	}
+
+	// Only one cancellation can be in flight per leave
+	count, err := config.CancellationsCollection.CountDocuments(ctx, bson.M{
+		"leave":  leave.ID,
+		"status": "Pending",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to check existing cancellation requests",
+		})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "A cancellation request for this leave is already pending",
+		})
+		return
+	}
+
+	// Days already taken cannot be cancelled
+	untaken := models.FirstUntakenDay(leave, time.Now())
+	from := untaken
+	if fromDate != nil {
+		if fromDate.Before(leave.FromDate) || fromDate.After(leave.ToDate) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Cancellation date must fall within the leave period",
+			})
+			return
+		}
+		if fromDate.Before(untaken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Days that have already been taken cannot be cancelled",
+			})
+			return
+		}
+		from = *fromDate
+	}
+	if from.After(leave.ToDate) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "All days of this leave have already been taken",
+		})
+		return
+	}
+
+	var employee models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch employee",
+		})
+		return
+	}
+
+	now := time.Now()
+	cancellation := models.CancellationRequest{
+		ID:       primitive.NewObjectID(),
+		Leave:    leave.ID,
+		Employee: leave.Employee,
+		FromDate: from,
+		Partial:  from.After(leave.FromDate),
+		Reason:   reason,
+		Status:   "Pending",
+		RequestWorkflow: models.RequestWorkflow{
+			Path:      buildRequestPath(ctx, config.GetApprovalPath("CANCELLATION_APPROVAL_PATH", defaultCancellationPath), &employee, leave),
+			Approvals: []models.ApprovalStep{},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err = config.CancellationsCollection.InsertOne(ctx, cancellation)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another request for this leave was filed at the same moment
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "A cancellation request for this leave is already pending",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to create cancellation request",
+		})
+		return
+	}
+
+	// No reviewers configured: cancel straight away
+	if len(cancellation.Path) == 0 {
+		refunded, err := approveCancellation(ctx, &cancellation, leave, user.ID, 0)
+		if errors.Is(err, errLeaveChanged) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Leave was recalled, cancelled or changed by someone else, please reload",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to apply cancellation",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":      true,
+			"message":      "Leave cancelled successfully",
+			"refundedDays": refunded,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":      true,
+		"message":      "Cancellation request submitted for approval",
+		"cancellation": cancellation,
+	})
+}
+
+// GetLeaveCancellations lists cancellation requests filed against a leave
+func GetLeaveCancellations(c *gin.Context) {
+	idParam := c.Param("id")
+	leaveID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+
+	// Employees only see their own; approvers see their departments'
+	if leave.Employee != user.ID && !isLeaveApprover(ctx, &leave, user) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Not authorized to view this leave request",
+		})
+		return
+	}
+
+	cursor, err := config.CancellationsCollection.Find(
+		ctx,
+		bson.M{"leave": leaveID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch cancellation requests",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	cancellations := []models.CancellationRequest{}
+	if err := cursor.All(ctx, &cancellations); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode cancellation requests",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"count":         len(cancellations),
+		"cancellations": cancellations,
+	})
+}
+
+// GetPendingCancellations lists cancellation requests awaiting the current approver
+func GetPendingCancellations(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := config.CancellationsCollection.Find(
+		ctx,
+		bson.M{"status": "Pending"},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch cancellation requests",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var cancellations []models.CancellationRequest
+	if err := cursor.All(ctx, &cancellations); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode cancellation requests",
+		})
+		return
+	}
+
+	// Keep only requests this user may decide on at their current stage
+	responses := []gin.H{}
+	for _, cancellation := range cancellations {
+		var leave models.Leave
+		if err := config.LeavesCollection.FindOne(ctx, bson.M{"_id": cancellation.Leave}).Decode(&leave); err != nil {
+			continue
+		}
+
+		stage := cancellation.CurrentStage()
+		if checkStageAuthority(ctx, &leave, user, stage) != nil {
+			continue
+		}
+		if checkRequestSeparationOfDuties(&leave, &cancellation.RequestWorkflow, stage, user.ID) != nil {
+			continue
+		}
+
+		var employee models.User
+		config.UsersCollection.FindOne(ctx, bson.M{"_id": cancellation.Employee}).Decode(&employee)
+
+		responses = append(responses, gin.H{
+			"id": cancellation.ID,
+			"employee": gin.H{
+				"id":         employee.ID,
+				"firstName":  employee.FirstName,
+				"lastName":   employee.LastName,
+				"department": employee.Department,
+			},
+			"leave": gin.H{
+				"id":        leave.ID,
+				"leaveType": leave.LeaveType,
+				"fromDate":  leave.FromDate,
+				"toDate":    leave.ToDate,
+				"totalDays": leave.TotalDays,
+				"status":    leave.Status,
+			},
+			"fromDate":  cancellation.FromDate,
+			"partial":   cancellation.Partial,
+			"reason":    cancellation.Reason,
+			"stage":     stage,
+			"approvals": cancellation.Approvals,
+			"createdAt": cancellation.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"count":         len(responses),
+		"cancellations": responses,
+	})
+}
+
+// ApproveCancellation approves a cancellation request at its current stage
+func ApproveCancellation(c *gin.Context) {
+	decideCancellation(c, true)
+}
+
+// RejectCancellation rejects a cancellation request, leaving the leave untouched
+func RejectCancellation(c *gin.Context) {
+	decideCancellation(c, false)
+}
+
+// decideCancellation records an approver's decision on a cancellation request
+func decideCancellation(c *gin.Context, approve bool) {
+	idParam := c.Param("id")
+	cancellationID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid cancellation request ID",
+		})
+		return
+	}
+
+	var req models.ApproveRejectRequest
+	c.ShouldBindJSON(&req)
+	if !approve && req.Comments == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Please provide reason for rejection",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var cancellation models.CancellationRequest
+	err = config.CancellationsCollection.FindOne(ctx, bson.M{"_id": cancellationID}).Decode(&cancellation)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Cancellation request not found",
+		})
+		return
+	}
+
+	if cancellation.Status != "Pending" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Cancellation request has already been " + cancellation.Status,
+		})
+		return
+	}
+
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": cancellation.Leave}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+
+	stage := cancellation.CurrentStage()
+	if err := checkStageAuthority(ctx, &leave, user, stage); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkRequestSeparationOfDuties(&leave, &cancellation.RequestWorkflow, stage, user.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	previousStep := cancellation.CurrentStep
+	status := "Approved"
+	if !approve {
+		status = "Rejected"
+	}
+	cancellation.Approvals = append(cancellation.Approvals, models.ApprovalStep{
+		Approver: user.ID,
+		Role:     stage,
+		Status:   status,
+		Comments: req.Comments,
+		Date:     now,
+	})
+
+	if approve {
+		cancellation.CurrentStep++
+	}
+
+	// The final approval is recorded together with the cancellation itself,
+	// so a failure leaves the request pending at this stage
+	if approve && cancellation.CurrentStage() == "" {
+		refunded, err := approveCancellation(ctx, &cancellation, &leave, user.ID, previousStep)
+		if errors.Is(err, ErrRequestChanged) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Cancellation request was updated by someone else, please reload",
+			})
+			return
+		}
+		if errors.Is(err, errLeaveChanged) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Leave was recalled, cancelled or changed by someone else, please reload",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to apply cancellation",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":      true,
+			"message":      "Cancellation request approved by " + stage + " - leave updated",
+			"refundedDays": refunded,
+		})
+		return
+	}
+
+	set := bson.M{
+		"approvals": cancellation.Approvals,
+		"updatedAt": now,
+	}
+	if approve {
+		set["currentStep"] = cancellation.CurrentStep
+	} else {
+		set["status"] = "Rejected"
+		set["decidedAt"] = now
+	}
+
+	// Guard against a concurrent decision on the same step
+	result, err := config.CancellationsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": cancellationID, "status": "Pending", "currentStep": previousStep},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update cancellation request",
+		})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Cancellation request was updated by someone else, please reload",
+		})
+		return
+	}
+
+	if !approve {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Cancellation request rejected by " + stage,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   "Cancellation request approved by " + stage,
+		"nextStage": cancellation.CurrentStage(),
+	})
+}
+
+// WithdrawCancellation lets the employee withdraw a pending cancellation request
+func WithdrawCancellation(c *gin.Context) {
+	idParam := c.Param("id")
+	cancellationID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid cancellation request ID",
+		})
+		return
+	}
+
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	result, err := config.CancellationsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": cancellationID, "employee": userID, "status": "Pending"},
+		bson.M{"$set": bson.M{
+			"status":    "Withdrawn",
+			"decidedAt": now,
+			"updatedAt": now,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to withdraw cancellation request",
+		})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No pending cancellation request found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Cancellation request withdrawn",
+	})
+}
+
+// approveCancellation marks a cancellation approved at its final step and
+// applies it to the leave. Only days not yet taken at this point are refunded:
+// if the leave has not started it is cancelled outright, otherwise it is cut
+// short. previousStep is the step the request was at when it was loaded.
+func approveCancellation(ctx context.Context, cancellation *models.CancellationRequest, leave *models.Leave, actor primitive.ObjectID, previousStep int) (int, error) {
+	now := time.Now()
+
+	effectiveFrom := cancellation.FromDate
+	if untaken := models.FirstUntakenDay(leave, now); untaken.After(effectiveFrom) {
+		effectiveFrom = untaken
+	}
+
+	set := bson.M{"updatedAt": now}
+	changes := bson.M{}
+	refunded := 0
+	if !effectiveFrom.After(leave.FromDate) {
+		// Nothing taken yet: the whole leave goes
+		refunded = leave.TotalDays
+		set["status"] = "Cancelled"
+		set["isActive"] = false
+		changes["status"] = bson.M{"from": leave.Status, "to": "Cancelled"}
+	} else if !effectiveFrom.After(leave.ToDate) {
+		newToDate := effectiveFrom.Add(-24 * time.Hour)
+		refunded = models.CalculateDays(effectiveFrom, leave.ToDate)
+		set["toDate"] = newToDate
+		set["totalDays"] = leave.TotalDays - refunded
+		changes["toDate"] = bson.M{"from": leave.ToDate, "to": newToDate}
+		changes["totalDays"] = bson.M{"from": leave.TotalDays, "to": leave.TotalDays - refunded}
+	}
+
+	// Approve the request, shorten or cancel the leave, refund the days and
+	// announce it together
+	err := config.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := config.CancellationsCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": cancellation.ID, "status": "Pending", "currentStep": previousStep},
+			bson.M{"$set": bson.M{
+				"approvals":    cancellation.Approvals,
+				"currentStep":  cancellation.CurrentStep,
+				"status":       "Approved",
+				"refundedDays": refunded,
+				"decidedAt":    now,
+				"updatedAt":    now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrRequestChanged
+		}
+
+		// The leave must still be as it was loaded, so a recall or another
+		// cancellation meanwhile cannot refund the same days twice
+		result, err = config.LeavesCollection.UpdateOne(
+			ctx,
+			bson.M{
+				"_id":    leave.ID,
+				"status": bson.M{"$in": cancellableLeaveStatuses},
+				"toDate": leave.ToDate,
+				"recall": bson.M{"$exists": false},
+			},
+			bson.M{
+				"$set": set,
+				"$push": bson.M{
+					"history": models.LeaveHistoryEntry{
+						Action:   "cancellation_approved",
+						Actor:    actor,
+						Comments: cancellation.Reason,
+						Changes:  changes,
+						Date:     now,
+					},
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errLeaveChanged
+		}
+
+		if err := refundLeaveDays(ctx, leave.Employee, refunded); err != nil {
+			return err
+		}
+
+		// An extension still pending on the leave can no longer apply
+		if err := rejectPendingExtension(ctx, leave, actor); err != nil {
+			return err
+		}
+
+		return publishLeaveCancelled(ctx, leave, actor, map[string]interface{}{
+			"partial":      set["status"] == nil,
+			"fromDate":     effectiveFrom,
+			"refundedDays": refunded,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return refunded, nil
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errCommentEditWindowClosed is returned when a comment is edited after the edit window
+var errCommentEditWindowClosed = errors.New("comment edit window has closed")
+
+// canViewComments reports whether user may read and post in a leave's
+// discussion thread: the employee, their reliever and the leave's approvers
+func canViewComments(ctx context.Context, leave *models.Leave, user *models.User) bool {
+	return leave.Employee == user.ID || leave.Reliever == user.ID || isLeaveApprover(ctx, leave, user)
+}
+
+// loadLeaveForComments fetches the leave named in the route and the current
+// user, writing an error response and returning false if either is unavailable
+func loadLeaveForComments(ctx context.Context, c *gin.Context) (*models.Leave, *models.User, bool) {
+	leaveID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return nil, nil, false
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return nil, nil, false
+	}
+
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return nil, nil, false
+	}
+
+	if !canViewComments(ctx, &leave, user) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You do not have access to this leave's comments",
+		})
+		return nil, nil, false
+	}
+
+	return &leave, user, true
+}
+
+// GetLeaveComments returns the discussion thread on a leave request, oldest first
+func GetLeaveComments(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leave, _, ok := loadLeaveForComments(ctx, c)
+	if !ok {
+		return
+	}
+
+	opts := options.Find().SetSort(bson.M{"createdAt": 1})
+	cursor, err := config.CommentsCollection.Find(ctx, bson.M{"leave": leave.ID}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch comments",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var comments []models.Comment
+	if err := cursor.All(ctx, &comments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode comments",
+		})
+		return
+	}
+
+	// Populate author data for each comment
+	authors := map[primitive.ObjectID]models.User{}
+	commentResponses := make([]gin.H, len(comments))
+	for i, comment := range comments {
+		author, found := authors[comment.Author]
+		if !found {
+			config.UsersCollection.FindOne(ctx, bson.M{"_id": comment.Author}).Decode(&author)
+			authors[comment.Author] = author
+		}
+
+		commentResponses[i] = gin.H{
+			"id": comment.ID,
+			"author": gin.H{
+				"id":        author.ID,
+				"firstName": author.FirstName,
+				"lastName":  author.LastName,
+				"role":      author.Role,
+			},
+			"body":      comment.Body,
+			"mentions":  comment.Mentions,
+			"editedAt":  comment.EditedAt,
+			"createdAt": comment.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"count":    len(commentResponses),
+		"comments": commentResponses,
+	})
+}
+
+// AddLeaveComment posts a comment to a leave's discussion thread
+func AddLeaveComment(c *gin.Context) {
+	var req models.CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Comment text is required (up to 2000 characters)",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leave, user, ok := loadLeaveForComments(ctx, c)
+	if !ok {
+		return
+	}
+
+	comment := models.Comment{
+		ID:        primitive.NewObjectID(),
+		Leave:     leave.ID,
+		Author:    user.ID,
+		Body:      strings.TrimSpace(req.Body),
+		Mentions:  resolveMentions(ctx, leave, req.Body),
+		CreatedAt: time.Now(),
+	}
+
+	// Save the comment and its notifications together
+	err := config.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := config.CommentsCollection.InsertOne(ctx, comment); err != nil {
+			return err
+		}
+		return publishCommentEvents(ctx, leave, &comment, comment.Mentions, true)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to post comment",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Comment posted successfully",
+		"comment": comment,
+	})
+}
+
+// UpdateLeaveComment lets the author edit a comment shortly after posting it
+func UpdateLeaveComment(c *gin.Context) {
+	var req models.CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Comment text is required (up to 2000 characters)",
+		})
+		return
+	}
+
+	commentID, err := primitive.ObjectIDFromHex(c.Param("commentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid comment ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leave, user, ok := loadLeaveForComments(ctx, c)
+	if !ok {
+		return
+	}
+
+	var comment models.Comment
+	err = config.CommentsCollection.FindOne(ctx, bson.M{"_id": commentID, "leave": leave.ID}).Decode(&comment)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Comment not found",
+		})
+		return
+	}
+
+	if comment.Author != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You can only edit your own comments",
+		})
+		return
+	}
+
+	now := time.Now()
+	editableSince := now.Add(-models.CommentEditWindow)
+	if comment.CreatedAt.Before(editableSince) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Comments can only be edited within 15 minutes of posting",
+		})
+		return
+	}
+
+	mentions := resolveMentions(ctx, leave, req.Body)
+
+	// Only users mentioned for the first time hear about the edit
+	previous := map[primitive.ObjectID]bool{}
+	for _, id := range comment.Mentions {
+		previous[id] = true
+	}
+	added := []primitive.ObjectID{}
+	for _, id := range mentions {
+		if !previous[id] {
+			added = append(added, id)
+		}
+	}
+
+	comment.Body = strings.TrimSpace(req.Body)
+	comment.Mentions = mentions
+	comment.EditedAt = &now
+
+	// Save the edit and its notifications together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := config.CommentsCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": commentID, "author": user.ID, "createdAt": bson.M{"$gte": editableSince}},
+			bson.M{"$set": bson.M{
+				"body":     comment.Body,
+				"mentions": mentions,
+				"editedAt": now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errCommentEditWindowClosed
+		}
+		return publishCommentEvents(ctx, leave, &comment, added, false)
+	})
+	if err == errCommentEditWindowClosed {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Comments can only be edited within 15 minutes of posting",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update comment",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Comment updated successfully",
+		"comment": comment,
+	})
+}
+
+// resolveMentions maps the emails mentioned in body to users who can see the
+// leave's thread. Mentions of anyone else are ignored rather than widening access.
+func resolveMentions(ctx context.Context, leave *models.Leave, body string) []primitive.ObjectID {
+	emails := models.ParseMentions(body)
+	if len(emails) == 0 {
+		return nil
+	}
+
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{"email": bson.M{"$in": emails}, "isActive": true})
+	if err != nil {
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil
+	}
+
+	mentions := []primitive.ObjectID{}
+	for i := range users {
+		if canViewComments(ctx, leave, &users[i]) {
+			mentions = append(mentions, users[i].ID)
+		}
+	}
+	return mentions
+}
+
+// commentParticipants returns everyone following a leave's thread: the
+// employee, reliever, stage approvers and previous commenters
+func commentParticipants(ctx context.Context, leave *models.Leave) []primitive.ObjectID {
+	ids := []primitive.ObjectID{
+		leave.Employee, leave.Reliever,
+		leave.HODApprover, leave.HRApprover, leave.GEDApprover,
+		leave.HODDelegate, leave.HRDelegate, leave.GEDDelegate,
+	}
+	for _, step := range leave.ApprovalFlow {
+		ids = append(ids, step.Approver)
+	}
+
+	authors, err := config.CommentsCollection.Distinct(ctx, "author", bson.M{"leave": leave.ID})
+	if err == nil {
+		for _, author := range authors {
+			if id, ok := author.(primitive.ObjectID); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// publishCommentEvents notifies mentioned users and, for new comments, the
+// rest of the thread's participants. The author is never notified.
+func publishCommentEvents(ctx context.Context, leave *models.Leave, comment *models.Comment, mentions []primitive.ObjectID, notifyParticipants bool) error {
+	data := map[string]interface{}{
+		"commentId": comment.ID,
+		"excerpt":   commentExcerpt(comment.Body),
+	}
+
+	notified := map[primitive.ObjectID]bool{comment.Author: true, primitive.NilObjectID: true}
+	mentioned := []primitive.ObjectID{}
+	for _, id := range mentions {
+		if !notified[id] {
+			notified[id] = true
+			mentioned = append(mentioned, id)
+		}
+	}
+	if len(mentioned) > 0 {
+		err := events.Publish(ctx, events.Event{
+			Type:       events.LeaveMentioned,
+			LeaveID:    leave.ID,
+			Employee:   leave.Employee,
+			Actor:      comment.Author,
+			Recipients: mentioned,
+			Data:       data,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !notifyParticipants {
+		return nil
+	}
+
+	recipients := []primitive.ObjectID{}
+	for _, id := range commentParticipants(ctx, leave) {
+		if !notified[id] {
+			notified[id] = true
+			recipients = append(recipients, id)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+	return events.Publish(ctx, events.Event{
+		Type:       events.LeaveCommented,
+		LeaveID:    leave.ID,
+		Employee:   leave.Employee,
+		Actor:      comment.Author,
+		Recipients: recipients,
+		Data:       data,
+	})
+}
+
+// commentExcerpt shortens a comment body for notifications
+func commentExcerpt(body string) string {
+	runes := []rune(body)
+	if len(runes) <= 140 {
+		return body
+	}
+	return string(runes[:140]) + "…"
+}
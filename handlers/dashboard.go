@@ -7,6 +7,7 @@ import (
 
 	"github.com/flowkit/backend/config"
 	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -56,9 +57,9 @@ func GetDashboardStats(c *gin.Context) {
 	// Approved leaves count (only count if all three stages are approved)
 	approvedCount, _ := config.LeavesCollection.CountDocuments(ctx, bson.M{
 		"employee":          userID,
-		"hodApprovalStatus": "approved",
-		"hrApprovalStatus":  "approved",
-		"gedApprovalStatus": "approved",
+		"hodApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
+		"hrApprovalStatus":  bson.M{"$in": models.ClearedApprovalStageStatuses},
+		"gedApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
 	})
 
 	// Rejected leaves count (rejected at any stage)
@@ -260,7 +261,7 @@ func GetGraphData(c *gin.Context) {
 			// Categorize by approval status
 			if hodStatus == "rejected" || hrStatus == "rejected" || gedStatus == "rejected" {
 				monthlyData[monthKey]["rejected"] += totalDays
-			} else if hodStatus == "approved" && hrStatus == "approved" && gedStatus == "approved" {
+			} else if models.IsStageCleared(hodStatus) && models.IsStageCleared(hrStatus) && models.IsStageCleared(gedStatus) {
 				// Fully approved - all three stages passed
 				monthlyData[monthKey]["approved"] += totalDays
 			} else {
@@ -352,9 +353,9 @@ func GetAllDashboardData(c *gin.Context) {
 	// Approved count (all three stages approved)
 	approvedCount, _ := config.LeavesCollection.CountDocuments(ctx, bson.M{
 		"employee":          userID,
-		"hodApprovalStatus": "approved",
-		"hrApprovalStatus":  "approved",
-		"gedApprovalStatus": "approved",
+		"hodApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
+		"hrApprovalStatus":  bson.M{"$in": models.ClearedApprovalStageStatuses},
+		"gedApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
 	})
 
 	// Rejected count (rejected at any stage)
@@ -418,9 +419,9 @@ func GetAdminDashboardStats(c *gin.Context) {
 	// Get employees currently on leave (approved and dates include today)
 	today := time.Now()
 	onLeaveCount, _ := config.LeavesCollection.CountDocuments(ctx, bson.M{
-		"hodApprovalStatus": "approved",
-		"hrApprovalStatus":  "approved",
-		"gedApprovalStatus": "approved",
+		"hodApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
+		"hrApprovalStatus":  bson.M{"$in": models.ClearedApprovalStageStatuses},
+		"gedApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
 		"fromDate":          bson.M{"$lte": today},
 		"toDate":            bson.M{"$gte": today},
 	})
@@ -436,12 +437,12 @@ func GetAdminDashboardStats(c *gin.Context) {
 		"$or": []bson.M{
 			{"hodApprovalStatus": "pending"},
 			{
-				"hodApprovalStatus": "approved",
+				"hodApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
 				"hrApprovalStatus":  "pending",
 			},
 			{
-				"hodApprovalStatus": "approved",
-				"hrApprovalStatus":  "approved",
+				"hodApprovalStatus": bson.M{"$in": models.ClearedApprovalStageStatuses},
+				"hrApprovalStatus":  bson.M{"$in": models.ClearedApprovalStageStatuses},
 				"gedApprovalStatus": "pending",
 			},
 		},
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// useTestDatabase points the collections at a new database on the MongoDB
+// server in MONGODB_TEST_URI, dropped when the test ends. Tests that need a
+// database are skipped without one.
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connecting to %s: %v", uri, err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("connecting to %s: %v", uri, err)
+	}
+
+	config.UseDatabase(client, fmt.Sprintf("flowkit_test_%d", time.Now().UnixNano()))
+	db := config.DB
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.Drop(ctx); err != nil {
+			t.Errorf("dropping %s: %v", db.Name(), err)
+		}
+	})
+}
+
+// collectionDocuments returns every document in collection, in _id order
+func collectionDocuments(t *testing.T, collection *mongo.Collection) []bson.M {
+	t.Helper()
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		t.Fatalf("reading %s: %v", collection.Name(), err)
+	}
+	documents := []bson.M{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		t.Fatalf("reading %s: %v", collection.Name(), err)
+	}
+	return documents
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/notifications"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// digestSources holds the leave a run's digests are built from, loaded once
+// and only if some user's digest is due
+type digestSources struct {
+	users    map[primitive.ObjectID]models.User
+	pending  map[primitive.ObjectID][]notifications.DigestItem // By approver
+	upcoming []models.Leave                                    // Approved leave starting within the window
+}
+
+// loadDigestSources gathers every user, the approvers of each pending leave
+// and approved leave starting before horizon
+func loadDigestSources(ctx context.Context, users []models.User, horizon time.Time) (*digestSources, error) {
+	sources := &digestSources{
+		users:   map[primitive.ObjectID]models.User{},
+		pending: map[primitive.ObjectID][]notifications.DigestItem{},
+	}
+	for _, user := range users {
+		sources.users[user.ID] = user
+	}
+
+	cursor, err := config.LeavesCollection.Find(ctx, bson.M{"status": "Pending"})
+	if err != nil {
+		return nil, err
+	}
+	var pending []models.Leave
+	if err := cursor.All(ctx, &pending); err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		leave := &pending[i]
+		stage := leave.PendingStage()
+		if stage == "" {
+			continue
+		}
+		item := notifications.DigestItem{Leave: *leave, Employee: sources.users[leave.Employee], Stage: stage}
+		for _, approver := range stageApprovers(ctx, leave, stage) {
+			sources.pending[approver] = append(sources.pending[approver], item)
+		}
+	}
+
+	// A day either side covers every user's local date
+	cursor, err = config.LeavesCollection.Find(ctx, bson.M{
+		"status":   "Approved",
+		"fromDate": bson.M{"$gte": time.Now().Truncate(24 * time.Hour).Add(-24 * time.Hour), "$lte": horizon},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &sources.upcoming); err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+// digestFor builds a user's digest for the local date today (midnight UTC,
+// matching how leave dates are stored), looking ahead the given number of days
+func (s *digestSources) digestFor(user *models.User, today time.Time, days int) notifications.Digest {
+	digest := notifications.Digest{
+		Date:             today,
+		PendingApprovals: s.pending[user.ID],
+	}
+
+	until := today.AddDate(0, 0, days)
+	for _, leave := range s.upcoming {
+		if leave.FromDate.Before(today) || leave.FromDate.After(until) || leave.Employee == user.ID {
+			continue
+		}
+		employee := s.users[leave.Employee]
+		item := notifications.DigestItem{Leave: leave, Employee: employee}
+
+		if leave.Reliever == user.ID {
+			digest.ReliefDuties = append(digest.ReliefDuties, item)
+		} else if employee.Department == user.Department {
+			digest.UpcomingLeave = append(digest.UpcomingLeave, item)
+		}
+	}
+	return digest
+}
+
+// sendDigest sends the user their digest for today if they want one and it
+// lists anything, reporting whether it was sent
+func (s *digestSources) sendDigest(ctx context.Context, user *models.User, today time.Time, days int) (bool, error) {
+	if !user.WantsNotification(models.DailyDigest, models.ChannelEmail) && !user.WantsNotification(models.DailyDigest, models.ChannelInApp) {
+		return false, nil
+	}
+	digest := s.digestFor(user, today, days)
+	if digest.IsEmpty() {
+		return false, nil
+	}
+	if err := notifications.SendDigest(ctx, *user, digest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// runDailyDigests sends each user their digest, and a reminder if their own
+// leave starts tomorrow, once their preferred time has passed in their
+// timezone. Users are marked as done for the day before anything is sent, so
+// a digest is never sent twice.
+func runDailyDigests(ctx context.Context) (string, error) {
+	days := int(config.GetInt64("DIGEST_LOOKAHEAD_DAYS", 7))
+	now := time.Now()
+
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return "", err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return "", err
+	}
+
+	var sources *digestSources
+	digests, reminders := 0, 0
+	for i := range users {
+		user := &users[i]
+		if !user.IsActive {
+			continue
+		}
+		date, due := notifications.DigestDue(user, now)
+		if !due || user.DigestSentOn == date {
+			continue
+		}
+
+		result, err := config.UsersCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": user.ID, "digestSentOn": bson.M{"$ne": date}},
+			bson.M{"$set": bson.M{"digestSentOn": date}},
+		)
+		if err != nil {
+			return "", err
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		if sources == nil {
+			if sources, err = loadDigestSources(ctx, users, now.AddDate(0, 0, days+1)); err != nil {
+				return "", err
+			}
+		}
+
+		today, _ := time.Parse("2006-01-02", date)
+		reminders += sources.remindLeaveStartingTomorrow(ctx, user, today)
+
+		sent, err := sources.sendDigest(ctx, user, today, days)
+		if err != nil {
+			log.Printf("⚠️  Failed to send digest to %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		if sent {
+			digests++
+		}
+	}
+
+	return fmt.Sprintf("sent %d digests and %d leave reminders", digests, reminders), nil
+}
+
+// remindLeaveStartingTomorrow tells the user to arrange their handover for
+// each of their leave starting the day after today, returning how many
+func (s *digestSources) remindLeaveStartingTomorrow(ctx context.Context, user *models.User, today time.Time) int {
+	tomorrow := today.AddDate(0, 0, 1)
+
+	sent := 0
+	for i := range s.upcoming {
+		leave := &s.upcoming[i]
+		if leave.Employee != user.ID || !leave.FromDate.Equal(tomorrow) {
+			continue
+		}
+
+		data := map[string]interface{}{}
+		if reliever, ok := s.users[leave.Reliever]; ok {
+			data["reliever"] = reliever.FirstName + " " + reliever.LastName
+		}
+		err := publishLeaveEvent(ctx, events.LeaveStartingSoon, leave, primitive.NilObjectID, []primitive.ObjectID{user.ID}, data)
+		if err != nil {
+			log.Printf("⚠️  Failed to remind %s of leave %s: %v", user.ID.Hex(), leave.ID.Hex(), err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
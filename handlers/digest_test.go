@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/notifications"
+	"github.com/flowkit/backend/notifications/notificationstest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// digestUser returns an active user who wants their digest by email only,
+// so sending it needs no database
+func digestUser(first, department string) models.User {
+	return models.User{
+		ID:         primitive.NewObjectID(),
+		FirstName:  first,
+		LastName:   "Tester",
+		Email:      strings.ToLower(first) + "@example.com",
+		Department: department,
+		IsActive:   true,
+		NotificationPreferences: map[string]models.NotificationChannels{
+			models.NotificationPreferenceKey(models.DailyDigest): {Email: true},
+		},
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	today := time.Date(2026, 11, 2, 0, 0, 0, 0, time.UTC)
+
+	approver := digestUser("Kofi", "NOC")
+	colleague := digestUser("Ama", "NOC")
+	reliever := digestUser("Efua", "VAS")
+	requester := digestUser("Yaw", "NOC")
+	idle := digestUser("Esi", "ACCOUNTS")
+	optedOut := digestUser("Kwame", "NOC")
+	optedOut.NotificationPreferences = map[string]models.NotificationChannels{
+		models.NotificationPreferenceKey(models.DailyDigest): {},
+	}
+
+	pendingLeave := models.Leave{
+		ID:        primitive.NewObjectID(),
+		Employee:  requester.ID,
+		LeaveType: "Sick Leave",
+		FromDate:  today.AddDate(0, 0, 1),
+		ToDate:    today.AddDate(0, 0, 2),
+		TotalDays: 2,
+		Status:    "Pending",
+	}
+	upcomingLeave := models.Leave{
+		ID:        primitive.NewObjectID(),
+		Employee:  colleague.ID,
+		Reliever:  reliever.ID,
+		LeaveType: "Annual Leave",
+		FromDate:  today.AddDate(0, 0, 3),
+		ToDate:    today.AddDate(0, 0, 7),
+		Status:    "Approved",
+	}
+	farLeave := models.Leave{
+		ID:        primitive.NewObjectID(),
+		Employee:  requester.ID,
+		LeaveType: "Annual Leave",
+		FromDate:  today.AddDate(0, 0, 30),
+		ToDate:    today.AddDate(0, 0, 31),
+		Status:    "Approved",
+	}
+
+	users := map[primitive.ObjectID]models.User{}
+	for _, user := range []models.User{approver, colleague, reliever, requester, idle, optedOut} {
+		users[user.ID] = user
+	}
+	sources := &digestSources{
+		users: users,
+		pending: map[primitive.ObjectID][]notifications.DigestItem{
+			approver.ID: {{Leave: pendingLeave, Employee: requester, Stage: "HOD"}},
+			optedOut.ID: {{Leave: pendingLeave, Employee: requester, Stage: "HOD"}},
+		},
+		upcoming: []models.Leave{upcomingLeave, farLeave},
+	}
+
+	tests := []struct {
+		name   string
+		user   models.User
+		sent   bool
+		want   []string
+		absent []string
+	}{
+		{
+			name: "approver",
+			user: approver,
+			sent: true,
+			want: []string{
+				"Hello Kofi",
+				"Waiting on your approval (1):",
+				"- Yaw Tester: Sick Leave from Tue 3 Nov 2026 to Wed 4 Nov 2026 (2 working days), HOD review",
+				"Upcoming leave in your department (1):",
+				"- Ama Tester: Annual Leave from Thu 5 Nov 2026 to Mon 9 Nov 2026",
+			},
+			absent: []string{"You are relieving"},
+		},
+		{
+			name: "reliever",
+			user: reliever,
+			sent: true,
+			want: []string{
+				"Hello Efua",
+				"You are relieving (1):",
+				"- Ama Tester from Thu 5 Nov 2026 to Mon 9 Nov 2026",
+			},
+			absent: []string{"Waiting on your approval", "Upcoming leave"},
+		},
+		{
+			name: "own leave is left out",
+			user: colleague,
+			sent: false,
+		},
+		{
+			name: "nothing to report",
+			user: idle,
+			sent: false,
+		},
+		{
+			name: "opted out",
+			user: optedOut,
+			sent: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer := notificationstest.UseMailer(t)
+
+			sent, err := sources.sendDigest(context.Background(), &tt.user, today, 7)
+			if err != nil {
+				t.Fatalf("sendDigest: %v", err)
+			}
+			if sent != tt.sent {
+				t.Fatalf("sent = %v, want %v", sent, tt.sent)
+			}
+			if !tt.sent {
+				mailer.ExpectNone(t)
+				return
+			}
+
+			msg := mailer.Receive(t, 1)[0]
+			mailer.ExpectNone(t)
+			if msg.To != tt.user.Email {
+				t.Errorf("To = %q, want %q", msg.To, tt.user.Email)
+			}
+			if want := "Your FlowKit summary for Mon 2 Nov 2026"; msg.Subject != want {
+				t.Errorf("Subject = %q, want %q", msg.Subject, want)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(msg.Text, line) {
+					t.Errorf("Text does not contain %q:\n%s", line, msg.Text)
+				}
+			}
+			for _, line := range tt.absent {
+				if strings.Contains(msg.Text, line) {
+					t.Errorf("Text contains %q:\n%s", line, msg.Text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/audit"
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/directory"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/oidc"
+	"github.com/flowkit/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// runDirectorySync is the directory-sync job. With LDAP_SYNC_DRY_RUN set it
+// only reports what it would change.
+func runDirectorySync(ctx context.Context) (string, error) {
+	entries, err := directory.Search(directory.FromEnv())
+	if err != nil {
+		return "", err
+	}
+	report, err := syncDirectory(ctx, entries, config.GetBool("LDAP_SYNC_DRY_RUN", false))
+	if err != nil {
+		return "", err
+	}
+	return directorySyncSummary(report), nil
+}
+
+// directorySyncSummary describes a sync report in one line
+func directorySyncSummary(report *models.DirectorySyncReport) string {
+	summary := fmt.Sprintf("%d entries: %d created, %d updated, %d reactivated, %d deactivated, %d skipped, %d unchanged",
+		report.Entries, len(report.Created), len(report.Updated), len(report.Reactivated),
+		len(report.Deactivated), len(report.Skipped), report.Unchanged)
+	if report.DryRun {
+		summary = "dry run, " + summary
+	}
+	return summary
+}
+
+// AdminPreviewDirectorySync reports what a directory sync would change
+// without changing anything (admin only)
+func AdminPreviewDirectorySync(c *gin.Context) {
+	if !directory.Enabled() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Directory sync is not configured",
+		})
+		return
+	}
+
+	// Large directories take longer than a normal request
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	entries, err := directory.Search(directory.FromEnv())
+	if err != nil {
+		log.Printf("⚠️  Directory sync preview failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": "Failed to read the directory",
+		})
+		return
+	}
+
+	report, err := syncDirectory(ctx, entries, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to compare the directory with users",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"summary": directorySyncSummary(report),
+		"report":  report,
+	})
+}
+
+// syncDirectory brings users in line with the directory entries. The whole
+// plan is worked out before anything is written, so a dry run reports
+// exactly what a real run would do.
+func syncDirectory(ctx context.Context, entries []directory.Entry, dryRun bool) (*models.DirectorySyncReport, error) {
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{
+		"firstName": 1, "lastName": 1, "email": 1, "staffId": 1, "department": 1, "role": 1, "isActive": 1, "directory": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return syncDirectoryUsers(ctx, users, entries, dryRun)
+}
+
+// syncDirectoryUsers plans the sync against users and, unless dryRun is set,
+// writes it
+func syncDirectoryUsers(ctx context.Context, users []models.User, entries []directory.Entry, dryRun bool) (*models.DirectorySyncReport, error) {
+	now := time.Now()
+	plan := planDirectorySync(users, entries, models.CanonicalDepartment(os.Getenv("LDAP_DEFAULT_DEPARTMENT")), now)
+	plan.report.DryRun = dryRun
+	if !dryRun {
+		if err := plan.apply(ctx, now); err != nil {
+			return nil, err
+		}
+	}
+	plan.report.FinishedAt = time.Now()
+	return plan.report, nil
+}
+
+// directorySyncPlan is what a directory sync will write
+type directorySyncPlan struct {
+	report     *models.DirectorySyncReport
+	creates    []*models.User
+	writes     []mongo.WriteModel
+	deactivate []*models.User
+}
+
+// planDirectorySync works out how to bring users in line with the directory
+// entries. Entries match users by email, then by staff ID; unmatched entries
+// become new accounts. Users linked to the directory whose entry is missing
+// or disabled are deactivated. Accounts never seen in the directory, such as
+// local admin accounts, are left alone. Groups mapped by LDAP_ROLE_MAP set
+// the role; users in no mapped group keep theirs.
+func planDirectorySync(users []models.User, entries []directory.Entry, defaultDepartment string, now time.Time) *directorySyncPlan {
+	report := &models.DirectorySyncReport{
+		Entries:     len(entries),
+		Created:     []models.DirectorySyncChange{},
+		Updated:     []models.DirectorySyncChange{},
+		Reactivated: []models.DirectorySyncChange{},
+		Deactivated: []models.DirectorySyncChange{},
+		Skipped:     []models.DirectorySyncSkip{},
+		StartedAt:   now,
+	}
+
+	// Emails and staff IDs compare without case, as directories do
+	byEmail := map[string]*models.User{}
+	byStaffID := map[string]*models.User{}
+	for i := range users {
+		byEmail[strings.ToLower(users[i].Email)] = &users[i]
+		if users[i].StaffID != "" {
+			byStaffID[strings.ToLower(users[i].StaffID)] = &users[i]
+		}
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	var creates []*models.User
+	var writes []mongo.WriteModel
+	var deactivate []*models.User
+
+	for _, entry := range entries {
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, models.DirectorySyncSkip{DN: entry.DN, Email: entry.Email, Reason: reason})
+		}
+
+		var matchedByEmail, matchedByStaffID *models.User
+		if entry.Email != "" {
+			matchedByEmail = byEmail[strings.ToLower(entry.Email)]
+		}
+		if entry.StaffID != "" {
+			matchedByStaffID = byStaffID[strings.ToLower(entry.StaffID)]
+		}
+		user := matchedByEmail
+		if user == nil {
+			user = matchedByStaffID
+		}
+		if matchedByEmail != nil && matchedByStaffID != nil && matchedByEmail != matchedByStaffID {
+			skip(fmt.Sprintf("email belongs to %s but staff ID %s belongs to %s", matchedByEmail.Email, entry.StaffID, matchedByStaffID.Email))
+			continue
+		}
+		if user != nil && seen[user.ID] {
+			skip("another directory entry already matched " + user.Email)
+			continue
+		}
+
+		department := models.CanonicalDepartment(entry.Department)
+
+		if entry.Disabled {
+			// Disabled accounts are treated as missing from the directory
+			if user == nil {
+				skip("disabled in the directory")
+				continue
+			}
+			seen[user.ID] = true
+			if user.IsActive {
+				user.Directory = &models.DirectoryLink{DN: entry.DN}
+				deactivate = append(deactivate, user)
+			}
+			continue
+		}
+
+		if user == nil {
+			if entry.Email == "" {
+				skip("no email")
+				continue
+			}
+			if department == "" {
+				department = defaultDepartment
+			}
+			if department == "" {
+				skip(fmt.Sprintf("unknown department %q and no LDAP_DEFAULT_DEPARTMENT", entry.Department))
+				continue
+			}
+
+			role := entry.Role
+			if role == "" {
+				role = "employee"
+			}
+			newUser := &models.User{
+				ID:         primitive.NewObjectID(),
+				FirstName:  entry.FirstName,
+				LastName:   entry.LastName,
+				Email:      entry.Email,
+				StaffID:    entry.StaffID,
+				Department: department,
+				Role:       role,
+				LeaveBalance: models.LeaveBalance{
+					Total:     28,
+					Available: 28,
+					Used:      0,
+				},
+				IsActive:  true,
+				CreatedAt: now,
+				UpdatedAt: now,
+				Directory: &models.DirectoryLink{DN: entry.DN, SyncedAt: now},
+			}
+			if newUser.FirstName == "" {
+				newUser.FirstName = strings.SplitN(entry.Email, "@", 2)[0]
+			}
+			creates = append(creates, newUser)
+			report.Created = append(report.Created, models.DirectorySyncChange{
+				UserID: newUser.ID,
+				Email:  newUser.Email,
+				DN:     entry.DN,
+			})
+
+			// Later entries with the same email or staff ID are duplicates
+			byEmail[strings.ToLower(entry.Email)] = newUser
+			if entry.StaffID != "" {
+				byStaffID[strings.ToLower(entry.StaffID)] = newUser
+			}
+			seen[newUser.ID] = true
+			continue
+		}
+		seen[user.ID] = true
+
+		changes := map[string]models.DirectoryFieldDiff{}
+		set := bson.M{"directory": models.DirectoryLink{DN: entry.DN, SyncedAt: now}}
+		diff := func(field, current, next string) {
+			if next != "" && next != current {
+				changes[field] = models.DirectoryFieldDiff{From: current, To: next}
+				set[field] = next
+			}
+		}
+		diff("firstName", user.FirstName, entry.FirstName)
+		diff("lastName", user.LastName, entry.LastName)
+		diff("email", user.Email, entry.Email)
+		diff("department", user.Department, department)
+		diff("staffId", user.StaffID, entry.StaffID)
+		diff("role", user.Role, entry.Role)
+
+		// Only accounts the sync itself deactivated come back with their entry
+		reactivate := !user.IsActive && user.Directory != nil && user.Directory.Deactivated
+		if reactivate {
+			changes["isActive"] = models.DirectoryFieldDiff{From: "false", To: "true"}
+			set["isActive"] = true
+		}
+
+		change := models.DirectorySyncChange{UserID: user.ID, Email: user.Email, DN: entry.DN, Changes: changes}
+		switch {
+		case reactivate:
+			report.Reactivated = append(report.Reactivated, change)
+		case len(changes) > 0:
+			report.Updated = append(report.Updated, change)
+		default:
+			report.Unchanged++
+		}
+		if len(changes) > 0 {
+			set["updatedAt"] = now
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": user.ID}).
+			SetUpdate(bson.M{"$set": set}))
+	}
+
+	// Linked users whose entry has gone
+	for i := range users {
+		user := &users[i]
+		if user.Directory != nil && user.IsActive && !seen[user.ID] {
+			deactivate = append(deactivate, user)
+		}
+	}
+	for _, user := range deactivate {
+		report.Deactivated = append(report.Deactivated, models.DirectorySyncChange{UserID: user.ID, Email: user.Email, DN: user.Directory.DN})
+	}
+
+	return &directorySyncPlan{report: report, creates: creates, writes: writes, deactivate: deactivate}
+}
+
+// apply writes the plan
+func (p *directorySyncPlan) apply(ctx context.Context, now time.Time) error {
+	// A wrong base DN or filter makes everyone look missing
+	if limit := config.GetInt64("LDAP_MAX_DEACTIVATIONS", 25); int64(len(p.deactivate)) > limit {
+		return fmt.Errorf("sync would deactivate %d users, more than LDAP_MAX_DEACTIVATIONS (%d); check the preview and raise the limit if this is expected", len(p.deactivate), limit)
+	}
+
+	for _, user := range p.creates {
+		if err := createDirectoryUser(ctx, user); err != nil {
+			return err
+		}
+	}
+	if len(p.writes) > 0 {
+		if _, err := config.UsersCollection.BulkWrite(ctx, p.writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+	for _, user := range p.deactivate {
+		if err := deactivateDirectoryUser(ctx, user, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDirectoryUser inserts a user found in the directory. Like accounts
+// provisioned by single sign-on it gets an unusable random password.
+func createDirectoryUser(ctx context.Context, user *models.User) error {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+	if user.Password, err = utils.HashPassword(password); err != nil {
+		return err
+	}
+	if user.StaffID == "" {
+		if user.StaffID, err = utils.GenerateStaffID(ctx); err != nil {
+			return err
+		}
+	}
+	if _, err := config.UsersCollection.InsertOne(ctx, user); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, models.AuditLog{
+		Action:  models.AuditUserProvisioned,
+		Target:  user.ID,
+		Details: map[string]interface{}{"source": "ldap", "email": user.Email, "dn": user.Directory.DN, "department": user.Department, "role": user.Role},
+	})
+	return nil
+}
+
+// deactivateDirectoryUser deactivates a user whose directory entry is gone
+// or disabled and signs them out
+func deactivateDirectoryUser(ctx context.Context, user *models.User, now time.Time) error {
+	_, err := config.UsersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"isActive":  false,
+		"directory": models.DirectoryLink{DN: user.Directory.DN, SyncedAt: now, Deactivated: true},
+		"updatedAt": now,
+	}})
+	if err != nil {
+		return err
+	}
+
+	if _, err := middleware.RevokeUserSessions(ctx, user.ID, primitive.NilObjectID, "removed from directory"); err != nil {
+		log.Printf("⚠️  Failed to revoke sessions of %s: %v", user.Email, err)
+	}
+	audit.Record(ctx, models.AuditLog{
+		Action:  models.AuditUserDeprovisioned,
+		Target:  user.ID,
+		Details: map[string]interface{}{"source": "ldap", "email": user.Email},
+	})
+	return nil
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/directory"
+	"github.com/flowkit/backend/directory/ldaptest"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// changedEmails returns the emails of changes, sorted
+func changedEmails(changes []models.DirectorySyncChange) []string {
+	emails := []string{}
+	for _, change := range changes {
+		emails = append(emails, change.Email)
+	}
+	sort.Strings(emails)
+	return emails
+}
+
+// findChange returns the change for email
+func findChange(t *testing.T, changes []models.DirectorySyncChange, email string) models.DirectorySyncChange {
+	t.Helper()
+	for _, change := range changes {
+		if change.Email == email {
+			return change
+		}
+	}
+	t.Fatalf("no change for %s", email)
+	return models.DirectorySyncChange{}
+}
+
+// findUser reads the user with id
+func findUser(t *testing.T, id primitive.ObjectID) models.User {
+	t.Helper()
+	var user models.User
+	if err := config.UsersCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&user); err != nil {
+		t.Fatalf("reading user %s: %v", id.Hex(), err)
+	}
+	return user
+}
+
+func TestDirectorySync(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const bindDN, bindPassword = "cn=sync,dc=flowkit,dc=local", "secret"
+	server := ldaptest.NewServer(t, bindDN, bindPassword, []ldaptest.Entry{
+		ldaptest.Person("Renamed", "Renamed", "Last", "RENAMED@flowkit.com", "noc", "FK-1", "512"),
+		ldaptest.Person("New Email", "First", "Last", "new.email@flowkit.com", "VAS", "FK-2", "512"),
+		ldaptest.Person("Same", "First", "Last", "same@flowkit.com", "NOC", "FK-3", "512"),
+		ldaptest.Person("Disabled", "First", "Last", "disabled@flowkit.com", "NOC", "FK-5", "514"),
+		ldaptest.Person("Returning", "First", "Last", "returning@flowkit.com", "NOC", "FK-6", "512"),
+		ldaptest.Person("Left", "First", "Last", "left.by.hand@flowkit.com", "NOC", "FK-8", "512"),
+		ldaptest.Person("Promoted", "First", "Last", "promoted@flowkit.com", "NOC", "FK-9", "512", "Staff", "HR-Team"),
+		ldaptest.Person("Keeps", "First", "Last", "keeps.role@flowkit.com", "NOC", "FK-10", "512", "Staff"),
+		ldaptest.Person("Nana Asante", "Nana", "Asante", "nana@flowkit.com", "Accounts", "FK-20", "512", "HR-Team"),
+		ldaptest.Person("Kojo", "", "", "kojo@flowkit.com", "Research", "", "512"),
+		ldaptest.Person("Conflict", "", "", "same@flowkit.com", "NOC", "FK-1", "512"),
+		ldaptest.Person("Duplicate", "", "", "nana@flowkit.com", "NOC", "", "512"),
+		ldaptest.Person("Disabled New", "", "", "never@flowkit.com", "NOC", "", "514"),
+		{DN: "cn=Printer,ou=devices,dc=flowkit,dc=local", Attributes: map[string][]string{"objectClass": {"device"}, "cn": {"Printer"}}},
+	})
+	t.Setenv("LDAP_URL", server.URL)
+	t.Setenv("LDAP_BASE_DN", "ou=people,dc=flowkit,dc=local")
+	t.Setenv("LDAP_BIND_DN", bindDN)
+	t.Setenv("LDAP_BIND_PASSWORD", bindPassword)
+	t.Setenv("LDAP_ROLE_MAP", "HR-Team=hr")
+	t.Setenv("LDAP_PAGE_SIZE", "3")
+	t.Setenv("LDAP_DEFAULT_DEPARTMENT", "admin")
+
+	dn := func(cn string) string { return "cn=" + cn + ",ou=people,dc=flowkit,dc=local" }
+	linked := &models.DirectoryLink{DN: dn("Old")}
+	users := []models.User{
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "renamed@flowkit.com", StaffID: "FK-1", Department: "NOC", Role: "employee", IsActive: true, Directory: linked},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "old.email@flowkit.com", StaffID: "FK-2", Department: "VAS", Role: "employee", IsActive: true, Directory: linked},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "same@flowkit.com", StaffID: "FK-3", Department: "NOC", Role: "employee", IsActive: true, Directory: linked},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "gone@flowkit.com", StaffID: "FK-4", Department: "NOC", Role: "employee", IsActive: true, Directory: &models.DirectoryLink{DN: dn("Gone")}},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "disabled@flowkit.com", StaffID: "FK-5", Department: "NOC", Role: "employee", IsActive: true, Directory: linked},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "returning@flowkit.com", StaffID: "FK-6", Department: "NOC", Role: "employee", Directory: &models.DirectoryLink{DN: dn("Returning"), Deactivated: true}},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "local.admin@flowkit.com", StaffID: "FK-7", Department: "ADMIN", Role: "admin", IsActive: true},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "left.by.hand@flowkit.com", StaffID: "FK-8", Department: "NOC", Role: "employee", Directory: linked},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "promoted@flowkit.com", StaffID: "FK-9", Department: "NOC", Role: "employee", IsActive: true, Directory: linked},
+		{ID: primitive.NewObjectID(), FirstName: "First", LastName: "Last", Email: "keeps.role@flowkit.com", StaffID: "FK-10", Department: "NOC", Role: "hr", IsActive: true, Directory: linked},
+	}
+	userIDs := map[string]primitive.ObjectID{}
+	for _, user := range users {
+		userIDs[user.Email] = user.ID
+	}
+
+	t.Run("plan", func(t *testing.T) {
+		entries, err := directory.Search(directory.FromEnv())
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if pages := server.Pages(); pages != 5 {
+			t.Errorf("pages = %d, want 5 of LDAP_PAGE_SIZE", pages)
+		}
+
+		// The sync plans against its own copy of the users
+		plan := planDirectorySync(append([]models.User(nil), users...), entries, "ADMIN", time.Now())
+		report := plan.report
+
+		if report.Entries != 13 {
+			t.Errorf("Entries = %d, want the 13 people", report.Entries)
+		}
+
+		// Created, with the role from their groups or employee
+		if got, want := changedEmails(report.Created), []string{"kojo@flowkit.com", "nana@flowkit.com"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Created = %v, want %v", got, want)
+		}
+		created := map[string]*models.User{}
+		for _, user := range plan.creates {
+			created[user.Email] = user
+		}
+		if nana := created["nana@flowkit.com"]; nana.Role != "hr" || nana.Department != "ACCOUNTS" || nana.StaffID != "FK-20" || nana.Directory.DN != dn("Nana Asante") {
+			t.Errorf("nana = %+v", nana)
+		}
+		if kojo := created["kojo@flowkit.com"]; kojo.Role != "employee" || kojo.Department != "ADMIN" || kojo.FirstName != "kojo" || !kojo.IsActive {
+			t.Errorf("kojo = %+v, want an employee in the default department named from their email", kojo)
+		}
+
+		// Updated, with the fields that differ
+		if got, want := changedEmails(report.Updated), []string{"old.email@flowkit.com", "promoted@flowkit.com", "renamed@flowkit.com"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Updated = %v, want %v", got, want)
+		}
+		for email, want := range map[string]map[string]models.DirectoryFieldDiff{
+			"renamed@flowkit.com": {
+				"firstName": {From: "First", To: "Renamed"},
+				"email":     {From: "renamed@flowkit.com", To: "RENAMED@flowkit.com"},
+			},
+			"old.email@flowkit.com": {
+				"email": {From: "old.email@flowkit.com", To: "new.email@flowkit.com"},
+			},
+			"promoted@flowkit.com": {
+				"role": {From: "employee", To: "hr"},
+			},
+		} {
+			if got := findChange(t, report.Updated, email).Changes; !reflect.DeepEqual(got, want) {
+				t.Errorf("changes for %s = %v, want %v", email, got, want)
+			}
+		}
+
+		// Only users the sync itself deactivated come back
+		if got, want := changedEmails(report.Reactivated), []string{"returning@flowkit.com"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Reactivated = %v, want %v", got, want)
+		}
+
+		// Linked users whose entry is gone or disabled; local accounts stay
+		if got, want := changedEmails(report.Deactivated), []string{"disabled@flowkit.com", "gone@flowkit.com"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Deactivated = %v, want %v", got, want)
+		}
+		if got := findChange(t, report.Deactivated, "gone@flowkit.com").DN; got != dn("Gone") {
+			t.Errorf("gone DN = %q, want the DN it was linked to", got)
+		}
+
+		skipped := map[string]string{}
+		for _, skip := range report.Skipped {
+			skipped[skip.DN] = skip.Reason
+		}
+		for cn, reason := range map[string]string{
+			"Conflict":     "email belongs to same@flowkit.com",
+			"Duplicate":    "another directory entry already matched",
+			"Disabled New": "disabled in the directory",
+		} {
+			if !strings.HasPrefix(skipped[dn(cn)], reason) {
+				t.Errorf("%s skipped with %q, want %q", cn, skipped[dn(cn)], reason)
+			}
+		}
+		if len(report.Skipped) != 3 {
+			t.Errorf("Skipped = %+v, want 3 entries", report.Skipped)
+		}
+
+		// same, left.by.hand and keeps.role match without changes; a user without
+		// a mapped group keeps their role
+		if report.Unchanged != 3 {
+			t.Errorf("Unchanged = %d, want 3", report.Unchanged)
+		}
+
+		// Every matched, enabled entry is written to record the sync
+		if len(plan.writes) != 7 {
+			t.Fatalf("writes = %d, want 7", len(plan.writes))
+		}
+		for _, write := range plan.writes {
+			model := write.(*mongo.UpdateOneModel)
+			set := model.Update.(bson.M)["$set"].(bson.M)
+			if _, ok := set["directory"]; !ok {
+				t.Errorf("write %v does not record the directory link", model.Filter)
+			}
+			if role, ok := set["role"]; ok && role != "hr" {
+				t.Errorf("write %v sets role %v", model.Filter, role)
+			}
+		}
+	})
+
+	t.Run("unknown department without a default", func(t *testing.T) {
+		plan := planDirectorySync(nil, []directory.Entry{
+			{DN: dn("New"), Email: "new@flowkit.com", Department: "Research"},
+		}, "", time.Now())
+
+		if len(plan.creates) != 0 || len(plan.report.Skipped) != 1 {
+			t.Fatalf("creates = %d, skipped = %+v, want the entry skipped", len(plan.creates), plan.report.Skipped)
+		}
+	})
+
+	t.Run("database", func(t *testing.T) {
+		useTestDatabase(t)
+		ctx := context.Background()
+		for _, user := range users {
+			user.CreatedAt, user.UpdatedAt = time.Now(), time.Now()
+			if _, err := config.UsersCollection.InsertOne(ctx, user); err != nil {
+				t.Fatalf("inserting %s: %v", user.Email, err)
+			}
+		}
+		before := collectionDocuments(t, config.UsersCollection)
+
+		t.Run("stops before mass deactivation", func(t *testing.T) {
+			// Two users would be deactivated, so nothing may be written
+			t.Setenv("LDAP_MAX_DEACTIVATIONS", "1")
+			if _, err := runDirectorySync(ctx); err == nil {
+				t.Fatal("sync over the deactivation limit did not stop")
+			}
+			if after := collectionDocuments(t, config.UsersCollection); !reflect.DeepEqual(after, before) {
+				t.Error("users changed")
+			}
+		})
+
+		t.Run("preview", func(t *testing.T) {
+			router := gin.New()
+			router.GET("/api/admin/directory/preview", AdminPreviewDirectorySync)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/directory/preview", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var body struct {
+				Report models.DirectorySyncReport `json:"report"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %s: %v", w.Body, err)
+			}
+			report := body.Report
+			if !report.DryRun || len(report.Created) != 2 || len(report.Updated) != 3 || len(report.Reactivated) != 1 || len(report.Deactivated) != 2 {
+				t.Errorf("report = %s, want the same preview as a real run", directorySyncSummary(&report))
+			}
+
+			if after := collectionDocuments(t, config.UsersCollection); !reflect.DeepEqual(after, before) {
+				t.Error("the preview changed users")
+			}
+			if logs := collectionDocuments(t, config.AuditLogsCollection); len(logs) != 0 {
+				t.Errorf("the preview recorded %d audit logs", len(logs))
+			}
+		})
+
+		t.Run("sync", func(t *testing.T) {
+			summary, err := runDirectorySync(ctx)
+			if err != nil {
+				t.Fatalf("runDirectorySync: %v", err)
+			}
+			if want := "13 entries: 2 created, 3 updated, 1 reactivated, 2 deactivated, 3 skipped, 3 unchanged"; summary != want {
+				t.Errorf("summary = %q, want %q", summary, want)
+			}
+
+			var nana models.User
+			if err := config.UsersCollection.FindOne(ctx, bson.M{"email": "nana@flowkit.com"}).Decode(&nana); err != nil {
+				t.Fatalf("nana was not created: %v", err)
+			}
+			if nana.Role != "hr" || nana.Department != "ACCOUNTS" || !nana.IsActive || nana.Directory == nil || nana.Password == "" {
+				t.Errorf("nana = %+v", nana)
+			}
+			var kojo models.User
+			if err := config.UsersCollection.FindOne(ctx, bson.M{"email": "kojo@flowkit.com"}).Decode(&kojo); err != nil {
+				t.Fatalf("kojo was not created: %v", err)
+			}
+			if kojo.StaffID == "" {
+				t.Error("kojo was not given a staff ID")
+			}
+
+			if renamed := findUser(t, userIDs["renamed@flowkit.com"]); renamed.FirstName != "Renamed" || renamed.Email != "RENAMED@flowkit.com" {
+				t.Errorf("renamed = %s %s", renamed.FirstName, renamed.Email)
+			}
+			if moved := findUser(t, userIDs["old.email@flowkit.com"]); moved.Email != "new.email@flowkit.com" {
+				t.Errorf("email = %s, want the directory's", moved.Email)
+			}
+			if promoted := findUser(t, userIDs["promoted@flowkit.com"]); promoted.Role != "hr" {
+				t.Errorf("promoted role = %s, want hr", promoted.Role)
+			}
+			if keeps := findUser(t, userIDs["keeps.role@flowkit.com"]); keeps.Role != "hr" {
+				t.Errorf("keeps.role role = %s, want hr", keeps.Role)
+			}
+			for _, email := range []string{"gone@flowkit.com", "disabled@flowkit.com"} {
+				if user := findUser(t, userIDs[email]); user.IsActive || user.Directory == nil || !user.Directory.Deactivated {
+					t.Errorf("%s is active = %v, link %+v, want deactivated by the sync", email, user.IsActive, user.Directory)
+				}
+			}
+			if returning := findUser(t, userIDs["returning@flowkit.com"]); !returning.IsActive {
+				t.Error("returning was not reactivated")
+			}
+			if left := findUser(t, userIDs["left.by.hand@flowkit.com"]); left.IsActive {
+				t.Error("a user deactivated by hand was reactivated")
+			}
+			if admin := findUser(t, userIDs["local.admin@flowkit.com"]); !admin.IsActive || admin.Directory != nil {
+				t.Errorf("local admin = %+v, want it left alone", admin)
+			}
+
+			actions := map[string]int{}
+			for _, entry := range collectionDocuments(t, config.AuditLogsCollection) {
+				actions[entry["action"].(string)]++
+			}
+			if actions[models.AuditUserProvisioned] != 2 || actions[models.AuditUserDeprovisioned] != 2 {
+				t.Errorf("audit logs = %v, want 2 provisioned and 2 deprovisioned", actions)
+			}
+		})
+
+		t.Run("rerun", func(t *testing.T) {
+			summary, err := runDirectorySync(ctx)
+			if err != nil {
+				t.Fatalf("runDirectorySync: %v", err)
+			}
+			if want := "13 entries: 0 created, 0 updated, 0 reactivated, 0 deactivated, 3 skipped, 9 unchanged"; summary != want {
+				t.Errorf("summary = %q, want %q", summary, want)
+			}
+		})
+	})
+}
@@ -0,0 +1,831 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InitExtensions creates the index that allows one pending extension per leave
+func InitExtensions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.ExtensionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "leave", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": "Pending"}),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create extension indexes: %v", err)
+	}
+}
+
+// Default approval path for extending active leave
+var defaultExtensionPath = []string{"HOD"}
+
+// ErrLeaveNotExtendable means the leave was cancelled, rejected or recalled
+// while an extension was pending
+var ErrLeaveNotExtendable = errors.New("Leave is no longer approved and cannot be extended")
+
+// extendableLeaveStatuses are the leave statuses an extension can still be
+// applied to; leave may have run out (Over) while the extension was pending
+var extendableLeaveStatuses = []string{"Approved", "Active", "Over"}
+
+// isExtendable reports whether an extension can still be applied to leave
+func isExtendable(leave *models.Leave) bool {
+	if leave.Recall != nil {
+		return false
+	}
+	for _, status := range extendableLeaveStatuses {
+		if leave.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestLeaveExtension files a request to extend an active leave
+func RequestLeaveExtension(c *gin.Context) {
+	idParam := c.Param("id")
+	leaveID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return
+	}
+
+	var req models.CreateExtensionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "New end date and reason are required",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	newToDate, err := time.Parse("2006-01-02", req.NewToDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid new end date format. Use YYYY-MM-DD",
+		})
+		return
+	}
+
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get leave
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+
+	// Only the employee on leave can ask for more days
+	if leave.Employee != userID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Not authorized to extend this leave request",
+		})
+		return
+	}
+
+	updateLeaveStatus(&leave)
+	if leave.Status != "Active" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Only active leave can be extended",
+		})
+		return
+	}
+	if leave.Recall != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Recalled leave cannot be extended",
+		})
+		return
+	}
+
+	if !newToDate.After(leave.ToDate) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "New end date must be after the current end date",
+		})
+		return
+	}
+
+	// Only the extra days are checked against the balance
+	extraDays := models.CalculateDays(leave.ToDate.Add(24*time.Hour), newToDate)
+	if extraDays == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Extension does not add any working days",
+		})
+		return
+	}
+
+	// Only one extension can be in flight per leave
+	count, err := config.ExtensionsCollection.CountDocuments(ctx, bson.M{
+		"leave":  leave.ID,
+		"status": "Pending",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to check existing extension requests",
+		})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "An extension request for this leave is already pending",
+		})
+		return
+	}
+
+	var employee models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&employee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch user",
+		})
+		return
+	}
+
+	now := time.Now()
+	extension := models.ExtensionRequest{
+		ID:        primitive.NewObjectID(),
+		Leave:     leave.ID,
+		Employee:  userID,
+		NewToDate: newToDate,
+		ExtraDays: extraDays,
+		Reason:    req.Reason,
+		Status:    "Pending",
+		RequestWorkflow: models.RequestWorkflow{
+			Path:      buildRequestPath(ctx, config.GetApprovalPath("EXTENSION_APPROVAL_PATH", defaultExtensionPath), &employee, &leave),
+			Approvals: []models.ApprovalStep{},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// Deduct the extra days now, as CreateLeave does, and save the request,
+	// extending straight away when no reviewers are configured, all together.
+	// The days are refunded if the extension is refused.
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := deductLeaveDays(ctx, userID, extraDays); err != nil {
+			return err
+		}
+
+		if _, err := config.ExtensionsCollection.InsertOne(ctx, extension); err != nil {
+			// Rollback: return the days if the request could not be saved
+			refundLeaveDays(ctx, userID, extraDays)
+			return err
+		}
+
+		if len(extension.Path) == 0 {
+			return applyExtension(ctx, &extension, &leave, userID, 0)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrInsufficientBalance):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Insufficient leave balance for the extra days",
+		})
+		return
+	case mongo.IsDuplicateKeyError(err):
+		// Another request for this leave was filed at the same moment
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "An extension request for this leave is already pending",
+		})
+		return
+	case errors.Is(err, ErrLeaveNotExtendable):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": ErrLeaveNotExtendable.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to create extension request",
+		})
+		return
+	}
+
+	// No reviewers configured: extended straight away
+	if len(extension.Path) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"message":   "Leave extended successfully",
+			"extension": extension,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":   true,
+		"message":   "Extension request submitted for approval",
+		"extension": extension,
+	})
+}
+
+// GetLeaveExtensions lists extension requests filed against a leave
+func GetLeaveExtensions(c *gin.Context) {
+	idParam := c.Param("id")
+	leaveID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+
+	// Employees only see their own; approvers see their departments'
+	if leave.Employee != user.ID && !isLeaveApprover(ctx, &leave, user) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Not authorized to view this leave request",
+		})
+		return
+	}
+
+	cursor, err := config.ExtensionsCollection.Find(
+		ctx,
+		bson.M{"leave": leaveID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch extension requests",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	extensions := []models.ExtensionRequest{}
+	if err := cursor.All(ctx, &extensions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode extension requests",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"count":      len(extensions),
+		"extensions": extensions,
+	})
+}
+
+// GetPendingExtensions lists extension requests awaiting the current approver
+func GetPendingExtensions(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := config.ExtensionsCollection.Find(
+		ctx,
+		bson.M{"status": "Pending"},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch extension requests",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var extensions []models.ExtensionRequest
+	if err := cursor.All(ctx, &extensions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode extension requests",
+		})
+		return
+	}
+
+	// Keep only requests this user may decide on at their current stage
+	responses := []gin.H{}
+	for _, extension := range extensions {
+		var leave models.Leave
+		if err := config.LeavesCollection.FindOne(ctx, bson.M{"_id": extension.Leave}).Decode(&leave); err != nil {
+			continue
+		}
+
+		stage := extension.CurrentStage()
+		if checkStageAuthority(ctx, &leave, user, stage) != nil {
+			continue
+		}
+		if checkRequestSeparationOfDuties(&leave, &extension.RequestWorkflow, stage, user.ID) != nil {
+			continue
+		}
+
+		var employee models.User
+		config.UsersCollection.FindOne(ctx, bson.M{"_id": extension.Employee}).Decode(&employee)
+
+		responses = append(responses, gin.H{
+			"id": extension.ID,
+			"employee": gin.H{
+				"id":         employee.ID,
+				"firstName":  employee.FirstName,
+				"lastName":   employee.LastName,
+				"department": employee.Department,
+			},
+			"leave": gin.H{
+				"id":        leave.ID,
+				"leaveType": leave.LeaveType,
+				"fromDate":  leave.FromDate,
+				"toDate":    leave.ToDate,
+				"totalDays": leave.TotalDays,
+				"status":    leave.Status,
+			},
+			"newToDate": extension.NewToDate,
+			"extraDays": extension.ExtraDays,
+			"reason":    extension.Reason,
+			"stage":     stage,
+			"approvals": extension.Approvals,
+			"createdAt": extension.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"count":      len(responses),
+		"extensions": responses,
+	})
+}
+
+// ApproveExtension approves an extension request at its current stage
+func ApproveExtension(c *gin.Context) {
+	decideExtension(c, true)
+}
+
+// RejectExtension rejects an extension request and refunds the extra days
+func RejectExtension(c *gin.Context) {
+	decideExtension(c, false)
+}
+
+// decideExtension records an approver's decision on an extension request
+func decideExtension(c *gin.Context, approve bool) {
+	idParam := c.Param("id")
+	extensionID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid extension request ID",
+		})
+		return
+	}
+
+	var req models.ApproveRejectRequest
+	c.ShouldBindJSON(&req)
+	if !approve && req.Comments == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Please provide reason for rejection",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var extension models.ExtensionRequest
+	err = config.ExtensionsCollection.FindOne(ctx, bson.M{"_id": extensionID}).Decode(&extension)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Extension request not found",
+		})
+		return
+	}
+
+	if extension.Status != "Pending" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Extension request has already been " + extension.Status,
+		})
+		return
+	}
+
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": extension.Leave}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+
+	if approve && leave.Recall != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Leave has been recalled and can no longer be extended",
+		})
+		return
+	}
+	if approve && !isExtendable(&leave) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": ErrLeaveNotExtendable.Error(),
+		})
+		return
+	}
+
+	stage := extension.CurrentStage()
+	if err := checkStageAuthority(ctx, &leave, user, stage); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkRequestSeparationOfDuties(&leave, &extension.RequestWorkflow, stage, user.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	previousStep := extension.CurrentStep
+	status := "Approved"
+	if !approve {
+		status = "Rejected"
+	}
+	extension.Approvals = append(extension.Approvals, models.ApprovalStep{
+		Approver: user.ID,
+		Role:     stage,
+		Status:   status,
+		Comments: req.Comments,
+		Date:     now,
+	})
+
+	if !approve {
+		// Reject the request and refund the extra days deducted when it was filed, together
+		err = config.WithTransaction(ctx, func(ctx context.Context) error {
+			result, err := config.ExtensionsCollection.UpdateOne(
+				ctx,
+				bson.M{"_id": extensionID, "status": "Pending", "currentStep": previousStep},
+				bson.M{"$set": bson.M{
+					"approvals": extension.Approvals,
+					"status":    "Rejected",
+					"decidedAt": now,
+					"updatedAt": now,
+				}},
+			)
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return ErrRequestChanged
+			}
+			return refundLeaveDays(ctx, extension.Employee, extension.ExtraDays)
+		})
+		if errors.Is(err, ErrRequestChanged) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Extension request was updated by someone else, please reload",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to reject extension request",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Extension request rejected by " + stage + " and extra days refunded",
+		})
+		return
+	}
+
+	extension.CurrentStep++
+
+	// More stages to go
+	if extension.CurrentStage() != "" {
+		// Guard against a concurrent decision on the same step
+		result, err := config.ExtensionsCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": extensionID, "status": "Pending", "currentStep": previousStep},
+			bson.M{"$set": bson.M{
+				"approvals":   extension.Approvals,
+				"currentStep": extension.CurrentStep,
+				"updatedAt":   now,
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to update extension request",
+			})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Extension request was updated by someone else, please reload",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"message":   "Extension request approved by " + stage,
+			"nextStage": extension.CurrentStage(),
+		})
+		return
+	}
+
+	// The final approval and the extension are applied together, so a failure
+	// leaves the request pending at this stage
+	if err := approveExtension(ctx, &extension, &leave, user.ID, previousStep); err != nil {
+		switch {
+		case errors.Is(err, ErrRequestChanged):
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "Extension request was updated by someone else, please reload",
+			})
+		case errors.Is(err, ErrLeaveNotExtendable):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to apply extension",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   "Extension request approved by " + stage + " - leave extended",
+		"newToDate": extension.NewToDate,
+	})
+}
+
+// WithdrawExtension lets the employee withdraw a pending extension request
+func WithdrawExtension(c *gin.Context) {
+	idParam := c.Param("id")
+	extensionID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid extension request ID",
+		})
+		return
+	}
+
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Withdraw the request and refund the extra days together
+	now := time.Now()
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		var extension models.ExtensionRequest
+		err := config.ExtensionsCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": extensionID, "employee": userID, "status": "Pending"},
+			bson.M{"$set": bson.M{
+				"status":    "Withdrawn",
+				"decidedAt": now,
+				"updatedAt": now,
+			}},
+		).Decode(&extension)
+		if err != nil {
+			return err
+		}
+		return refundLeaveDays(ctx, userID, extension.ExtraDays)
+	})
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No pending extension request found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to withdraw extension request",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Extension request withdrawn and extra days refunded",
+	})
+}
+
+// approveExtension marks an extension approved at its final step and moves the
+// original leave's end date, keeping a record of the change in the leave
+// history. previousStep is the step the request was at when it was loaded.
+func approveExtension(ctx context.Context, extension *models.ExtensionRequest, leave *models.Leave, actor primitive.ObjectID, previousStep int) error {
+	// Approve the extension, move the leave's end date and announce it together
+	return config.WithTransaction(ctx, func(ctx context.Context) error {
+		return applyExtension(ctx, extension, leave, actor, previousStep)
+	})
+}
+
+// applyExtension does the work of approveExtension. Call it inside a
+// transaction.
+func applyExtension(ctx context.Context, extension *models.ExtensionRequest, leave *models.Leave, actor primitive.ObjectID, previousStep int) error {
+	now := time.Now()
+	result, err := config.ExtensionsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": extension.ID, "status": "Pending", "currentStep": previousStep},
+		bson.M{"$set": bson.M{
+			"approvals":   extension.Approvals,
+			"currentStep": extension.CurrentStep,
+			"status":      "Approved",
+			"decidedAt":   now,
+			"updatedAt":   now,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRequestChanged
+	}
+
+	// The leave may have run out while the extension was pending
+	status := "Active"
+	isActive := true
+	if now.After(extension.NewToDate) {
+		status = "Over"
+		isActive = false
+	}
+
+	// The leave may have been cancelled, rejected or recalled meanwhile
+	result, err = config.LeavesCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"_id":    leave.ID,
+			"status": bson.M{"$in": extendableLeaveStatuses},
+			"recall": bson.M{"$exists": false},
+		},
+		bson.M{
+			"$set": bson.M{
+				"toDate":    extension.NewToDate,
+				"status":    status,
+				"isActive":  isActive,
+				"updatedAt": now,
+			},
+			"$inc": bson.M{"totalDays": extension.ExtraDays},
+			"$push": bson.M{
+				"history": models.LeaveHistoryEntry{
+					Action:   "extended",
+					Actor:    actor,
+					Comments: extension.Reason,
+					Changes: map[string]interface{}{
+						"toDate":    bson.M{"from": leave.ToDate, "to": extension.NewToDate},
+						"totalDays": bson.M{"from": leave.TotalDays, "to": leave.TotalDays + extension.ExtraDays},
+					},
+					Date: now,
+				},
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaveNotExtendable
+	}
+
+	return publishLeaveExtended(ctx, leave, extension, actor)
+}
+
+// rejectPendingExtension rejects the extension still pending on a leave that
+// is being cancelled or cut short and refunds its extra days. Call it inside
+// the transaction that changes the leave.
+func rejectPendingExtension(ctx context.Context, leave *models.Leave, actor primitive.ObjectID) error {
+	now := time.Now()
+	var extension models.ExtensionRequest
+	err := config.ExtensionsCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"leave": leave.ID, "status": "Pending"},
+		bson.M{
+			"$set": bson.M{
+				"status":    "Rejected",
+				"decidedAt": now,
+				"updatedAt": now,
+			},
+			"$push": bson.M{"approvals": models.ApprovalStep{
+				Approver: actor,
+				Status:   "Rejected",
+				Comments: "Leave was cancelled or cut short",
+				Date:     now,
+			}},
+		},
+	).Decode(&extension)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return refundLeaveDays(ctx, extension.Employee, extension.ExtraDays)
+}
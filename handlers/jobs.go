@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/directory"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/scheduler"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RegisterJobs adds the leave management jobs to the scheduler
+func RegisterJobs() {
+	scheduler.Register(scheduler.Job{
+		Name:        "leave-status",
+		Description: "Moves approved leave to Active on its first day and to Over after its last",
+		Interval:    15 * time.Minute,
+		Run:         runLeaveStatusTransitions,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:        "leave-accrual",
+		Description: "Credits LEAVE_ACCRUAL_DAYS_PER_MONTH to every active user once a month",
+		Interval:    6 * time.Hour,
+		Run:         runLeaveAccrual,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:        "approval-reminders",
+		Description: "Reminds approvers of leave waiting on them longer than LEAVE_REMINDER_AFTER_HOURS",
+		Interval:    time.Hour,
+		Run:         runApprovalReminders,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:        "approval-escalation",
+		Description: "Escalates leave stuck at a stage longer than LEAVE_ESCALATION_AFTER_HOURS",
+		Interval:    time.Hour,
+		Run:         runApprovalEscalation,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:        "daily-digests",
+		Description: "Sends each user their daily digest and day-before leave reminder at their preferred local time",
+		Interval:    15 * time.Minute,
+		Run:         runDailyDigests,
+	})
+	if directory.Enabled() {
+		scheduler.Register(scheduler.Job{
+			Name:        "directory-sync",
+			Description: "Creates, updates and deactivates users to match the LDAP directory",
+			Interval:    time.Duration(config.GetInt64("LDAP_SYNC_INTERVAL_MINUTES", 60)) * time.Minute,
+			Run:         runDirectorySync,
+		})
+	}
+}
+
+// runLeaveStatusTransitions starts and ends approved leave by date, using the
+// same day boundaries as leave recorded by HR
+func runLeaveStatusTransitions(ctx context.Context) (string, error) {
+	now := time.Now()
+	today := now.Truncate(24 * time.Hour)
+
+	ended, err := config.LeavesCollection.UpdateMany(
+		ctx,
+		bson.M{
+			"status": bson.M{"$in": []string{"Approved", "Active"}},
+			"toDate": bson.M{"$lt": today},
+		},
+		bson.M{"$set": bson.M{"status": "Over", "isActive": false, "updatedAt": now}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	started, err := config.LeavesCollection.UpdateMany(
+		ctx,
+		bson.M{
+			"status":   "Approved",
+			"fromDate": bson.M{"$lte": today},
+			"toDate":   bson.M{"$gte": today},
+		},
+		bson.M{"$set": bson.M{"status": "Active", "isActive": true, "updatedAt": now}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d leave started, %d ended", started.ModifiedCount, ended.ModifiedCount), nil
+}
+
+// runLeaveAccrual credits the monthly accrual to users who have not had it
+// for the current month, so running it again within a month is harmless
+func runLeaveAccrual(ctx context.Context) (string, error) {
+	days := config.GetInt64("LEAVE_ACCRUAL_DAYS_PER_MONTH", 0)
+	if days == 0 {
+		return "accrual disabled", nil
+	}
+
+	month := time.Now().Format("2006-01")
+	result, err := config.UsersCollection.UpdateMany(
+		ctx,
+		bson.M{"isActive": true, "leaveBalance.accruedThrough": bson.M{"$ne": month}},
+		bson.M{
+			"$inc": bson.M{
+				"leaveBalance.total":     days,
+				"leaveBalance.available": days,
+			},
+			"$set": bson.M{"leaveBalance.accruedThrough": month},
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("credited %d days to %d users for %s", days, result.ModifiedCount, month), nil
+}
+
+// stalledLeaves returns pending leave whose current stage has waited since
+// before cutoff. A stage starts waiting when the leave was last updated, as
+// every approval, return and resubmission touches updatedAt.
+func stalledLeaves(ctx context.Context, cutoff time.Time, extra bson.M) ([]models.Leave, error) {
+	filter := bson.M{"status": "Pending", "updatedAt": bson.M{"$lt": cutoff}}
+	for key, value := range extra {
+		filter[key] = value
+	}
+
+	cursor, err := config.LeavesCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var leaves []models.Leave
+	if err := cursor.All(ctx, &leaves); err != nil {
+		return nil, err
+	}
+	return leaves, nil
+}
+
+// runApprovalReminders nudges the approvers of every stage that has waited
+// too long, then again each time the same interval passes
+func runApprovalReminders(ctx context.Context) (string, error) {
+	after := time.Duration(config.GetInt64("LEAVE_REMINDER_AFTER_HOURS", 24)) * time.Hour
+	now := time.Now()
+	cutoff := now.Add(-after)
+
+	leaves, err := stalledLeaves(ctx, cutoff, bson.M{"$or": []bson.M{
+		{"reminderSentAt": bson.M{"$exists": false}},
+		{"reminderSentAt": bson.M{"$lt": cutoff}},
+	}})
+	if err != nil {
+		return "", err
+	}
+
+	sent := 0
+	for i := range leaves {
+		leave := &leaves[i]
+		stage := leave.PendingStage()
+		if stage == "" {
+			continue
+		}
+
+		err := config.WithTransaction(ctx, func(ctx context.Context) error {
+			if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leave.ID}, bson.M{"$set": bson.M{"reminderSentAt": now}}); err != nil {
+				return err
+			}
+			return publishLeaveEvent(ctx, events.ApprovalReminder, leave, primitive.NilObjectID, stageApprovers(ctx, leave, stage), map[string]interface{}{
+				"stage":        stage,
+				"pendingSince": leave.UpdatedAt,
+			})
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to send approval reminder for leave %s: %v", leave.ID.Hex(), err)
+			continue
+		}
+		sent++
+	}
+
+	return fmt.Sprintf("reminded approvers of %d leave requests", sent), nil
+}
+
+// escalationContacts returns who hears about a stage that has stalled: HR
+// and admins, or only admins when HR is the stage holding things up
+func escalationContacts(ctx context.Context, stage string) ([]primitive.ObjectID, error) {
+	roles := []string{"hr", "admin"}
+	if stage == "HR" {
+		roles = []string{"admin"}
+	}
+
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{"isActive": true, "role": bson.M{"$in": roles}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids, nil
+}
+
+// runApprovalEscalation escalates each stage that has waited too long, once
+// per stage, and notes it in the leave history
+func runApprovalEscalation(ctx context.Context) (string, error) {
+	after := time.Duration(config.GetInt64("LEAVE_ESCALATION_AFTER_HOURS", 72)) * time.Hour
+	now := time.Now()
+
+	leaves, err := stalledLeaves(ctx, now.Add(-after), bson.M{"$or": []bson.M{
+		{"escalatedAt": bson.M{"$exists": false}},
+		{"$expr": bson.M{"$lt": bson.A{"$escalatedAt", "$updatedAt"}}},
+	}})
+	if err != nil {
+		return "", err
+	}
+
+	escalated := 0
+	for i := range leaves {
+		leave := &leaves[i]
+		stage := leave.PendingStage()
+		if stage == "" {
+			continue
+		}
+
+		contacts, err := escalationContacts(ctx, stage)
+		if err != nil {
+			return "", err
+		}
+
+		err = config.WithTransaction(ctx, func(ctx context.Context) error {
+			_, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leave.ID}, bson.M{
+				"$set": bson.M{"escalatedAt": now},
+				"$push": bson.M{"history": models.LeaveHistoryEntry{
+					Action:   "escalated",
+					Stage:    stage,
+					Comments: fmt.Sprintf("No decision after %s", after),
+					Date:     now,
+				}},
+			})
+			if err != nil {
+				return err
+			}
+			recipients := append(contacts, stageApprovers(ctx, leave, stage)...)
+			return publishLeaveEvent(ctx, events.LeaveEscalated, leave, primitive.NilObjectID, recipients, map[string]interface{}{
+				"stage":        stage,
+				"pendingSince": leave.UpdatedAt,
+			})
+		})
+		if err != nil {
+			log.Printf("⚠️  Failed to escalate leave %s: %v", leave.ID.Hex(), err)
+			continue
+		}
+		escalated++
+	}
+
+	return fmt.Sprintf("escalated %d leave requests", escalated), nil
+}
@@ -152,33 +152,40 @@ func CreateLeave(c *gin.Context) {
 		UpdatedAt:  time.Now(),
 	}
 
-	_, err = config.LeavesCollection.InsertOne(ctx, leave)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Failed to create leave request",
-		})
-		return
-	}
+	// Route stages the employee would otherwise approve themselves
+	routeApprovals(ctx, &user, &leave)
+
+	// Save the leave, take the days and let the first approvers and the
+	// reliever know, all together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := config.LeavesCollection.InsertOne(ctx, leave); err != nil {
+			return err
+		}
 
-	// Deduct leave days from available balance immediately
-	_, err = config.UsersCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": userID},
-		bson.M{
-			"$inc": bson.M{
-				"leaveBalance.available": -totalDays,
-				"leaveBalance.used":      totalDays,
+		// Deduct leave days from available balance immediately
+		_, err := config.UsersCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": userID},
+			bson.M{
+				"$inc": bson.M{
+					"leaveBalance.available": -totalDays,
+					"leaveBalance.used":      totalDays,
+				},
+				"$set": bson.M{"updatedAt": time.Now()},
 			},
-			"$set": bson.M{"updatedAt": time.Now()},
-		},
-	)
+		)
+		if err != nil {
+			// Rollback: delete the leave request if balance update fails
+			config.LeavesCollection.DeleteOne(ctx, bson.M{"_id": leave.ID})
+			return err
+		}
+
+		return publishLeaveFiled(ctx, &leave, userID)
+	})
 	if err != nil {
-		// Rollback: delete the leave request if balance update fails
-		config.LeavesCollection.DeleteOne(ctx, bson.M{"_id": leave.ID})
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"message": "Failed to update leave balance",
+			"message": "Failed to create leave request",
 		})
 		return
 	}
@@ -187,14 +194,15 @@ func CreateLeave(c *gin.Context) {
 		"success": true,
 		"message": "Leave request created successfully",
 		"leave": gin.H{
-			"id":         leave.ID,
-			"leaveType":  leave.LeaveType,
-			"fromDate":   leave.FromDate,
-			"toDate":     leave.ToDate,
-			"totalDays":  leave.TotalDays,
-			"status":     leave.Status,
-			"stage":      leave.Stage,
-			"isEditable": leave.IsEditable,
+			"id":                 leave.ID,
+			"leaveType":          leave.LeaveType,
+			"fromDate":           leave.FromDate,
+			"toDate":             leave.ToDate,
+			"totalDays":          leave.TotalDays,
+			"status":             leave.Status,
+			"stage":              leave.Stage,
+			"isEditable":         leave.IsEditable,
+			"attachmentRequired": attachmentRequired(&leave),
 		},
 	})
 }
@@ -236,15 +244,11 @@ func GetMyLeaves(c *gin.Context) {
 		return
 	}
 
-	// Update status for active leaves and populate user data
+	// Populate user data. The leave-status job persists status changes; this
+	// only covers the minutes before its next run.
 	leaveResponses := make([]gin.H, len(leaves))
 	for i, leave := range leaves {
-		// Check and update status
 		updateLeaveStatus(&leave)
-		config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leave.ID}, bson.M{"$set": bson.M{
-			"status":   leave.Status,
-			"isActive": leave.IsActive,
-		}})
 
 		// Get employee info
 		var employee models.User
@@ -273,12 +277,16 @@ func GetMyLeaves(c *gin.Context) {
 				"firstName": reliever.FirstName,
 				"lastName":  reliever.LastName,
 			},
-			"status":       leave.Status,
-			"stage":        leave.Stage,
-			"approvalFlow": leave.ApprovalFlow,
-			"isEditable":   leave.IsEditable,
-			"isActive":     leave.IsActive,
-			"createdAt":    leave.CreatedAt,
+			"status":        leave.Status,
+			"stage":         leave.Stage,
+			"approvalFlow":  leave.ApprovalFlow,
+			"returnedStage": leave.ReturnedStage,
+			"history":       leave.History,
+			"filedBy":       leave.FiledBy,
+			"backdated":     leave.Backdated,
+			"isEditable":    leave.IsEditable,
+			"isActive":      leave.IsActive,
+			"createdAt":     leave.CreatedAt,
 		}
 	}
 
@@ -289,18 +297,17 @@ func GetMyLeaves(c *gin.Context) {
 	})
 }
 
-// updateLeaveStatus checks and updates leave status
+// updateLeaveStatus works out an approved leave's status from its dates, by
+// the same rules as the leave-status job, without saving it
 func updateLeaveStatus(leave *models.Leave) {
-	now := time.Now()
-	start := leave.FromDate
-	end := leave.ToDate
+	today := time.Now().Truncate(24 * time.Hour)
 
-	if leave.Status == "Approved" && !now.Before(start) && !now.After(end) {
-		leave.Status = "Active"
-		leave.IsActive = true
-	} else if leave.Status == "Active" && now.After(end) {
+	if (leave.Status == "Approved" || leave.Status == "Active") && leave.ToDate.Before(today) {
 		leave.Status = "Over"
 		leave.IsActive = false
+	} else if leave.Status == "Approved" && !leave.FromDate.After(today) {
+		leave.Status = "Active"
+		leave.IsActive = true
 	}
 }
 
@@ -341,15 +348,19 @@ func GetAllLeaves(c *gin.Context) {
 	}
 
 	// Populate user data and filter by department if needed
+	grants := middleware.GetCurrentGrants(c)
 	leaveResponses := []gin.H{}
 	for _, leave := range leaves {
 		var employee models.User
 		config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
 
-		// Filter by department if specified
+		// Filter by department if specified, and to departments the user may see
 		if department != "" && employee.Department != department {
 			continue
 		}
+		if !grants.Covers(models.PermLeaveView, employee.Department) {
+			continue
+		}
 
 		var reliever models.User
 		config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Reliever}).Decode(&reliever)
@@ -429,8 +440,7 @@ func UpdateLeave(c *gin.Context) {
 	}
 
 	// Check ownership
-	user, _ := middleware.GetCurrentUser(c)
-	if leave.Employee != userID && user.Role != "admin" {
+	if leave.Employee != userID && !canManageLeave(ctx, c, &leave) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"message": "Not authorized to update this leave request",
@@ -438,8 +448,9 @@ func UpdateLeave(c *gin.Context) {
 		return
 	}
 
-	// Check if editable
-	if !leave.IsEditable || leave.Stage >= 2 {
+	// Check if editable (returned leaves reopen for changes at any stage)
+	isReturned := leave.Status == "Returned"
+	if !isReturned && (!leave.IsEditable || leave.Stage >= 2) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Leave request cannot be edited at this stage",
@@ -520,12 +531,70 @@ func UpdateLeave(c *gin.Context) {
 		"reason":         req.Reason,
 		"updatedAt":      time.Now(),
 	}
+	updateDoc := bson.M{"$set": update}
+
+	// Resubmitting a returned leave resumes the workflow at the stage that returned it
+	if isReturned {
+		update["status"] = "Pending"
+		update["isEditable"] = leave.Stage < 2
+		unset := bson.M{"returnedStage": ""}
+		if leave.StageStatus(leave.ReturnedStage) == "returned" {
+			// The stage is undecided again; who returned it stays in the history
+			prefix := stageFieldPrefix(leave.ReturnedStage)
+			update[prefix+"ApprovalStatus"] = "pending"
+			unset[prefix+"Approver"] = ""
+			unset[prefix+"ApprovalDate"] = ""
+			unset[prefix+"ApprovalComment"] = ""
+		}
+		updateDoc["$unset"] = unset
+		updateDoc["$push"] = bson.M{
+			"history": models.LeaveHistoryEntry{
+				Action:  "resubmitted",
+				Stage:   leave.ReturnedStage,
+				Actor:   userID,
+				Changes: leaveChanges(&leave, update),
+				Date:    time.Now(),
+			},
+		}
+	}
 
-	_, err = config.LeavesCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leaveID},
-		bson.M{"$set": update},
-	)
+	// Save the changes and any balance adjustment together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := config.LeavesCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": leaveID},
+			updateDoc,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Adjust user's leave balance if days changed
+		if daysDifference != 0 {
+			_, err = config.UsersCollection.UpdateOne(
+				ctx,
+				bson.M{"_id": userID},
+				bson.M{
+					"$inc": bson.M{
+						"leaveBalance.available": -daysDifference, // Negative if increasing days, positive if reducing
+						"leaveBalance.used":      daysDifference,  // Positive if increasing days, negative if reducing
+					},
+					"$set": bson.M{"updatedAt": time.Now()},
+				},
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		// A newly chosen reliever needs to know they are covering
+		if relieverID != leave.Reliever {
+			updated := leave
+			updated.Reliever = relieverID
+			return publishRelieverAssigned(ctx, &updated, userID)
+		}
+		return nil
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -534,31 +603,29 @@ func UpdateLeave(c *gin.Context) {
 		return
 	}
 
-	// Adjust user's leave balance if days changed
-	if daysDifference != 0 {
-		_, err = config.UsersCollection.UpdateOne(
-			ctx,
-			bson.M{"_id": userID},
-			bson.M{
-				"$inc": bson.M{
-					"leaveBalance.available": -daysDifference, // Negative if increasing days, positive if reducing
-					"leaveBalance.used":      daysDifference,  // Positive if increasing days, negative if reducing
-				},
-				"$set": bson.M{"updatedAt": time.Now()},
-			},
-		)
-		if err != nil {
-			// Log error but don't fail the update
-			c.JSON(http.StatusOK, gin.H{
-				"success": true,
-				"message": "Leave request updated but balance adjustment may have failed",
-			})
-			return
-		}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Leave request updated successfully",
 	})
 }
+
+// leaveChanges records the previous value of each field the update modifies
+func leaveChanges(leave *models.Leave, update bson.M) map[string]interface{} {
+	previous := map[string]interface{}{
+		"leaveType":      leave.LeaveType,
+		"otherLeaveType": leave.OtherLeaveType,
+		"fromDate":       leave.FromDate,
+		"toDate":         leave.ToDate,
+		"totalDays":      leave.TotalDays,
+		"reliever":       leave.Reliever,
+		"reason":         leave.Reason,
+	}
+
+	changes := map[string]interface{}{}
+	for field, old := range previous {
+		if newValue, ok := update[field]; ok && newValue != old {
+			changes[field] = bson.M{"from": old, "to": newValue}
+		}
+	}
+	return changes
+}
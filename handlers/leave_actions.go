@@ -51,6 +51,15 @@ func ApproveLeave(c *gin.Context) {
 		return
 	}
 
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Leave request has been returned to the employee for changes",
+		})
+		return
+	}
+
 	// Determine approval role
 	var approvalRole string
 	switch leave.Stage {
@@ -68,6 +77,33 @@ func ApproveLeave(c *gin.Context) {
 		return
 	}
 
+	// Check the user may decide at this stage
+	if err := checkStageAuthority(ctx, &leave, user, approvalRole); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, approvalRole, user.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Some leave types need supporting documents before they can be approved
+	if err := checkAttachmentRequirement(ctx, &leave); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// Add approval to flow
 	approval := models.ApprovalStep{
 		Approver: user.ID,
@@ -87,43 +123,55 @@ func ApproveLeave(c *gin.Context) {
 	} else {
 		leave.Status = "Approved"
 		leave.IsEditable = false
+	}
 
-		// Deduct from user's leave balance
-		var employee models.User
-		config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
+	leave.UpdatedAt = time.Now()
 
-		_, err = config.UsersCollection.UpdateOne(
+	next := ""
+	if leave.Status == "Pending" {
+		next = models.ValidApprovalRoles[leave.Stage-1]
+	}
+
+	// Save the approval and any balance change, and let the employee and the
+	// next approvers know, all together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if leave.Status == "Approved" {
+			// Deduct from user's leave balance
+			var employee models.User
+			config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee)
+
+			_, err := config.UsersCollection.UpdateOne(
+				ctx,
+				bson.M{"_id": leave.Employee},
+				bson.M{"$set": bson.M{
+					"leaveBalance.available": employee.LeaveBalance.Available - leave.TotalDays,
+					"leaveBalance.used":      employee.LeaveBalance.Used + leave.TotalDays,
+					"updatedAt":              time.Now(),
+				}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Update leave
+		_, err := config.LeavesCollection.UpdateOne(
 			ctx,
-			bson.M{"_id": leave.Employee},
+			bson.M{"_id": leaveID},
 			bson.M{"$set": bson.M{
-				"leaveBalance.available": employee.LeaveBalance.Available - leave.TotalDays,
-				"leaveBalance.used":      employee.LeaveBalance.Used + leave.TotalDays,
-				"updatedAt":              time.Now(),
+				"status":       leave.Status,
+				"stage":        leave.Stage,
+				"approvalFlow": leave.ApprovalFlow,
+				"isEditable":   leave.IsEditable,
+				"updatedAt":    leave.UpdatedAt,
 			}},
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": "Failed to update leave balance",
-			})
-			return
+			return err
 		}
-	}
-
-	leave.UpdatedAt = time.Now()
 
-	// Update leave
-	_, err = config.LeavesCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leaveID},
-		bson.M{"$set": bson.M{
-			"status":       leave.Status,
-			"stage":        leave.Stage,
-			"approvalFlow": leave.ApprovalFlow,
-			"isEditable":   leave.IsEditable,
-			"updatedAt":    leave.UpdatedAt,
-		}},
-	)
+		return publishStageDecision(ctx, &leave, approvalRole, next, true, user.ID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -187,6 +235,15 @@ func RejectLeave(c *gin.Context) {
 		return
 	}
 
+	// Returned leaves wait for the employee to resubmit
+	if leave.Status == "Returned" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Leave request has been returned to the employee for changes",
+		})
+		return
+	}
+
 	// Determine approval role
 	var approvalRole string
 	switch leave.Stage {
@@ -204,6 +261,24 @@ func RejectLeave(c *gin.Context) {
 		return
 	}
 
+	// Check the user may decide at this stage
+	if err := checkStageAuthority(ctx, &leave, user, approvalRole); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, approvalRole, user.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// Add rejection to flow
 	rejection := models.ApprovalStep{
 		Approver: user.ID,
@@ -217,16 +292,28 @@ func RejectLeave(c *gin.Context) {
 	leave.Status = "Rejected"
 	leave.UpdatedAt = time.Now()
 
-	// Update leave
-	_, err = config.LeavesCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leaveID},
-		bson.M{"$set": bson.M{
-			"status":       leave.Status,
-			"approvalFlow": leave.ApprovalFlow,
-			"updatedAt":    leave.UpdatedAt,
-		}},
-	)
+	// Reject the leave, refund the days and let the employee know together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := config.LeavesCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": leaveID},
+			bson.M{"$set": bson.M{
+				"status":       leave.Status,
+				"approvalFlow": leave.ApprovalFlow,
+				"updatedAt":    leave.UpdatedAt,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+
+		// Refund leave days back to employee's balance
+		if err := refundLeaveDays(ctx, leave.Employee, leave.TotalDays); err != nil {
+			return err
+		}
+
+		return publishStageDecision(ctx, &leave, approvalRole, "", false, user.ID, req.Comments)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -235,27 +322,6 @@ func RejectLeave(c *gin.Context) {
 		return
 	}
 
-	// Refund leave days back to employee's balance
-	_, err = config.UsersCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leave.Employee},
-		bson.M{
-			"$inc": bson.M{
-				"leaveBalance.available": leave.TotalDays,
-				"leaveBalance.used":      -leave.TotalDays,
-			},
-			"$set": bson.M{"updatedAt": time.Now()},
-		},
-	)
-	if err != nil {
-		// Log error but don't fail the rejection
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"message": "Leave request rejected by " + approvalRole + " (warning: balance refund may have failed)",
-		})
-		return
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Leave request rejected by " + approvalRole + " and leave days refunded",
@@ -299,7 +365,7 @@ func CancelLeave(c *gin.Context) {
 
 	// Check ownership
 	user, _ := middleware.GetCurrentUser(c)
-	if leave.Employee != userID && user.Role != "admin" {
+	if leave.Employee != userID && !canManageLeave(ctx, c, &leave) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"message": "Not authorized to cancel this leave request",
@@ -308,46 +374,56 @@ func CancelLeave(c *gin.Context) {
 	}
 
 	// Check if can be cancelled
-	if leave.Status == "Over" || leave.Status == "Rejected" {
+	if leave.Status == "Over" || leave.Status == "Rejected" || leave.Status == "Cancelled" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "Cannot cancel completed or rejected leave",
+			"message": "Cannot cancel completed, rejected or cancelled leave",
 		})
 		return
 	}
 
-	// Refund days to balance for any cancellation (Pending, Approved, or Active)
-	// Since we deduct immediately on creation, we need to refund on cancel
-	if leave.Status == "Pending" || leave.Status == "Approved" || leave.Status == "Active" {
-		_, err = config.UsersCollection.UpdateOne(
+	// Approved leave can only be cancelled through an approved cancellation request
+	if leave.Status == "Approved" || leave.Status == "Active" {
+		fileCancellation(ctx, c, &leave, user, nil, "")
+		return
+	}
+
+	// Cancel the leave, refund the days and let everyone involved know
+	// together. The leave must still have the status it was loaded with, so a
+	// concurrent cancel cannot refund twice and a final approval meanwhile
+	// sends the leave through a cancellation request instead.
+	previousStatus := leave.Status
+	leave.Status = "Cancelled"
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := config.LeavesCollection.UpdateOne(
 			ctx,
-			bson.M{"_id": leave.Employee},
-			bson.M{
-				"$inc": bson.M{
-					"leaveBalance.available": leave.TotalDays,
-					"leaveBalance.used":      -leave.TotalDays,
-				},
-				"$set": bson.M{"updatedAt": time.Now()},
-			},
+			bson.M{"_id": leaveID, "status": previousStatus},
+			bson.M{"$set": bson.M{
+				"status":    "Cancelled",
+				"updatedAt": time.Now(),
+			}},
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": "Failed to refund leave balance",
-			})
-			return
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errLeaveChanged
 		}
-	}
 
-	// Update leave status
-	_, err = config.LeavesCollection.UpdateOne(
-		ctx,
-		bson.M{"_id": leaveID},
-		bson.M{"$set": bson.M{
-			"status":    "Cancelled",
-			"updatedAt": time.Now(),
-		}},
-	)
+		// Since we deduct immediately on creation, we need to refund on cancel
+		if err := refundLeaveDays(ctx, leave.Employee, leave.TotalDays); err != nil {
+			return err
+		}
+
+		return publishLeaveCancelled(ctx, &leave, userID, nil)
+	})
+	if err == errLeaveChanged {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Leave was approved, cancelled or changed by someone else, please reload",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -398,8 +474,7 @@ func DeleteLeave(c *gin.Context) {
 	}
 
 	// Check ownership
-	user, _ := middleware.GetCurrentUser(c)
-	if leave.Employee != userID && user.Role != "admin" {
+	if leave.Employee != userID && !canManageLeave(ctx, c, &leave) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"message": "Not authorized to delete this leave request",
@@ -416,8 +491,8 @@ func DeleteLeave(c *gin.Context) {
 		return
 	}
 
-	// Refund days if leave was pending (not rejected, as rejected already refunded)
-	if leave.Status == "Pending" {
+	// Refund days if leave was pending or returned (not rejected, as rejected already refunded)
+	if leave.Status == "Pending" || leave.Status == "Returned" {
 		_, err = config.UsersCollection.UpdateOne(
 			ctx,
 			bson.M{"_id": leave.Employee},
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// approvalStages lists the stage-specific workflow in the order it runs
+var approvalStages = []string{"HOD", "HR", "GED"}
+
+// RecordLeave records leave on an employee's behalf (HR/admin only).
+// Unlike CreateLeave the dates may be in the past, and HR chooses which stages
+// still review the leave or records it as already approved.
+func RecordLeave(c *gin.Context) {
+	var req models.RecordLeaveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	actor, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	employeeID, err := primitive.ObjectIDFromHex(req.Employee)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid employee ID",
+		})
+		return
+	}
+
+	// HR use the regular leave form for their own leave
+	if employeeID == actor.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You cannot record leave on your own behalf",
+		})
+		return
+	}
+
+	// Validate leave type
+	if !models.IsValidLeaveType(req.LeaveType) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave type",
+		})
+		return
+	}
+
+	// Parse dates
+	fromDate, err := time.Parse("2006-01-02", req.FromDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid from date format. Use YYYY-MM-DD",
+		})
+		return
+	}
+
+	toDate, err := time.Parse("2006-01-02", req.ToDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid to date format. Use YYYY-MM-DD",
+		})
+		return
+	}
+
+	if toDate.Before(fromDate) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "End date must be after start date",
+		})
+		return
+	}
+
+	if req.PreApproved && len(req.ApprovalPath) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Choose either an approval path or pre-approved, not both",
+		})
+		return
+	}
+
+	path, ok := normalizeApprovalPath(req.ApprovalPath)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Approval path may only contain HOD, HR and GED",
+		})
+		return
+	}
+
+	totalDays := models.CalculateDays(fromDate, toDate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var employee models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": employeeID}).Decode(&employee)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Employee not found",
+		})
+		return
+	}
+	if !checkDepartmentCovered(c, models.PermLeaveRecord, employee.Department) {
+		return
+	}
+
+	// A reliever is optional for leave that has already been taken
+	relieverID := primitive.NilObjectID
+	if req.Reliever != "" {
+		relieverID, err = primitive.ObjectIDFromHex(req.Reliever)
+		if err != nil || relieverID == employeeID {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid reliever ID",
+			})
+			return
+		}
+
+		var reliever models.User
+		err = config.UsersCollection.FindOne(ctx, bson.M{"_id": relieverID}).Decode(&reliever)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid reliever selected",
+			})
+			return
+		}
+	}
+
+	now := time.Now()
+	today := now.Truncate(24 * time.Hour)
+	leave := models.Leave{
+		ID:             primitive.NewObjectID(),
+		Employee:       employeeID,
+		LeaveType:      req.LeaveType,
+		OtherLeaveType: req.OtherLeaveType,
+		FromDate:       fromDate,
+		ToDate:         toDate,
+		TotalDays:      totalDays,
+		Reason:         req.Reason,
+		Reliever:       relieverID,
+		Status:         "Pending",
+		Stage:          1,
+		ApprovalFlow:   []models.ApprovalStep{},
+
+		HODApprovalStatus: "pending",
+		HRApprovalStatus:  "pending",
+		GEDApprovalStatus: "pending",
+
+		FiledBy:   actor.ID,
+		Backdated: fromDate.Before(today),
+		History: []models.LeaveHistoryEntry{{
+			Action:   "recorded",
+			Actor:    actor.ID,
+			Comments: "Recorded by HR on the employee's behalf",
+			Date:     now,
+		}},
+
+		IsEditable: true,
+		IsActive:   false,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if req.PreApproved {
+		markPreApproved(&leave, today)
+	} else {
+		// Route stages the employee would otherwise approve themselves
+		routeApprovals(ctx, &employee, &leave)
+		applyApprovalPath(&leave, path)
+	}
+
+	// Take the days, save the leave and let the employee, any remaining
+	// approvers and the reliever know, all together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := deductLeaveDays(ctx, employeeID, totalDays); err != nil {
+			return err
+		}
+
+		if _, err := config.LeavesCollection.InsertOne(ctx, leave); err != nil {
+			// Rollback: return the days if the leave could not be saved
+			refundLeaveDays(ctx, employeeID, totalDays)
+			return err
+		}
+
+		return publishLeaveFiled(ctx, &leave, actor.ID)
+	})
+	if err == ErrInsufficientBalance {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Employee has insufficient leave balance",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to record leave",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Leave recorded successfully",
+		"leave": gin.H{
+			"id":                leave.ID,
+			"employee":          leave.Employee,
+			"leaveType":         leave.LeaveType,
+			"fromDate":          leave.FromDate,
+			"toDate":            leave.ToDate,
+			"totalDays":         leave.TotalDays,
+			"status":            leave.Status,
+			"stage":             leave.Stage,
+			"hodApprovalStatus": leave.HODApprovalStatus,
+			"hrApprovalStatus":  leave.HRApprovalStatus,
+			"gedApprovalStatus": leave.GEDApprovalStatus,
+			"filedBy":           leave.FiledBy,
+			"backdated":         leave.Backdated,
+		},
+	})
+}
+
+// normalizeApprovalPath upper-cases and validates a requested approval path.
+// An empty path means the full workflow.
+func normalizeApprovalPath(requested []string) ([]string, bool) {
+	if len(requested) == 0 {
+		return approvalStages, true
+	}
+
+	path := []string{}
+	for _, stage := range requested {
+		stage = strings.ToUpper(strings.TrimSpace(stage))
+		if stage != "HOD" && stage != "HR" && stage != "GED" {
+			return nil, false
+		}
+		path = append(path, stage)
+	}
+	return path, true
+}
+
+// applyApprovalPath marks every stage left out of path as skipped and moves the
+// legacy stage number to the first stage still awaiting review
+func applyApprovalPath(leave *models.Leave, path []string) {
+	included := map[string]bool{}
+	for _, stage := range path {
+		included[stage] = true
+	}
+
+	comment := "Not part of the approval path chosen when the leave was recorded"
+	if !included["HOD"] && leave.HODApprovalStatus == "pending" {
+		leave.HODApprovalStatus = "skipped"
+		leave.HODApprovalComment = comment
+	}
+	if !included["HR"] {
+		leave.HRApprovalStatus = "skipped"
+		leave.HRApprovalComment = comment
+	}
+	if !included["GED"] {
+		leave.GEDApprovalStatus = "skipped"
+		leave.GEDApprovalComment = comment
+	}
+
+	for i, stage := range approvalStages {
+		if leave.StageStatus(stage) == "pending" {
+			leave.Stage = i + 1
+			leave.IsEditable = leave.Stage < 2
+			return
+		}
+	}
+
+	// Nothing left to review
+	markPreApproved(leave, time.Now().Truncate(24*time.Hour))
+}
+
+// markPreApproved records leave that needs no further review, setting its
+// status from the dates so backdated leave lands directly in Active or Over
+func markPreApproved(leave *models.Leave, today time.Time) {
+	comment := "Recorded as pre-approved by HR"
+	for _, stage := range approvalStages {
+		if leave.StageStatus(stage) != "pending" {
+			continue
+		}
+		switch stage {
+		case "HOD":
+			leave.HODApprovalStatus, leave.HODApprovalComment = "skipped", comment
+		case "HR":
+			leave.HRApprovalStatus, leave.HRApprovalComment = "skipped", comment
+		case "GED":
+			leave.GEDApprovalStatus, leave.GEDApprovalComment = "skipped", comment
+		}
+	}
+
+	leave.Stage = len(approvalStages)
+	leave.IsEditable = false
+	switch {
+	case leave.ToDate.Before(today):
+		leave.Status = "Over"
+		leave.IsActive = false
+	case !leave.FromDate.After(today):
+		leave.Status = "Active"
+		leave.IsActive = true
+	default:
+		leave.Status = "Approved"
+	}
+}
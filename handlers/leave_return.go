@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HODReturnLeave allows HOD to send a leave request back to the employee for changes
+func HODReturnLeave(c *gin.Context) {
+	returnLeaveForChanges(c, "HOD")
+}
+
+// HRReturnLeave allows HR to send a leave request back to the employee for changes
+func HRReturnLeave(c *gin.Context) {
+	returnLeaveForChanges(c, "HR")
+}
+
+// GEDReturnLeave allows GED to send a leave request back to the employee for changes
+func GEDReturnLeave(c *gin.Context) {
+	returnLeaveForChanges(c, "GED")
+}
+
+// returnLeaveForChanges returns a leave awaiting the given stage to the employee.
+// The stage is marked "returned" and picks up again when the employee resubmits.
+func returnLeaveForChanges(c *gin.Context, stage string) {
+	leaveID := c.Param("id")
+
+	// Validate leave ID
+	leaveObjID, err := primitive.ObjectIDFromHex(leaveID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid leave ID"})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Comments are required so the employee knows what to change
+	var req models.ApproveRejectRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Comments == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please describe the changes required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get the leave request
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveObjID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Leave request not found"})
+		return
+	}
+
+	if leave.Status != "Pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending leave requests can be returned for changes"})
+		return
+	}
+
+	// Only the stage currently awaiting a decision can return the request
+	if leave.PendingStage() != stage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Leave request is not awaiting " + stage + " review"})
+		return
+	}
+
+	if err := checkStageAuthority(ctx, &leave, user, stage); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, stage, user.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Send the leave back to the employee and reopen it for editing
+	now := time.Now()
+	prefix := stageFieldPrefix(stage)
+	update := bson.M{
+		"$set": bson.M{
+			prefix + "ApprovalStatus":  "returned",
+			prefix + "ApprovalDate":    now,
+			prefix + "ApprovalComment": req.Comments,
+			prefix + "Approver":        user.ID,
+			"status":                   "Returned",
+			"returnedStage":            stage,
+			"isEditable":               true,
+			"updatedAt":                now,
+		},
+		"$push": bson.M{
+			"history": models.LeaveHistoryEntry{
+				Action:   "returned",
+				Stage:    stage,
+				Actor:    user.ID,
+				Comments: req.Comments,
+				Date:     now,
+			},
+		},
+	}
+
+	// Save the return and let the employee know together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := config.LeavesCollection.UpdateOne(ctx, bson.M{"_id": leaveObjID}, update); err != nil {
+			return err
+		}
+		return publishLeaveReturned(ctx, &leave, stage, user.ID, req.Comments)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leave request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Leave request returned to employee for changes by " + stage,
+		"leaveId": leaveID,
+	})
+}
+
+// ReturnLeave sends a leave request back to the employee for changes at its current stage
+func ReturnLeave(c *gin.Context) {
+	idParam := c.Param("id")
+	leaveID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return
+	}
+
+	var req models.ApproveRejectRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Comments == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Please describe the changes required",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get leave
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+
+	if leave.Status != "Pending" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Only pending leave requests can be returned for changes",
+		})
+		return
+	}
+
+	// Determine approval role
+	var approvalRole string
+	switch leave.Stage {
+	case 1:
+		approvalRole = "HOD"
+	case 2:
+		approvalRole = "HR"
+	case 3:
+		approvalRole = "GED"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid approval stage",
+		})
+		return
+	}
+
+	// Check the user may decide at this stage
+	if err := checkStageAuthority(ctx, &leave, user, approvalRole); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Enforce separation of duties
+	if err := checkSeparationOfDuties(&leave, approvalRole, user.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	leave.ApprovalFlow = append(leave.ApprovalFlow, models.ApprovalStep{
+		Approver: user.ID,
+		Role:     approvalRole,
+		Status:   "Returned",
+		Comments: req.Comments,
+		Date:     now,
+	})
+
+	// Save the return and let the employee know together
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := config.LeavesCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": leaveID},
+			bson.M{
+				"$set": bson.M{
+					"status":        "Returned",
+					"returnedStage": approvalRole,
+					"approvalFlow":  leave.ApprovalFlow,
+					"isEditable":    true,
+					"updatedAt":     now,
+				},
+				"$push": bson.M{
+					"history": models.LeaveHistoryEntry{
+						Action:   "returned",
+						Stage:    approvalRole,
+						Actor:    user.ID,
+						Comments: req.Comments,
+						Date:     now,
+					},
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		return publishLeaveReturned(ctx, &leave, approvalRole, user.ID, req.Comments)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to return leave",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Leave request returned to employee for changes by " + approvalRole,
+	})
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/audit"
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	loginFreeFailures = 3           // Failures allowed before each try has to wait
+	loginMaxDelay     = time.Minute // Longest wait between tries short of a lockout
+)
+
+// InitLoginProtection creates the failed sign-in indexes. Records are
+// deleted once their failures and any lockout have run out.
+func InitLoginProtection() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.LoginAttemptsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "lockedUntil", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create login attempt indexes: %v", err)
+	}
+}
+
+// loginFailureWindow is how long a failure counts towards delays and lockout (LOGIN_FAILURE_WINDOW_MINUTES)
+func loginFailureWindow() time.Duration {
+	return time.Duration(config.GetInt64("LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute
+}
+
+// loginLockoutDuration is how long a lockout lasts (LOGIN_LOCKOUT_MINUTES)
+func loginLockoutDuration() time.Duration {
+	return time.Duration(config.GetInt64("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+}
+
+// loginLockoutThreshold is the number of failures in the window that locks a
+// subject out. An IP address may serve many people, so it gets more room.
+func loginLockoutThreshold(kind string) int64 {
+	if kind == models.LoginSubjectIP {
+		return config.GetInt64("LOGIN_IP_LOCKOUT_THRESHOLD", 50)
+	}
+	return config.GetInt64("LOGIN_LOCKOUT_THRESHOLD", 10)
+}
+
+// loginDelay is the wait imposed after the given number of failures: none for
+// the first few, then doubling from one second up to loginMaxDelay
+func loginDelay(failures int64) time.Duration {
+	if failures <= loginFreeFailures {
+		return 0
+	}
+	exponent := float64(failures - loginFreeFailures - 1)
+	delay := time.Duration(math.Pow(2, math.Min(exponent, 16))) * time.Second
+	if delay > loginMaxDelay {
+		return loginMaxDelay
+	}
+	return delay
+}
+
+// loginAttemptsID returns the record ID for a subject
+func loginAttemptsID(kind, subject string) string {
+	return kind + ":" + subject
+}
+
+// normalizeLoginEmail returns the form emails are tracked under
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginThrottle reports how long a sign-in to email from ipAddress must
+// wait, and whether that is because the account or address is locked out
+func checkLoginThrottle(ctx context.Context, email, ipAddress string) (time.Duration, bool, error) {
+	ids := []string{
+		loginAttemptsID(models.LoginSubjectAccount, normalizeLoginEmail(email)),
+		loginAttemptsID(models.LoginSubjectIP, ipAddress),
+	}
+	cursor, err := config.LoginAttemptsCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, false, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []models.LoginAttempts
+	if err := cursor.All(ctx, &records); err != nil {
+		return 0, false, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	locked := false
+	for _, record := range records {
+		if record.LockedUntil != nil && record.LockedUntil.After(now) {
+			locked = true
+			if d := record.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+		if record.BlockedUntil != nil && record.BlockedUntil.After(now) {
+			if d := record.BlockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, locked, nil
+}
+
+// rejectThrottledLogin answers a sign-in that came too soon after failures.
+// Locked accounts and addresses get the same answer as delays, so it does not
+// reveal whether an account exists.
+func rejectThrottledLogin(c *gin.Context, wait time.Duration, locked bool) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	message := "Too many failed sign-in attempts. Please wait a moment and try again."
+	if locked {
+		message = "Too many failed sign-in attempts. Please try again later."
+	}
+
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"success":    false,
+		"message":    message,
+		"retryAfter": seconds,
+	})
+}
+
+// recordLoginFailure counts a failed sign-in against both the account and
+// the IP address, imposing a delay or lockout once they have failed too
+// often. userID is the account's user, if it exists, for the audit log.
+func recordLoginFailure(ctx context.Context, email, ipAddress string, userID primitive.ObjectID) {
+	email = normalizeLoginEmail(email)
+	for _, subject := range []struct{ kind, value string }{
+		{models.LoginSubjectAccount, email},
+		{models.LoginSubjectIP, ipAddress},
+	} {
+		locked, record, err := countLoginFailure(ctx, subject.kind, subject.value)
+		if err != nil {
+			log.Printf("⚠️  Failed to record failed sign-in for %s: %v", subject.kind, err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		entry := models.AuditLog{
+			Action:    models.AuditAccountLocked,
+			IPAddress: ipAddress,
+			Details: map[string]interface{}{
+				"email":       email,
+				"lockedUntil": record.LockedUntil,
+			},
+		}
+		if subject.kind == models.LoginSubjectIP {
+			entry.Action = models.AuditIPLocked
+			delete(entry.Details, "email")
+		} else {
+			entry.Target = userID
+		}
+		audit.Record(ctx, entry)
+	}
+}
+
+// countLoginFailure adds a failure to a subject's record, starting the count
+// again if the last failure is outside the window, and applies the resulting
+// delay or lockout. It reports whether this failure locked the subject out.
+func countLoginFailure(ctx context.Context, kind, subject string) (bool, *models.LoginAttempts, error) {
+	now := time.Now()
+	window := loginFailureWindow()
+	id := loginAttemptsID(kind, subject)
+
+	// A pipeline update counts and resets atomically, so instances sharing the record agree
+	var record models.LoginAttempts
+	count := func() error {
+		return config.LoginAttemptsCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": id},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{
+				"kind":    kind,
+				"subject": subject,
+				"failures": bson.M{"$cond": bson.A{
+					bson.M{"$gte": bson.A{"$lastFailureAt", now.Add(-window)}},
+					bson.M{"$add": bson.A{"$failures", 1}},
+					1,
+				}},
+				"lastFailureAt": now,
+				"expiresAt":     bson.M{"$max": bson.A{now.Add(window), "$expiresAt"}},
+			}}}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&record)
+	}
+
+	// Two first failures can race to create the record; the loser finds it on a second try
+	err := count()
+	if mongo.IsDuplicateKeyError(err) {
+		err = count()
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	if record.Failures >= loginLockoutThreshold(kind) {
+		lockedUntil := now.Add(loginLockoutDuration())
+		// Only one instance gets to lock, so the lockout is audited once
+		result, err := config.LoginAttemptsCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": id, "lockedUntil": bson.M{"$not": bson.M{"$gt": now}}},
+			bson.M{
+				"$set": bson.M{
+					"failures":    0,
+					"lockedUntil": lockedUntil,
+					"expiresAt":   lockedUntil.Add(window),
+				},
+				"$unset": bson.M{"blockedUntil": ""},
+			},
+		)
+		if err != nil {
+			return false, nil, err
+		}
+		record.LockedUntil = &lockedUntil
+		return result.ModifiedCount > 0, &record, nil
+	}
+
+	if delay := loginDelay(record.Failures); delay > 0 {
+		_, err := config.LoginAttemptsCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"blockedUntil": now.Add(delay)}},
+		)
+		if err != nil {
+			return false, nil, err
+		}
+	}
+	return false, &record, nil
+}
+
+// clearLoginFailures forgets an account's failed sign-ins once it signs in.
+// Failures from the IP address still count, since the address may be trying
+// many accounts.
+func clearLoginFailures(ctx context.Context, email string) {
+	id := loginAttemptsID(models.LoginSubjectAccount, normalizeLoginEmail(email))
+	if _, err := config.LoginAttemptsCollection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		log.Printf("⚠️  Failed to clear failed sign-ins: %v", err)
+	}
+}
+
+// AdminGetLockouts lists the accounts and IP addresses currently locked out
+// of signing in (admin only)
+func AdminGetLockouts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.LoginAttemptsCollection.Find(
+		ctx,
+		bson.M{"lockedUntil": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "lockedUntil", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch lockouts",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	lockouts := []models.LoginAttempts{}
+	if err := cursor.All(ctx, &lockouts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode lockouts",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"count":    len(lockouts),
+		"lockouts": lockouts,
+	})
+}
+
+// AdminUnlockUser clears a user's failed sign-ins and any lockout (admin only)
+func AdminUnlockUser(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := config.UsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+	if !checkDepartmentCovered(c, models.PermUserManage, user.Department) {
+		return
+	}
+
+	email := normalizeLoginEmail(user.Email)
+	result, err := config.LoginAttemptsCollection.DeleteOne(ctx, bson.M{"_id": loginAttemptsID(models.LoginSubjectAccount, email)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to unlock user",
+		})
+		return
+	}
+
+	if result.DeletedCount > 0 {
+		adminID, _ := middleware.GetCurrentUserID(c)
+		audit.Record(ctx, models.AuditLog{
+			Action:    models.AuditAccountUnlocked,
+			Actor:     adminID,
+			Target:    userID,
+			IPAddress: c.ClientIP(),
+			Details:   map[string]interface{}{"email": email},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "User unlocked successfully",
+	})
+}
+
+// AdminUnlockIP clears an IP address's failed sign-ins and any lockout (admin only)
+func AdminUnlockIP(c *gin.Context) {
+	ipAddress := c.Param("ip")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.LoginAttemptsCollection.DeleteOne(ctx, bson.M{"_id": loginAttemptsID(models.LoginSubjectIP, ipAddress)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to unlock IP address",
+		})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "No failed sign-ins recorded for this IP address",
+		})
+		return
+	}
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditIPUnlocked,
+		Actor:     adminID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"unlockedIp": ipAddress},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "IP address unlocked successfully",
+	})
+}
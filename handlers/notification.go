@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/notifications"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetNotifications returns the current user's notifications, newest first.
+// Supports ?unread=true and ?limit=N (default 50, max 200).
+func GetNotifications(c *gin.Context) {
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	filter := bson.M{"user": userID}
+	if c.Query("unread") == "true" {
+		filter["read"] = false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.NotificationsCollection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch notifications",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	notifications := []models.Notification{}
+	if err := cursor.All(ctx, &notifications); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode notifications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"count":         len(notifications),
+		"notifications": notifications,
+	})
+}
+
+// GetUnreadNotificationCount returns how many unread notifications the current user has
+func GetUnreadNotificationCount(c *gin.Context) {
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := config.NotificationsCollection.CountDocuments(ctx, bson.M{"user": userID, "read": false})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to count notifications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"unread":  count,
+	})
+}
+
+// MarkNotificationRead marks one of the current user's notifications as read
+func MarkNotificationRead(c *gin.Context) {
+	notificationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid notification ID",
+		})
+		return
+	}
+
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only the owner's notifications match, so other users' IDs read as not found
+	result, err := config.NotificationsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": notificationID, "user": userID},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update notification",
+		})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Notification not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification marked as read",
+	})
+}
+
+// MarkAllNotificationsRead marks all of the current user's notifications as read
+func MarkAllNotificationsRead(c *gin.Context) {
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.NotificationsCollection.UpdateMany(
+		ctx,
+		bson.M{"user": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update notifications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "All notifications marked as read",
+		"updated": result.ModifiedCount,
+	})
+}
+
+// GetNotificationPreferences returns the channels enabled for every event
+// type and when the daily digest arrives
+func GetNotificationPreferences(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	preferences := map[string]models.NotificationChannels{}
+	for _, eventType := range notificationTypes() {
+		preferences[eventType] = models.NotificationChannels{
+			Email: user.WantsNotification(eventType, models.ChannelEmail),
+			InApp: user.WantsNotification(eventType, models.ChannelInApp),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"preferences": preferences,
+		"digestTime":  notifications.DigestTime(user),
+		"timezone":    notifications.Timezone(user),
+	})
+}
+
+// UpdateNotificationPreferences sets the channels for the given event types
+// and the digest time and timezone. Anything left out of the request keeps its
+// current setting; an empty digest time or timezone restores the default.
+func UpdateNotificationPreferences(c *gin.Context) {
+	var req models.UpdateNotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	known := map[string]bool{}
+	for _, eventType := range notificationTypes() {
+		known[eventType] = true
+	}
+
+	set := bson.M{"updatedAt": time.Now()}
+	if req.DigestTime != nil {
+		if _, err := time.Parse("15:04", *req.DigestTime); err != nil && *req.DigestTime != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Digest time must be HH:MM",
+			})
+			return
+		}
+		set["digestTime"] = *req.DigestTime
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Unknown timezone: " + *req.Timezone,
+			})
+			return
+		}
+		set["timezone"] = *req.Timezone
+	}
+	for eventType, channels := range req.Preferences {
+		if !known[eventType] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Unknown notification type: " + eventType,
+			})
+			return
+		}
+		set["notificationPreferences."+models.NotificationPreferenceKey(eventType)] = channels
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = config.UsersCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": set})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update notification preferences",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification preferences updated successfully",
+	})
+}
+
+// notificationTypes lists every type a user can set channels for: the leave
+// events and the daily digest
+func notificationTypes() []string {
+	return append(append([]string{}, events.Types...), models.DailyDigest)
+}
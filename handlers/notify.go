@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// publishLeaveEvent announces a leave transition to the given users. Empty
+// IDs, duplicates and the actor themselves are left out.
+func publishLeaveEvent(ctx context.Context, eventType string, leave *models.Leave, actor primitive.ObjectID, recipients []primitive.ObjectID, data map[string]interface{}) error {
+	seen := map[primitive.ObjectID]bool{primitive.NilObjectID: true, actor: true}
+	unique := []primitive.ObjectID{}
+	for _, id := range recipients {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return events.Publish(ctx, events.Event{
+		Type:       eventType,
+		LeaveID:    leave.ID,
+		Employee:   leave.Employee,
+		Actor:      actor,
+		Recipients: unique,
+		Data:       data,
+	})
+}
+
+// stageApprovers returns the users who can act on leave at the given stage:
+// the stage's delegate if it has one, otherwise everyone whose grants cover
+// the stage for the employee's department
+func stageApprovers(ctx context.Context, leave *models.Leave, stage string) []primitive.ObjectID {
+	if delegate := stageDelegate(leave, stage); !delegate.IsZero() {
+		return []primitive.ObjectID{delegate}
+	}
+
+	perms := models.StagePermissions(stage)
+	if len(perms) == 0 {
+		return nil
+	}
+	department, err := employeeDepartment(ctx, leave)
+	if err != nil {
+		return nil
+	}
+
+	// Narrow the search to holders of a role that can approve the stage
+	roles := middleware.GetRoles(ctx)
+	names := []string{}
+	for name := range roles {
+		if hasAnyPermission(middleware.RolePermissions(roles, name), perms) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{
+		"isActive": true,
+		"_id":      bson.M{"$ne": leave.Employee},
+		"$or": bson.A{
+			bson.M{"role": bson.M{"$in": names}},
+			bson.M{"roleAssignments.role": bson.M{"$in": names}},
+		},
+	})
+	if err != nil {
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, user := range users {
+		if coversStage(middleware.UserGrants(ctx, &user), stage, department) {
+			ids = append(ids, user.ID)
+		}
+	}
+	return ids
+}
+
+// hasAnyPermission reports whether held includes any of perms
+func hasAnyPermission(held, perms []string) bool {
+	for _, perm := range held {
+		for _, want := range perms {
+			if perm == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publishLeaveFiled announces a new leave request to the approvers of its first
+// pending stage and to the reliever covering for the employee
+func publishLeaveFiled(ctx context.Context, leave *models.Leave, actor primitive.ObjectID) error {
+	recipients := []primitive.ObjectID{leave.Employee}
+	if stage := leave.PendingStage(); stage != "" {
+		recipients = append(recipients, stageApprovers(ctx, leave, stage)...)
+	}
+	err := publishLeaveEvent(ctx, events.LeaveCreated, leave, actor, recipients, map[string]interface{}{
+		"stage":  leave.PendingStage(),
+		"status": leave.Status,
+	})
+	if err != nil {
+		return err
+	}
+
+	return publishRelieverAssigned(ctx, leave, actor)
+}
+
+// publishRelieverAssigned tells a reliever they are covering for the employee
+func publishRelieverAssigned(ctx context.Context, leave *models.Leave, actor primitive.ObjectID) error {
+	if leave.Reliever.IsZero() {
+		return nil
+	}
+	return publishLeaveEvent(ctx, events.RelieverAssigned, leave, actor, []primitive.ObjectID{leave.Reliever}, nil)
+}
+
+// publishStageDecision announces an approval or rejection at a stage. leave
+// must already reflect the decision; next is the stage now awaiting review.
+func publishStageDecision(ctx context.Context, leave *models.Leave, stage, next string, approved bool, actor primitive.ObjectID, comments string) error {
+	data := map[string]interface{}{
+		"stage":    stage,
+		"comments": comments,
+	}
+
+	if !approved {
+		return publishLeaveEvent(ctx, events.LeaveStageRejected, leave, actor, []primitive.ObjectID{leave.Employee}, data)
+	}
+
+	if leave.Status == "Approved" {
+		return publishLeaveEvent(ctx, events.LeaveApproved, leave, actor, []primitive.ObjectID{leave.Employee, leave.Reliever}, data)
+	}
+
+	recipients := []primitive.ObjectID{leave.Employee}
+	if next != "" {
+		data["nextStage"] = next
+		recipients = append(recipients, stageApprovers(ctx, leave, next)...)
+	}
+	return publishLeaveEvent(ctx, events.LeaveStageApproved, leave, actor, recipients, data)
+}
+
+// publishLeaveCancelled tells everyone involved in a leave that it was cancelled
+func publishLeaveCancelled(ctx context.Context, leave *models.Leave, actor primitive.ObjectID, data map[string]interface{}) error {
+	recipients := []primitive.ObjectID{
+		leave.Employee, leave.Reliever,
+		leave.HODApprover, leave.HRApprover, leave.GEDApprover,
+	}
+	for _, step := range leave.ApprovalFlow {
+		recipients = append(recipients, step.Approver)
+	}
+	return publishLeaveEvent(ctx, events.LeaveCancelled, leave, actor, recipients, data)
+}
+
+// publishLeaveReturned tells the employee their leave was sent back for changes
+func publishLeaveReturned(ctx context.Context, leave *models.Leave, stage string, actor primitive.ObjectID, comments string) error {
+	return publishLeaveEvent(ctx, events.LeaveReturned, leave, actor, []primitive.ObjectID{leave.Employee}, map[string]interface{}{
+		"stage":    stage,
+		"comments": comments,
+	})
+}
+
+// publishLeaveExtended tells the employee and their reliever that an approved
+// extension moved the end of the leave
+func publishLeaveExtended(ctx context.Context, leave *models.Leave, extension *models.ExtensionRequest, actor primitive.ObjectID) error {
+	return publishLeaveEvent(ctx, events.LeaveExtended, leave, actor, []primitive.ObjectID{leave.Employee, leave.Reliever}, map[string]interface{}{
+		"previousToDate": leave.ToDate,
+		"newToDate":      extension.NewToDate,
+		"extraDays":      extension.ExtraDays,
+	})
+}
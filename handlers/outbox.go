@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AdminGetStuckOutboxMessages lists events that failed to dispatch or have
+// waited too long (admin only). Supports ?limit=N (default 50, max 200).
+func AdminGetStuckOutboxMessages(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	messages, err := events.StuckMessages(ctx, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch outbox messages",
+		})
+		return
+	}
+
+	// Overall backlog, so admins can tell a slow dispatcher from a stalled one
+	pending, err := config.OutboxCollection.CountDocuments(ctx, bson.M{"status": events.OutboxPending})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to count outbox messages",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"count":      len(messages),
+		"pending":    pending,
+		"stuckAfter": events.StuckAfter.String(),
+		"messages":   messages,
+	})
+}
+
+// AdminRetryOutboxMessage queues an undispatched event for another round of
+// attempts (admin only)
+func AdminRetryOutboxMessage(c *gin.Context) {
+	messageID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid message ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found, err := events.Retry(ctx, messageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to retry outbox message",
+		})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Outbox message not found or already dispatched",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Outbox message queued for retry",
+	})
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/notifications"
+	"github.com/flowkit/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// forgotPasswordResponse is sent whether or not the account exists, so the
+// endpoint cannot be used to find out who has one
+const forgotPasswordResponse = "If an account exists for that email, a password reset link has been sent"
+
+// InitPasswordResets creates the password reset indexes. Tokens are deleted
+// once they expire.
+func InitPasswordResets() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.PasswordResetsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create password reset indexes: %v", err)
+	}
+}
+
+// hashToken returns the stored form of a random token sent to a user. The
+// tokens are random, so a plain SHA-256 is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken generates a random URL-safe token and its hash
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// ForgotPassword emails a password reset link to an active account. Requests
+// are rate limited per email and per IP address, and the response is the same
+// whether or not the account exists.
+func ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Counted for every email, registered or not, so hitting the limit says nothing about the account
+	allowed, err := utils.AllowRate(ctx, "forgot-password:ip:"+c.ClientIP(), config.GetInt64("PASSWORD_RESET_LIMIT_PER_IP", 10), time.Hour)
+	if err == nil && allowed {
+		allowed, err = utils.AllowRate(ctx, "forgot-password:email:"+email, config.GetInt64("PASSWORD_RESET_LIMIT_PER_EMAIL", 3), time.Hour)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to process request",
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"message": "Too many password reset requests. Please try again later.",
+		})
+		return
+	}
+
+	var user models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	if err == nil && user.IsActive {
+		if err := sendPasswordReset(ctx, &user, c.ClientIP()); err != nil {
+			log.Printf("⚠️  Failed to send password reset to %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": forgotPasswordResponse,
+	})
+}
+
+// sendPasswordReset replaces any outstanding reset token for the user with a
+// new one and emails it
+func sendPasswordReset(ctx context.Context, user *models.User, ipAddress string) error {
+	token, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(config.GetInt64("PASSWORD_RESET_TTL_MINUTES", 60)) * time.Minute
+
+	// Only the latest link works
+	if _, err := config.PasswordResetsCollection.DeleteMany(ctx, bson.M{"user": user.ID, "usedAt": bson.M{"$exists": false}}); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reset := models.PasswordReset{
+		ID:          primitive.NewObjectID(),
+		User:        user.ID,
+		TokenHash:   hash,
+		RequestedIP: ipAddress,
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+	if _, err := config.PasswordResetsCollection.InsertOne(ctx, reset); err != nil {
+		return err
+	}
+
+	return notifications.SendPasswordReset(*user, token, ttl)
+}
+
+// ResetPassword sets a new password with an emailed token. The token is used
+// up even if the account turns out to be deactivated, and every session is
+// signed out.
+func ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Claiming the token atomically makes sure it works only once
+	now := time.Now()
+	var reset models.PasswordReset
+	err := config.PasswordResetsCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"tokenHash": hashToken(req.Token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid or expired reset token",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to reset password",
+		})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to hash password",
+		})
+		return
+	}
+
+	result, err := config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": reset.User, "isActive": true},
+		bson.M{"$set": bson.M{
+			"password":  hashedPassword,
+			"updatedAt": now,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to reset password",
+		})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid or expired reset token",
+		})
+		return
+	}
+
+	if _, err := middleware.RevokeUserSessions(ctx, reset.User, primitive.NilObjectID, "password reset"); err != nil {
+		log.Printf("⚠️  Failed to sign out sessions after password reset for %s: %v", reset.User.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password reset successfully. Please sign in with your new password.",
+	})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/notifications/notificationstest"
+	"github.com/flowkit/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resetLink finds the reset token in a password reset email
+var resetLink = regexp.MustCompile(`reset-password\?token=([^\s"<]+)`)
+
+func TestPasswordReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useTestDatabase(t)
+	t.Setenv("PASSWORD_RESET_LIMIT_PER_EMAIL", "3")
+	t.Setenv("PASSWORD_RESET_TTL_MINUTES", "30")
+	mailer := notificationstest.UseMailer(t)
+
+	router := gin.New()
+	router.POST("/api/auth/forgot-password", ForgotPassword)
+	router.POST("/api/auth/reset-password", ResetPassword)
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	forgot := func(email string) *httptest.ResponseRecorder {
+		return post("/api/auth/forgot-password", gin.H{"email": email})
+	}
+	reset := func(token, password string) *httptest.ResponseRecorder {
+		return post("/api/auth/reset-password", gin.H{"token": token, "newPassword": password})
+	}
+	// token reads the token from the next reset email, sent to email
+	token := func(t *testing.T, email string) string {
+		t.Helper()
+		msg := mailer.Receive(t, 1)[0]
+		if msg.To != email {
+			t.Fatalf("reset sent to %s, want %s", msg.To, email)
+		}
+		if msg.Subject != "Reset your FlowKit password" || !strings.Contains(msg.Text, "expires in 30 minutes") {
+			t.Errorf("email = %q:\n%s", msg.Subject, msg.Text)
+		}
+		match := resetLink.FindStringSubmatch(msg.Text)
+		if match == nil {
+			t.Fatalf("no reset link in:\n%s", msg.Text)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatalf("reset link %s: %v", match[0], err)
+		}
+		return token
+	}
+
+	ctx := context.Background()
+	oldHash, _ := utils.HashPassword("old-password")
+	active := models.User{ID: primitive.NewObjectID(), FirstName: "Ama", Email: "ama@example.com", Password: oldHash, IsActive: true}
+	inactive := models.User{ID: primitive.NewObjectID(), FirstName: "Kofi", Email: "kofi@example.com", Password: oldHash}
+	for _, user := range []models.User{active, inactive} {
+		if _, err := config.UsersCollection.InsertOne(ctx, user); err != nil {
+			t.Fatalf("inserting %s: %v", user.Email, err)
+		}
+	}
+
+	t.Run("no email for unknown or inactive accounts", func(t *testing.T) {
+		for _, email := range []string{"nobody@example.com", inactive.Email} {
+			w := forgot(email)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), forgotPasswordResponse) {
+				t.Errorf("%s: status = %d, body %s, want the usual response", email, w.Code, w.Body)
+			}
+		}
+		mailer.ExpectNone(t)
+	})
+
+	t.Run("only the latest link works, once", func(t *testing.T) {
+		if w := forgot(active.Email); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		first := token(t, active.Email)
+
+		forgot(active.Email)
+		latest := token(t, active.Email)
+		mailer.ExpectNone(t)
+
+		if w := reset(first, "new-password"); w.Code != http.StatusBadRequest {
+			t.Errorf("replaced token: status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if w := reset(latest, "new-password"); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+		if user := findUser(t, active.ID); !utils.CheckPassword("new-password", user.Password) {
+			t.Error("password was not changed")
+		}
+		if w := reset(latest, "another-password"); w.Code != http.StatusBadRequest {
+			t.Errorf("used token: status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("rate limited per email", func(t *testing.T) {
+		// Two of the three requests allowed an hour were made above
+		forgot(active.Email)
+		token(t, active.Email)
+		if w := forgot(active.Email); w.Code != http.StatusTooManyRequests {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+		}
+		mailer.ExpectNone(t)
+	})
+
+	t.Run("expired link", func(t *testing.T) {
+		t.Setenv("PASSWORD_RESET_LIMIT_PER_EMAIL", "10")
+		forgot(active.Email)
+		expired := token(t, active.Email)
+		if _, err := config.PasswordResetsCollection.UpdateMany(ctx, bson.M{}, bson.M{
+			"$set": bson.M{"expiresAt": time.Now().Add(-time.Minute)},
+		}); err != nil {
+			t.Fatalf("expiring the token: %v", err)
+		}
+		if w := reset(expired, "new-password"); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
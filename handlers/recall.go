@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecallLeave calls an employee back early from active leave (HOD/HR only).
+// The leave ends the day before the return date and unused working days are refunded.
+func RecallLeave(c *gin.Context) {
+	idParam := c.Param("id")
+	leaveID, err := primitive.ObjectIDFromHex(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid leave ID",
+		})
+		return
+	}
+
+	var req models.RecallLeaveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Return date and reason are required",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	returnDate, err := time.Parse("2006-01-02", req.ReturnDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid return date format. Use YYYY-MM-DD",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get leave
+	var leave models.Leave
+	err = config.LeavesCollection.FindOne(ctx, bson.M{"_id": leaveID}).Decode(&leave)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Leave request not found",
+		})
+		return
+	}
+	storedStatus := leave.Status
+
+	// The leave-status job may not have caught up yet, so work it out from the dates
+	updateLeaveStatus(&leave)
+	if leave.Status != "Active" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Only active leave can be recalled",
+		})
+		return
+	}
+
+	if leave.Employee == user.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You cannot recall your own leave",
+		})
+		return
+	}
+
+	// HODs recall within their department, HR anywhere
+	stage := "HOD"
+	if middleware.UserGrants(ctx, user).HasAny(models.PermLeaveApproveHR, models.PermLeaveApproveAny) {
+		stage = "HR"
+	}
+	if err := checkStageAuthority(ctx, &leave, user, stage); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !returnDate.After(leave.FromDate) || returnDate.After(leave.ToDate) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Return date must be after the first day and no later than the last day of the leave",
+		})
+		return
+	}
+
+	// Refund working days from the return date to the original end date
+	now := time.Now()
+	newToDate := returnDate.Add(-24 * time.Hour)
+	refunded := models.CalculateDays(returnDate, leave.ToDate)
+	recall := models.LeaveRecall{
+		ReturnDate:     returnDate,
+		OriginalToDate: leave.ToDate,
+		RefundedDays:   refunded,
+		Reason:         req.Reason,
+		RecalledBy:     user.ID,
+		RecalledAt:     now,
+	}
+
+	status := "Active"
+	isActive := true
+	if now.After(newToDate) {
+		status = "Over"
+		isActive = false
+	}
+
+	// Shorten the leave, refund the days, drop any pending extension and let
+	// the employee and their reliever know about the early return, all
+	// together. The leave must still be as it was read, so a cancellation or
+	// another recall meanwhile cannot refund the same days twice.
+	err = config.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := config.LeavesCollection.UpdateOne(
+			ctx,
+			bson.M{
+				"_id":    leaveID,
+				"status": storedStatus,
+				"toDate": leave.ToDate,
+				"recall": bson.M{"$exists": false},
+			},
+			bson.M{
+				"$set": bson.M{
+					"toDate":    newToDate,
+					"totalDays": leave.TotalDays - refunded,
+					"status":    status,
+					"isActive":  isActive,
+					"recall":    recall,
+					"updatedAt": now,
+				},
+				"$push": bson.M{
+					"history": models.LeaveHistoryEntry{
+						Action:   "recalled",
+						Actor:    user.ID,
+						Comments: req.Reason,
+						Changes: map[string]interface{}{
+							"toDate":    bson.M{"from": leave.ToDate, "to": newToDate},
+							"totalDays": bson.M{"from": leave.TotalDays, "to": leave.TotalDays - refunded},
+						},
+						Date: now,
+					},
+				},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errLeaveChanged
+		}
+
+		if err := refundLeaveDays(ctx, leave.Employee, refunded); err != nil {
+			return err
+		}
+
+		// An extension still pending on the leave can no longer apply
+		if err := rejectPendingExtension(ctx, &leave, user.ID); err != nil {
+			return err
+		}
+
+		return publishLeaveEvent(ctx, events.LeaveRecalled, &leave, user.ID, []primitive.ObjectID{leave.Employee, leave.Reliever}, map[string]interface{}{
+			"returnDate":   returnDate,
+			"reason":       req.Reason,
+			"refundedDays": refunded,
+		})
+	})
+	if err == errLeaveChanged {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Leave was recalled, cancelled or changed by someone else, please reload",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to recall leave",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"message":      "Leave recalled successfully",
+		"refundedDays": refunded,
+		"recall":       recall,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrRequestChanged means a follow-up request was decided or moved on by
+// someone else since it was loaded
+var ErrRequestChanged = errors.New("request was updated by someone else")
+
+// errLeaveChanged means a leave was recalled, cancelled or cut short by
+// someone else since it was loaded, so its days may already be refunded
+var errLeaveChanged = errors.New("leave was changed by someone else")
+
+// buildRequestPath adapts a configured approval path to the employee, skipping
+// the HOD stage when the employee approves it for their own department and it
+// was not routed to a deputy, as routeApprovals does for the leave. A path
+// left empty by the skip goes to HR so the request is still reviewed.
+func buildRequestPath(ctx context.Context, configured []string, employee *models.User, leave *models.Leave) []string {
+	grants := middleware.UserGrants(ctx, employee)
+	path := []string{}
+	for _, stage := range configured {
+		if stage == "HOD" && approvesOwnStage(grants, employee, stage) && leave.HODDelegate.IsZero() {
+			continue
+		}
+		path = append(path, stage)
+	}
+	if len(path) == 0 && len(configured) > 0 {
+		path = append(path, "HR")
+	}
+	return path
+}
+
+// checkStageAuthority verifies that user may decide at stage: as its
+// delegated approver, or by holding one of the stage's permissions for the
+// employee's department
+func checkStageAuthority(ctx context.Context, leave *models.Leave, user *models.User, stage string) error {
+	delegate := stageDelegate(leave, stage)
+	if !delegate.IsZero() && delegate == user.ID {
+		return nil
+	}
+
+	perms := models.StagePermissions(stage)
+	if len(perms) == 0 {
+		return errors.New("Invalid approval stage")
+	}
+
+	grants := middleware.UserGrants(ctx, user)
+	if !grants.HasAny(perms...) {
+		return errors.New("Only " + stage + " approvers can act at this stage")
+	}
+
+	department, err := employeeDepartment(ctx, leave)
+	if err != nil {
+		return errors.New("Employee not found")
+	}
+	if !coversStage(grants, stage, department) {
+		return errors.New("You can only act on leave requests from your department")
+	}
+	return nil
+}
+
+// coversStage reports whether grants allow deciding leave from department at stage
+func coversStage(grants models.Grants, stage, department string) bool {
+	for _, perm := range models.StagePermissions(stage) {
+		if grants.Covers(perm, department) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequestSeparationOfDuties applies the separation-of-duties policy to a
+// follow-up request on leave, such as a cancellation or extension
+func checkRequestSeparationOfDuties(leave *models.Leave, workflow *models.RequestWorkflow, stage string, approverID primitive.ObjectID) error {
+	if leave.Employee == approverID {
+		return ErrSelfApproval
+	}
+
+	for _, step := range workflow.Approvals {
+		if step.Role != stage && step.Approver == approverID {
+			return ErrDuplicateStageActor
+		}
+	}
+
+	delegate := stageDelegate(leave, stage)
+	if !delegate.IsZero() && delegate != approverID {
+		return ErrStageDelegated
+	}
+
+	return nil
+}
@@ -0,0 +1,503 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/audit"
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// roleNamePattern is what custom role names may look like
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// AdminGetRoles lists roles and the permissions they can be made of (admin only)
+func AdminGetRoles(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.RolesCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch roles",
+		})
+		return
+	}
+	roles := []models.Role{}
+	if err := cursor.All(ctx, &roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode roles",
+		})
+		return
+	}
+
+	permissions := make([]gin.H, 0, len(models.Permissions))
+	for _, perm := range models.AllPermissions() {
+		permissions = append(permissions, gin.H{"permission": perm, "description": models.Permissions[perm]})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"roles":       roles,
+		"permissions": permissions,
+	})
+}
+
+// AdminCreateRole adds a custom role (admin only). Custom roles are granted
+// through role assignments; a user's primary role stays a built-in one.
+func AdminCreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if !roleNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Role names are 2 to 32 lowercase letters, digits, hyphens or underscores, starting with a letter",
+		})
+		return
+	}
+	permissions, ok := validPermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	role := models.Role{
+		ID:           primitive.NewObjectID(),
+		Name:         name,
+		Description:  strings.TrimSpace(req.Description),
+		Permissions:  permissions,
+		Departmental: req.Departmental,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if _, err := config.RolesCollection.InsertOne(ctx, role); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"message": "A role named '" + name + "' already exists",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to create role",
+		})
+		return
+	}
+	middleware.ClearRolesCache()
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditRoleCreated,
+		Actor:     adminID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"role": name, "permissions": permissions, "departmental": role.Departmental},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Role created",
+		"role":    role,
+	})
+}
+
+// AdminUpdateRole changes a role's description, permissions or scope (admin
+// only). The admin role always holds every permission and cannot be changed.
+func AdminUpdateRole(c *gin.Context) {
+	name := c.Param("name")
+	if name == models.AdminRole {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "The admin role always holds every permission",
+		})
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	updateFields := bson.M{"updatedAt": time.Now()}
+	details := map[string]interface{}{"role": name}
+	if req.Description != nil {
+		updateFields["description"] = strings.TrimSpace(*req.Description)
+	}
+	if req.Permissions != nil {
+		permissions, ok := validPermissions(c, req.Permissions)
+		if !ok {
+			return
+		}
+		updateFields["permissions"] = permissions
+		details["permissions"] = permissions
+	}
+	if req.Departmental != nil {
+		updateFields["departmental"] = *req.Departmental
+		details["departmental"] = *req.Departmental
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var role models.Role
+	err := config.RolesCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"name": name},
+		bson.M{"$set": updateFields},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Role not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update role",
+		})
+		return
+	}
+	middleware.ClearRolesCache()
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditRoleUpdated,
+		Actor:     adminID,
+		IPAddress: c.ClientIP(),
+		Details:   details,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role updated",
+		"role":    role,
+	})
+}
+
+// AdminDeleteRole deletes a custom role nobody holds (admin only)
+func AdminDeleteRole(c *gin.Context) {
+	name := c.Param("name")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var role models.Role
+	if err := config.RolesCollection.FindOne(ctx, bson.M{"name": name}).Decode(&role); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Role not found",
+		})
+		return
+	}
+	if role.System {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Built-in roles cannot be deleted",
+		})
+		return
+	}
+
+	holders, err := config.UsersCollection.CountDocuments(ctx, bson.M{"roleAssignments.role": name})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to check who holds the role",
+		})
+		return
+	}
+	if holders > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "The role is still assigned to users",
+			"users":   holders,
+		})
+		return
+	}
+
+	if _, err := config.RolesCollection.DeleteOne(ctx, bson.M{"_id": role.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete role",
+		})
+		return
+	}
+	middleware.ClearRolesCache()
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditRoleDeleted,
+		Actor:     adminID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"role": name},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role deleted",
+	})
+}
+
+// AdminGetUserRoles returns a user's roles and the permissions they add up
+// to (admin only)
+func AdminGetUserRoles(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := config.UsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+	if !checkDepartmentCovered(c, models.PermRoleManage, user.Department) {
+		return
+	}
+
+	assignments := user.RoleAssignments
+	if assignments == nil {
+		assignments = []models.RoleAssignment{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"role":        user.Role,
+		"department":  user.Department,
+		"assignments": assignments,
+		"permissions": middleware.UserGrants(ctx, &user).List(),
+	})
+}
+
+// AdminUpdateUserRoleAssignments replaces the roles a user holds on top of
+// their primary role (admin only). An assignment without a department covers
+// every department.
+func AdminUpdateUserRoleAssignments(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	var req models.UpdateRoleAssignmentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	target, ok := loadManagedUser(ctx, c, userID, models.PermRoleManage)
+	if !ok {
+		return
+	}
+
+	roles := middleware.GetRoles(ctx)
+	assignments := []models.RoleAssignment{}
+	seen := map[models.RoleAssignment]bool{}
+	for _, assignment := range req.Assignments {
+		if _, ok := roles[assignment.Role]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Unknown role '" + assignment.Role + "'",
+			})
+			return
+		}
+		if assignment.Department != "" {
+			department := models.CanonicalDepartment(assignment.Department)
+			if department == "" {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"message": "Invalid department '" + assignment.Department + "'",
+				})
+				return
+			}
+			assignment.Department = department
+		}
+		if !seen[assignment] {
+			seen[assignment] = true
+			assignments = append(assignments, assignment)
+		}
+	}
+
+	// Every assignment added or taken away must be one the admin could grant
+	held := map[models.RoleAssignment]bool{}
+	for _, assignment := range target.RoleAssignments {
+		held[assignment] = true
+		if !seen[assignment] && !checkRoleGrant(c, roles, assignment.Role, assignment.Department) {
+			return
+		}
+	}
+	for _, assignment := range assignments {
+		if !held[assignment] && !checkRoleGrant(c, roles, assignment.Role, assignment.Department) {
+			return
+		}
+	}
+
+	sort.Slice(assignments, func(i, j int) bool {
+		if assignments[i].Role != assignments[j].Role {
+			return assignments[i].Role < assignments[j].Role
+		}
+		return assignments[i].Department < assignments[j].Department
+	})
+
+	var user models.User
+	err = config.UsersCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"roleAssignments": assignments, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update role assignments",
+		})
+		return
+	}
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditRolesAssigned,
+		Actor:     adminID,
+		Target:    userID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"assignments": assignments},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "Role assignments updated",
+		"assignments": assignments,
+		"permissions": middleware.UserGrants(ctx, &user).List(),
+	})
+}
+
+// validPermissions checks and de-duplicates requested permissions, writing
+// an error response and returning false if any is unknown or is not held by
+// the admin over every department, since a role can be granted anywhere
+func validPermissions(c *gin.Context, requested []string) ([]string, bool) {
+	grants := middleware.GetCurrentGrants(c)
+	permissions := []string{}
+	seen := map[string]bool{}
+	for _, perm := range requested {
+		if !models.IsValidPermission(perm) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Unknown permission '" + perm + "'",
+			})
+			return nil, false
+		}
+		if !canHandOut(grants, perm, "") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "You cannot give a role the '" + perm + "' permission without holding it yourself",
+			})
+			return nil, false
+		}
+		if !seen[perm] {
+			seen[perm] = true
+			permissions = append(permissions, perm)
+		}
+	}
+	sort.Strings(permissions)
+	return permissions, true
+}
+
+// checkRoleGrant checks that the current user may give or take away role
+// name over department ("" for every department), writing a 403 response
+// when they may not. Only role managers change roles, and only roles whose
+// permissions they hold there themselves; a role that carries no
+// permissions, such as employee, is open to whoever manages the user.
+func checkRoleGrant(c *gin.Context, roles map[string]models.Role, name, department string) bool {
+	perms := middleware.RolePermissions(roles, name)
+	if len(perms) == 0 {
+		return true
+	}
+
+	grants := middleware.GetCurrentGrants(c)
+	if !grants.Covers(models.PermRoleManage, department) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Missing permission '" + models.PermRoleManage + "'",
+		})
+		return false
+	}
+	for _, perm := range perms {
+		if !canHandOut(grants, perm, department) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "You cannot grant the '" + name + "' role without holding all of its permissions",
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// canHandOut reports whether grants allow passing perm on over department:
+// by holding it there, or for leave.approve.hod, which only takes effect for
+// users a role manager has flagged as heads of department, by managing roles
+func canHandOut(grants models.Grants, perm, department string) bool {
+	if perm == models.PermLeaveApproveHOD {
+		return grants.Covers(models.PermRoleManage, department)
+	}
+	return grants.Covers(perm, department)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flowkit/backend/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminGetJobs lists the scheduled jobs with their state (admin only)
+func AdminGetJobs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	jobs, err := scheduler.Jobs(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch jobs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"count":   len(jobs),
+		"jobs":    jobs,
+	})
+}
+
+// AdminGetJobRuns returns a job's run history, newest first (admin only).
+// Supports ?limit=N (default 50, max 200).
+func AdminGetJobRuns(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runs, err := scheduler.Runs(ctx, c.Param("name"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch job runs",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"count":   len(runs),
+		"runs":    runs,
+	})
+}
+
+// AdminTriggerJob runs a job as soon as possible, even if it is paused (admin only)
+func AdminTriggerJob(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found, err := scheduler.Trigger(ctx, c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to trigger job",
+		})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "Job queued to run",
+	})
+}
+
+// AdminPauseJob stops a job's schedule (admin only)
+func AdminPauseJob(c *gin.Context) {
+	setJobPaused(c, true)
+}
+
+// AdminResumeJob restarts a paused job's schedule (admin only)
+func AdminResumeJob(c *gin.Context) {
+	setJobPaused(c, false)
+}
+
+// setJobPaused pauses or resumes the job named in the URL
+func setJobPaused(c *gin.Context, paused bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found, err := scheduler.SetPaused(ctx, c.Param("name"), paused)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update job",
+		})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Job not found",
+		})
+		return
+	}
+
+	message := "Job resumed"
+	if paused {
+		message = "Job paused"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+	})
+}
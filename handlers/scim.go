@@ -0,0 +1,702 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/audit"
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/oidc"
+	"github.com/flowkit/backend/scim"
+	"github.com/flowkit/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+var (
+	scimUserPrefix       = strings.ToLower(scim.SchemaUser) + ":"
+	scimEnterprisePrefix = strings.ToLower(scim.SchemaEnterpriseUser) + ":"
+
+	// scimMatchNone is a query no user matches
+	scimMatchNone = bson.M{"_id": bson.M{"$exists": false}}
+)
+
+// scimJSON writes a SCIM response
+func scimJSON(c *gin.Context, status int, v interface{}) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, v)
+}
+
+// scimFail writes a SCIM error response. Errors that are not SCIM errors
+// are reported as server errors with detail as the message.
+func scimFail(c *gin.Context, err error, detail string) {
+	var scimErr *scim.Error
+	if !errors.As(err, &scimErr) {
+		if err != nil {
+			log.Printf("⚠️  SCIM: %s: %v", detail, err)
+		}
+		scimErr = scim.NewError(http.StatusInternalServerError, "", detail)
+	}
+	scimJSON(c, scimErr.StatusCode(), scimErr)
+}
+
+// scimBind decodes a SCIM request body into v
+func scimBind(c *gin.Context, v interface{}) error {
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		var scimErr *scim.Error
+		if errors.As(err, &scimErr) {
+			return scimErr
+		}
+		return scim.BadRequest(scim.ErrInvalidSyntax, "Invalid request body")
+	}
+	return nil
+}
+
+// scimLocation returns the absolute URL of a SCIM resource
+func scimLocation(c *gin.Context, path string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + "/scim/v2/" + path
+}
+
+// scimAttr normalises an attribute path: lower case, without the core or
+// enterprise schema URN in front
+func scimAttr(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	path = strings.TrimPrefix(path, scimUserPrefix)
+	return strings.TrimPrefix(path, scimEnterprisePrefix)
+}
+
+// scimUserResource represents a user as a SCIM User. Every account has a
+// single work email, used as the userName, and belongs to the one group
+// named after its role.
+func scimUserResource(c *gin.Context, user *models.User) scim.User {
+	id := user.ID.Hex()
+	displayName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	return scim.User{
+		Schemas:    []string{scim.SchemaUser, scim.SchemaEnterpriseUser},
+		ID:         id,
+		ExternalID: user.ExternalID,
+		UserName:   user.Email,
+		Name: &scim.Name{
+			Formatted:  displayName,
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		DisplayName: displayName,
+		Emails:      []scim.MultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      scim.NewBoolean(user.IsActive),
+		Roles:       []scim.MultiValue{{Value: user.Role, Primary: true}},
+		Groups:      []scim.MultiValue{{Value: user.Role, Display: user.Role, Ref: scimLocation(c, "Groups/"+user.Role)}},
+		Enterprise: &scim.EnterpriseUser{
+			EmployeeNumber: user.StaffID,
+			Department:     user.Department,
+		},
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt.UTC().Format(time.RFC3339),
+			LastModified: user.UpdatedAt.UTC().Format(time.RFC3339),
+			Location:     scimLocation(c, "Users/"+id),
+		},
+	}
+}
+
+// scimUserFilter translates a filter comparison on a User attribute into
+// a condition on the users collection
+func scimUserFilter(attr, op string, value interface{}) (bson.M, error) {
+	switch scimAttr(attr) {
+	case "id":
+		if op == "pr" {
+			return bson.M{}, nil
+		}
+		s, _ := value.(string)
+		id, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return scimMatchNone, nil
+		}
+		return scim.Compare("_id", op, id, true)
+	case "username", "emails", "emails.value":
+		return scim.Compare("email", op, value, false)
+	case "emails.type":
+		// The only address is the work email
+		if op == "pr" || (op == "eq" && strings.EqualFold(fmt.Sprint(value), "work")) {
+			return bson.M{}, nil
+		}
+		return scimMatchNone, nil
+	case "externalid":
+		return scim.Compare("externalId", op, value, true)
+	case "name.givenname":
+		return scim.Compare("firstName", op, value, false)
+	case "name.familyname":
+		return scim.Compare("lastName", op, value, false)
+	case "active":
+		if op == "pr" {
+			return bson.M{}, nil
+		}
+		active, ok := scim.Bool(value)
+		if !ok {
+			return nil, scim.BadRequest(scim.ErrInvalidFilter, "active needs a boolean value")
+		}
+		return scim.Compare("isActive", op, active, true)
+	case "roles", "roles.value", "groups", "groups.value", "groups.display":
+		return scim.Compare("role", op, value, false)
+	case "department":
+		return scim.Compare("department", op, value, false)
+	case "employeenumber":
+		return scim.Compare("staffId", op, value, false)
+	case "meta.created":
+		return scim.Compare("createdAt", op, value, true)
+	case "meta.lastmodified":
+		return scim.Compare("updatedAt", op, value, true)
+	}
+	return nil, scim.BadRequest(scim.ErrInvalidFilter, "Filtering on %q is not supported", attr)
+}
+
+// SCIMGetUsers lists users, optionally filtered, a page at a time
+func SCIMGetUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if expr := c.Query("filter"); expr != "" {
+		parsed, err := scim.ParseFilter(expr)
+		if err != nil {
+			scimFail(c, err, "Invalid filter")
+			return
+		}
+		if filter, err = parsed.Mongo(scimUserFilter); err != nil {
+			scimFail(c, err, "Invalid filter")
+			return
+		}
+	}
+	start, count := scim.Pagination(c.Query("startIndex"), c.Query("count"), scimDefaultCount, scimMaxCount)
+
+	total, err := config.UsersCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		scimFail(c, err, "Failed to count users")
+		return
+	}
+
+	resources := []interface{}{}
+	if count > 0 {
+		opts := options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+			SetSkip(start - 1).
+			SetLimit(count)
+		cursor, err := config.UsersCollection.Find(ctx, filter, opts)
+		if err != nil {
+			scimFail(c, err, "Failed to fetch users")
+			return
+		}
+		var users []models.User
+		if err := cursor.All(ctx, &users); err != nil {
+			scimFail(c, err, "Failed to decode users")
+			return
+		}
+		for i := range users {
+			resources = append(resources, scimUserResource(c, &users[i]))
+		}
+	}
+
+	scimJSON(c, http.StatusOK, scim.NewListResponse(resources, total, start))
+}
+
+// scimFindUser loads the user named in the URL, writing a 404 when there is none
+func scimFindUser(ctx context.Context, c *gin.Context) (*models.User, bool) {
+	notFound := scim.NewError(http.StatusNotFound, "", "User not found")
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		scimFail(c, notFound, "")
+		return nil, false
+	}
+
+	var user models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		scimFail(c, notFound, "")
+		return nil, false
+	}
+	if err != nil {
+		scimFail(c, err, "Failed to fetch user")
+		return nil, false
+	}
+	return &user, true
+}
+
+// SCIMGetUser returns one user
+func SCIMGetUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := scimFindUser(ctx, c)
+	if !ok {
+		return
+	}
+	scimJSON(c, http.StatusOK, scimUserResource(c, user))
+}
+
+// SCIMCreateUser provisions a user. Accounts get an unusable random
+// password and sign in through single sign-on until the user sets one with
+// a password reset. Without a department the account goes to
+// SCIM_DEFAULT_DEPARTMENT.
+func SCIMCreateUser(c *gin.Context) {
+	var resource scim.User
+	if err := scimBind(c, &resource); err != nil {
+		scimFail(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	user := models.User{
+		ID:   primitive.NewObjectID(),
+		Role: "employee",
+		LeaveBalance: models.LeaveBalance{
+			Total:     28,
+			Available: 28,
+			Used:      0,
+		},
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := applySCIMUser(ctx, &user, resource); err != nil {
+		scimFail(c, err, "Failed to provision user")
+		return
+	}
+
+	password, err := oidc.RandomString()
+	if err != nil {
+		scimFail(c, err, "Failed to provision user")
+		return
+	}
+	if user.Password, err = utils.HashPassword(password); err != nil {
+		scimFail(c, err, "Failed to provision user")
+		return
+	}
+	if user.StaffID == "" {
+		if user.StaffID, err = utils.GenerateStaffID(ctx); err != nil {
+			scimFail(c, err, "Failed to generate staff ID")
+			return
+		}
+	}
+
+	if _, err := config.UsersCollection.InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			err = scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A user with these details already exists")
+		}
+		scimFail(c, err, "Failed to provision user")
+		return
+	}
+
+	audit.Record(ctx, models.AuditLog{
+		Action:    models.AuditUserProvisioned,
+		Target:    user.ID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"source": "scim", "email": user.Email, "department": user.Department, "role": user.Role},
+	})
+
+	resourceOut := scimUserResource(c, &user)
+	c.Header("Location", resourceOut.Meta.Location)
+	scimJSON(c, http.StatusCreated, resourceOut)
+}
+
+// SCIMReplaceUser replaces a user's attributes. Attributes left out of the
+// request keep their value where the account needs one: department, role,
+// employee number and active.
+func SCIMReplaceUser(c *gin.Context) {
+	var resource scim.User
+	if err := scimBind(c, &resource); err != nil {
+		scimFail(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := scimFindUser(ctx, c)
+	if !ok {
+		return
+	}
+	wasActive := user.IsActive
+	if resource.Name == nil {
+		user.FirstName, user.LastName = "", ""
+	}
+	if err := applySCIMUser(ctx, user, resource); err != nil {
+		scimFail(c, err, "Failed to update user")
+		return
+	}
+	if err := saveSCIMUser(ctx, c, user, wasActive); err != nil {
+		scimFail(c, err, "Failed to update user")
+		return
+	}
+	scimJSON(c, http.StatusOK, scimUserResource(c, user))
+}
+
+// SCIMPatchUser applies a list of add, replace and remove operations to a
+// user. Attributes FlowKit does not store are ignored.
+func SCIMPatchUser(c *gin.Context) {
+	var patch scim.PatchRequest
+	if err := scimBind(c, &patch); err != nil {
+		scimFail(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := scimFindUser(ctx, c)
+	if !ok {
+		return
+	}
+	wasActive := user.IsActive
+
+	resource := scimUserResource(c, user)
+	for _, op := range patch.Operations {
+		if err := patchSCIMUser(&resource, op); err != nil {
+			scimFail(c, err, "")
+			return
+		}
+	}
+	if err := applySCIMUser(ctx, user, resource); err != nil {
+		scimFail(c, err, "Failed to update user")
+		return
+	}
+	if err := saveSCIMUser(ctx, c, user, wasActive); err != nil {
+		scimFail(c, err, "Failed to update user")
+		return
+	}
+	scimJSON(c, http.StatusOK, scimUserResource(c, user))
+}
+
+// SCIMDeleteUser deprovisions a user. The account is deactivated rather
+// than deleted so its leave history is kept.
+func SCIMDeleteUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := scimFindUser(ctx, c)
+	if !ok {
+		return
+	}
+	if user.IsActive {
+		wasActive := user.IsActive
+		user.IsActive = false
+		if err := saveSCIMUser(ctx, c, user, wasActive); err != nil {
+			scimFail(c, err, "Failed to deprovision user")
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// applySCIMUser copies the attributes of a SCIM User onto user, checking
+// them as it goes
+func applySCIMUser(ctx context.Context, user *models.User, resource scim.User) error {
+	email := strings.TrimSpace(resource.UserName)
+	if primary, ok := scim.Primary(resource.Emails); ok && email == "" {
+		email = strings.TrimSpace(primary.Value)
+	}
+	if email == "" {
+		return scim.BadRequest(scim.ErrInvalidValue, "userName is required")
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return scim.BadRequest(scim.ErrInvalidValue, "userName must be an email address")
+	}
+	if !strings.EqualFold(email, user.Email) {
+		existing, err := findUserByEmail(ctx, email)
+		if err == nil && existing.ID != user.ID {
+			return scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A user with this userName already exists")
+		}
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+	}
+	user.Email = email
+
+	if resource.Name != nil {
+		user.FirstName = strings.TrimSpace(resource.Name.GivenName)
+		user.LastName = strings.TrimSpace(resource.Name.FamilyName)
+	}
+	if user.FirstName == "" {
+		name := strings.Fields(resource.DisplayName)
+		if resource.Name != nil && resource.Name.Formatted != "" {
+			name = strings.Fields(resource.Name.Formatted)
+		}
+		switch {
+		case len(name) > 1:
+			user.FirstName, user.LastName = strings.Join(name[:len(name)-1], " "), name[len(name)-1]
+		case len(name) == 1:
+			user.FirstName = name[0]
+		default:
+			user.FirstName = strings.SplitN(email, "@", 2)[0]
+		}
+	}
+
+	user.ExternalID = strings.TrimSpace(resource.ExternalID)
+	if resource.Active != nil {
+		user.IsActive = bool(*resource.Active)
+	}
+
+	if resource.Roles != nil {
+		values := make([]string, 0, len(resource.Roles))
+		for _, role := range resource.Roles {
+			value := strings.ToLower(strings.TrimSpace(role.Value))
+			if !models.IsValidRole(value) {
+				return scim.BadRequest(scim.ErrInvalidValue, "Unknown role %q", role.Value)
+			}
+			values = append(values, value)
+		}
+		user.Role = models.HighestRole(values)
+		if user.Role == "" {
+			user.Role = "employee"
+		}
+	}
+
+	if resource.Enterprise != nil {
+		if resource.Enterprise.Department != "" {
+			department := models.CanonicalDepartment(resource.Enterprise.Department)
+			if department == "" {
+				return scim.BadRequest(scim.ErrInvalidValue, "Unknown department %q", resource.Enterprise.Department)
+			}
+			user.Department = department
+		}
+		if staffID := strings.TrimSpace(resource.Enterprise.EmployeeNumber); staffID != "" {
+			user.StaffID = staffID
+		}
+	}
+	if user.Department == "" {
+		user.Department = models.CanonicalDepartment(os.Getenv("SCIM_DEFAULT_DEPARTMENT"))
+		if user.Department == "" {
+			return scim.BadRequest(scim.ErrInvalidValue, "A department is required")
+		}
+	}
+	return nil
+}
+
+// saveSCIMUser stores the SCIM-managed attributes of user. Deactivating an
+// account signs it out everywhere.
+func saveSCIMUser(ctx context.Context, c *gin.Context, user *models.User, wasActive bool) error {
+	user.UpdatedAt = time.Now()
+	_, err := config.UsersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"email":      user.Email,
+		"firstName":  user.FirstName,
+		"lastName":   user.LastName,
+		"externalId": user.ExternalID,
+		"staffId":    user.StaffID,
+		"department": user.Department,
+		"role":       user.Role,
+		"isActive":   user.IsActive,
+		"updatedAt":  user.UpdatedAt,
+	}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A user with these details already exists")
+		}
+		return err
+	}
+
+	if wasActive && !user.IsActive {
+		if _, err := middleware.RevokeUserSessions(ctx, user.ID, primitive.NilObjectID, "deprovisioned"); err != nil {
+			log.Printf("⚠️  Failed to revoke sessions of deprovisioned user %s: %v", user.ID.Hex(), err)
+		}
+		audit.Record(ctx, models.AuditLog{
+			Action:    models.AuditUserDeprovisioned,
+			Target:    user.ID,
+			IPAddress: c.ClientIP(),
+			Details:   map[string]interface{}{"source": "scim", "email": user.Email},
+		})
+	}
+	return nil
+}
+
+// patchSCIMUser applies one PATCH operation to a SCIM User
+func patchSCIMUser(resource *scim.User, op scim.PatchOperation) error {
+	switch op.NormalizedOp() {
+	case "add", "replace":
+		if op.Path == "" {
+			// Without a path the value holds the attributes to set
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return scim.BadRequest(scim.ErrInvalidValue, "value must be an object when no path is given")
+			}
+			for attr, value := range values {
+				if err := setSCIMUserAttr(resource, attr, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return setSCIMUserAttr(resource, op.Path, op.Value)
+	case "remove":
+		if op.Path == "" {
+			return scim.BadRequest(scim.ErrNoTarget, "remove needs a path")
+		}
+		return removeSCIMUserAttr(resource, op.Path)
+	}
+	return scim.BadRequest(scim.ErrInvalidSyntax, "Unknown operation %q", op.Op)
+}
+
+// scimPatchAttr normalises a PATCH path. Value filters such as
+// emails[type eq "work"].value are dropped, since every multi-valued
+// attribute FlowKit maps holds a single value.
+func scimPatchAttr(path string) (string, error) {
+	attr := scimAttr(path)
+	if i := strings.Index(attr, "["); i >= 0 {
+		j := strings.LastIndex(attr, "]")
+		if j < i {
+			return "", scim.BadRequest(scim.ErrInvalidPath, "Invalid path %q", path)
+		}
+		attr = attr[:i] + attr[j+1:]
+	}
+	return attr, nil
+}
+
+// setSCIMUserAttr sets the attribute at path
+func setSCIMUserAttr(resource *scim.User, path string, value json.RawMessage) error {
+	attr, err := scimPatchAttr(path)
+	if err != nil {
+		return err
+	}
+
+	invalid := scim.BadRequest(scim.ErrInvalidValue, "Invalid value for %s", path)
+	str := func(target *string) error {
+		var s *string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return invalid
+		}
+		*target = ""
+		if s != nil {
+			*target = *s
+		}
+		return nil
+	}
+	if resource.Name == nil {
+		resource.Name = &scim.Name{}
+	}
+	if resource.Enterprise == nil {
+		resource.Enterprise = &scim.EnterpriseUser{}
+	}
+
+	switch attr {
+	case "name", strings.TrimSuffix(scimEnterprisePrefix, ":"):
+		// Complex values set their sub-attributes
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(value, &values); err != nil {
+			return invalid
+		}
+		prefix := ""
+		if attr == "name" {
+			prefix = "name."
+		}
+		for sub, subValue := range values {
+			if err := setSCIMUserAttr(resource, prefix+sub, subValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "username", "emails.value":
+		return str(&resource.UserName)
+	case "emails":
+		var emails []scim.MultiValue
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return invalid
+		}
+		if primary, ok := scim.Primary(emails); ok {
+			resource.UserName = primary.Value
+		}
+		return nil
+	case "name.givenname":
+		return str(&resource.Name.GivenName)
+	case "name.familyname":
+		return str(&resource.Name.FamilyName)
+	case "name.formatted":
+		return str(&resource.Name.Formatted)
+	case "displayname":
+		return str(&resource.DisplayName)
+	case "externalid":
+		return str(&resource.ExternalID)
+	case "active":
+		var active scim.Boolean
+		if err := json.Unmarshal(value, &active); err != nil {
+			return invalid
+		}
+		resource.Active = &active
+		return nil
+	case "roles":
+		// Providers send either a list of roles or a single one
+		var roles []scim.MultiValue
+		if err := json.Unmarshal(value, &roles); err != nil {
+			var role scim.MultiValue
+			if err := json.Unmarshal(value, &role); err != nil {
+				return invalid
+			}
+			roles = []scim.MultiValue{role}
+		}
+		resource.Roles = roles
+		return nil
+	case "roles.value":
+		var role string
+		if err := str(&role); err != nil {
+			return err
+		}
+		resource.Roles = []scim.MultiValue{{Value: role}}
+		return nil
+	case "department":
+		return str(&resource.Enterprise.Department)
+	case "employeenumber":
+		return str(&resource.Enterprise.EmployeeNumber)
+	}
+	// Other attributes, such as phone numbers and addresses, are not stored
+	return nil
+}
+
+// removeSCIMUserAttr clears the attribute at path
+func removeSCIMUserAttr(resource *scim.User, path string) error {
+	attr, err := scimPatchAttr(path)
+	if err != nil {
+		return err
+	}
+
+	switch attr {
+	case "username", "emails", "emails.value", "active", "department", "employeenumber":
+		return scim.BadRequest(scim.ErrMutability, "%s is required and cannot be removed", path)
+	case "externalid":
+		resource.ExternalID = ""
+	case "name":
+		resource.Name = &scim.Name{}
+	case "name.givenname":
+		resource.Name.GivenName = ""
+	case "name.familyname":
+		resource.Name.FamilyName = ""
+	case "roles", "roles.value":
+		// Users without a role are employees
+		resource.Roles = []scim.MultiValue{}
+	}
+	return nil
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/scim"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// scimGroupResource represents a role as a SCIM Group. There is one group
+// per role, named after it, whose members are the users holding the role.
+// Adding a user to a group gives them the role and removing them makes them
+// an employee.
+func scimGroupResource(c *gin.Context, role string, members []models.User) scim.Group {
+	group := scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          role,
+		DisplayName: role,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Location:     scimLocation(c, "Groups/"+role),
+		},
+	}
+	for _, user := range members {
+		group.Members = append(group.Members, scim.MultiValue{
+			Value:   user.ID.Hex(),
+			Display: user.Email,
+			Ref:     scimLocation(c, "Users/"+user.ID.Hex()),
+		})
+	}
+	return group
+}
+
+// scimGroupMembers returns the users holding role
+func scimGroupMembers(ctx context.Context, role string) ([]models.User, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"_id": 1, "email": 1})
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{"role": role}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// scimWantsMembers reports whether the response should list members, which
+// providers skip with excludedAttributes=members on large directories
+func scimWantsMembers(c *gin.Context) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if scimAttr(attr) == "members" {
+			return false
+		}
+	}
+	return true
+}
+
+// SCIMGetGroups lists the role groups, optionally filtered
+func SCIMGetGroups(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var filter *scim.Filter
+	if expr := c.Query("filter"); expr != "" {
+		var err error
+		if filter, err = scim.ParseFilter(expr); err != nil {
+			scimFail(c, err, "Invalid filter")
+			return
+		}
+	}
+	start, count := scim.Pagination(c.Query("startIndex"), c.Query("count"), scimDefaultCount, scimMaxCount)
+
+	wantsMembers := scimWantsMembers(c)
+	var matched []scim.Group
+	for _, role := range models.ValidRoles {
+		var members []models.User
+		if wantsMembers || filter != nil {
+			var err error
+			if members, err = scimGroupMembers(ctx, role); err != nil {
+				scimFail(c, err, "Failed to fetch group members")
+				return
+			}
+		}
+		group := scimGroupResource(c, role, members)
+
+		if filter != nil && !filter.Matches(func(attr string) []string {
+			switch scimAttr(attr) {
+			case "id", "displayname":
+				return []string{role}
+			case "members", "members.value":
+				values := make([]string, 0, len(group.Members))
+				for _, member := range group.Members {
+					values = append(values, member.Value)
+				}
+				return values
+			case "members.display":
+				values := make([]string, 0, len(group.Members))
+				for _, member := range group.Members {
+					values = append(values, member.Display)
+				}
+				return values
+			}
+			return nil
+		}) {
+			continue
+		}
+
+		if !wantsMembers {
+			group.Members = nil
+		}
+		matched = append(matched, group)
+	}
+
+	resources := []interface{}{}
+	for i := start - 1; i < int64(len(matched)) && int64(len(resources)) < count; i++ {
+		resources = append(resources, matched[i])
+	}
+	scimJSON(c, http.StatusOK, scim.NewListResponse(resources, int64(len(matched)), start))
+}
+
+// scimFindGroup resolves the group named in the URL, writing a 404 when
+// there is no such role
+func scimFindGroup(c *gin.Context) (string, bool) {
+	role := c.Param("id")
+	if !models.IsValidRole(role) {
+		scimFail(c, scim.NewError(http.StatusNotFound, "", "Group not found"), "")
+		return "", false
+	}
+	return role, true
+}
+
+// SCIMGetGroup returns one role group
+func SCIMGetGroup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, ok := scimFindGroup(c)
+	if !ok {
+		return
+	}
+	writeSCIMGroup(ctx, c, role)
+}
+
+// writeSCIMGroup responds with the current state of a role group
+func writeSCIMGroup(ctx context.Context, c *gin.Context, role string) {
+	var members []models.User
+	if scimWantsMembers(c) {
+		var err error
+		if members, err = scimGroupMembers(ctx, role); err != nil {
+			scimFail(c, err, "Failed to fetch group members")
+			return
+		}
+	}
+	scimJSON(c, http.StatusOK, scimGroupResource(c, role, members))
+}
+
+// SCIMReplaceGroup sets the members of a role group. Users dropped from the
+// group become employees.
+func SCIMReplaceGroup(c *gin.Context) {
+	var group scim.Group
+	if err := scimBind(c, &group); err != nil {
+		scimFail(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, ok := scimFindGroup(c)
+	if !ok {
+		return
+	}
+	if group.DisplayName != "" && group.DisplayName != role {
+		scimFail(c, scim.BadRequest(scim.ErrMutability, "Groups cannot be renamed"), "")
+		return
+	}
+	if err := setSCIMGroupMembers(ctx, role, group.Members, true); err != nil {
+		scimFail(c, err, "Failed to update group")
+		return
+	}
+	writeSCIMGroup(ctx, c, role)
+}
+
+// SCIMPatchGroup adds members to, removes members from or replaces the
+// members of a role group
+func SCIMPatchGroup(c *gin.Context) {
+	var patch scim.PatchRequest
+	if err := scimBind(c, &patch); err != nil {
+		scimFail(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, ok := scimFindGroup(c)
+	if !ok {
+		return
+	}
+
+	for _, op := range patch.Operations {
+		if err := patchSCIMGroup(ctx, role, op); err != nil {
+			scimFail(c, err, "Failed to update group")
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// patchSCIMGroup applies one PATCH operation to a role group
+func patchSCIMGroup(ctx context.Context, role string, op scim.PatchOperation) error {
+	path := scimAttr(op.Path)
+	opName := op.NormalizedOp()
+
+	// Without a path the value holds the attributes to set
+	if path == "" && opName != "remove" {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return scim.BadRequest(scim.ErrInvalidValue, "value must be an object when no path is given")
+		}
+		for attr, value := range values {
+			sub := scim.PatchOperation{Op: op.Op, Path: attr, Value: value}
+			if err := patchSCIMGroup(ctx, role, sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case path == "displayname" || path == "id":
+		var name string
+		if json.Unmarshal(op.Value, &name) == nil && name == role {
+			return nil
+		}
+		return scim.BadRequest(scim.ErrMutability, "Groups cannot be renamed")
+	case path == "externalid":
+		// Groups are fixed to roles, so there is nothing to link
+		return nil
+	case path != "members" && !strings.HasPrefix(path, "members["):
+		return scim.BadRequest(scim.ErrInvalidPath, "Unsupported path %q", op.Path)
+	}
+
+	switch opName {
+	case "add", "replace":
+		var members []scim.MultiValue
+		if err := json.Unmarshal(op.Value, &members); err != nil {
+			return scim.BadRequest(scim.ErrInvalidValue, "members must be a list")
+		}
+		return setSCIMGroupMembers(ctx, role, members, opName == "replace")
+	case "remove":
+		if path == "members" {
+			// Either the members listed in the value, or everyone
+			var members []scim.MultiValue
+			if len(op.Value) > 0 {
+				if err := json.Unmarshal(op.Value, &members); err != nil {
+					return scim.BadRequest(scim.ErrInvalidValue, "members must be a list")
+				}
+			}
+			if members == nil {
+				return removeSCIMGroupMembers(ctx, role, bson.M{})
+			}
+			ids, err := scimMemberIDs(members)
+			if err != nil {
+				return err
+			}
+			return removeSCIMGroupMembers(ctx, role, bson.M{"_id": bson.M{"$in": ids}})
+		}
+
+		// members[value eq "..."]
+		filter, err := scim.ParseFilter(op.Path)
+		if err != nil {
+			return scim.BadRequest(scim.ErrInvalidPath, "Invalid path %q", op.Path)
+		}
+		query, err := filter.Mongo(func(attr, cmp string, value interface{}) (bson.M, error) {
+			if attr != "members.value" {
+				return nil, scim.BadRequest(scim.ErrInvalidPath, "Members can only be selected by value")
+			}
+			s, _ := value.(string)
+			id, err := primitive.ObjectIDFromHex(s)
+			if err != nil {
+				return scimMatchNone, nil
+			}
+			return scim.Compare("_id", cmp, id, true)
+		})
+		if err != nil {
+			return err
+		}
+		return removeSCIMGroupMembers(ctx, role, query)
+	}
+	return scim.BadRequest(scim.ErrInvalidSyntax, "Unknown operation %q", op.Op)
+}
+
+// scimMemberIDs reads the user IDs of a member list
+func scimMemberIDs(members []scim.MultiValue) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(members))
+	for _, member := range members {
+		id, err := primitive.ObjectIDFromHex(member.Value)
+		if err != nil {
+			return nil, scim.BadRequest(scim.ErrInvalidValue, "Unknown member %q", member.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// setSCIMGroupMembers gives the listed users role. With replace, members
+// of the group who are not listed become employees.
+func setSCIMGroupMembers(ctx context.Context, role string, members []scim.MultiValue, replace bool) error {
+	ids, err := scimMemberIDs(members)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		found, err := config.UsersCollection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		if found < int64(len(uniqueObjectIDs(ids))) {
+			return scim.BadRequest(scim.ErrInvalidValue, "Some members are not users")
+		}
+		_, err = config.UsersCollection.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": ids}, "role": bson.M{"$ne": role}},
+			bson.M{"$set": bson.M{"role": role, "updatedAt": time.Now()}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if replace {
+		return removeSCIMGroupMembers(ctx, role, bson.M{"_id": bson.M{"$nin": ids}})
+	}
+	return nil
+}
+
+// removeSCIMGroupMembers makes the members of role matching filter employees
+func removeSCIMGroupMembers(ctx context.Context, role string, filter bson.M) error {
+	// Everyone is at least an employee
+	if role == "employee" {
+		return nil
+	}
+	query := bson.M{"role": role}
+	for k, v := range filter {
+		query[k] = v
+	}
+	_, err := config.UsersCollection.UpdateMany(ctx, query, bson.M{"$set": bson.M{"role": "employee", "updatedAt": time.Now()}})
+	return err
+}
+
+// uniqueObjectIDs drops repeated IDs
+func uniqueObjectIDs(ids []primitive.ObjectID) []primitive.ObjectID {
+	seen := map[primitive.ObjectID]bool{}
+	unique := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// SCIMGroupsReadOnly rejects creating and deleting groups, which are fixed to the roles
+func SCIMGroupsReadOnly(c *gin.Context) {
+	scimFail(c, scim.NewError(http.StatusForbidden, scim.ErrMutability, "Groups are FlowKit's roles and cannot be created or deleted"), "")
+}
+
+// SCIMServiceProviderConfig describes the SCIM features this server supports
+func SCIMServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token set in SCIM_BEARER_TOKEN",
+			"primary":     true,
+		}},
+		"meta": gin.H{
+			"resourceType": "ServiceProviderConfig",
+			"location":     scimLocation(c, "ServiceProviderConfig"),
+		},
+	})
+}
+
+// SCIMResourceTypes lists the resource types this server serves
+func SCIMResourceTypes(c *gin.Context) {
+	resources := []interface{}{
+		gin.H{
+			"schemas":          []string{scim.SchemaResourceType},
+			"id":               "User",
+			"name":             "User",
+			"endpoint":         "/Users",
+			"schema":           scim.SchemaUser,
+			"schemaExtensions": []gin.H{{"schema": scim.SchemaEnterpriseUser, "required": false}},
+			"meta":             gin.H{"resourceType": "ResourceType", "location": scimLocation(c, "ResourceTypes/User")},
+		},
+		gin.H{
+			"schemas":  []string{scim.SchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   scim.SchemaGroup,
+			"meta":     gin.H{"resourceType": "ResourceType", "location": scimLocation(c, "ResourceTypes/Group")},
+		},
+	}
+	scimJSON(c, http.StatusOK, scim.NewListResponse(resources, int64(len(resources)), 1))
+}
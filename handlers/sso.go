@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/audit"
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/oidc"
+	"github.com/flowkit/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	oidcLoginTTL    = 10 * time.Minute // How long the user has to sign in at the provider
+	oidcStateCookie = "flowkit_oidc_state"
+)
+
+// Single sign-on failures, sent back to the frontend as error codes
+var (
+	errSSOEmailUnverified  = errors.New("email_not_verified")
+	errSSONoAccount        = errors.New("account_not_found")
+	errSSODeactivated      = errors.New("account_deactivated")
+	errSSOIdentityMismatch = errors.New("identity_mismatch")
+	errSSONoDepartment     = errors.New("department_not_found")
+	errSSOExpired          = errors.New("sso_expired")
+)
+
+// ssoErrorMessages explains each single sign-on failure to the user
+var ssoErrorMessages = map[error]string{
+	errSSOEmailUnverified:  "Your identity provider has not verified your email address.",
+	errSSONoAccount:        "No FlowKit account exists for your email address. Please contact administrator.",
+	errSSODeactivated:      "Account has been deactivated. Please contact administrator.",
+	errSSOIdentityMismatch: "This FlowKit account is linked to a different corporate identity.",
+	errSSONoDepartment:     "Your department could not be determined. Please contact administrator.",
+	errSSOExpired:          "Single sign-on expired or was started in another browser. Please try again.",
+}
+
+// InitSSO creates the single sign-on indexes. Unfinished sign-ins are
+// deleted once they expire.
+func InitSSO() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.OIDCLoginsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "stateHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create OIDC login indexes: %v", err)
+	}
+}
+
+// ssoRedirectURL is the frontend page the browser returns to after single
+// sign-on (OIDC_POST_LOGIN_URL, default APP_URL + "/sso/callback")
+func ssoRedirectURL() string {
+	if redirect := os.Getenv("OIDC_POST_LOGIN_URL"); redirect != "" {
+		return redirect
+	}
+	return strings.TrimSuffix(os.Getenv("APP_URL"), "/") + "/sso/callback"
+}
+
+// redirectToFrontend finishes single sign-on by sending the browser to the
+// frontend with the result in the URL fragment, which is never sent to a
+// server or written to access logs
+func redirectToFrontend(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, ssoRedirectURL()+"#"+values.Encode())
+}
+
+// redirectSSOError sends the browser to the frontend with an error code and message
+func redirectSSOError(c *gin.Context, err error) {
+	message, ok := ssoErrorMessages[err]
+	if !ok {
+		err = errors.New("sso_failed")
+		message = "Single sign-on failed. Please try again."
+	}
+	redirectToFrontend(c, url.Values{"error": {err.Error()}, "message": {message}})
+}
+
+// GetSSOConfig tells the login page whether to offer single sign-on
+func GetSSOConfig(c *gin.Context) {
+	response := gin.H{
+		"success": true,
+		"enabled": oidc.Enabled(),
+	}
+	if oidc.Enabled() {
+		response["loginUrl"] = "/api/auth/oidc/login"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// OIDCLogin starts single sign-on by sending the browser to the identity
+// provider. The state is also kept in a cookie so a sign-in cannot be
+// finished in a different browser from the one that started it.
+func OIDCLogin(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := oidc.Default(ctx)
+	if err == oidc.ErrNotConfigured {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Single sign-on is not enabled",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  OIDC provider unavailable: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": "Identity provider is unavailable",
+		})
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start single sign-on",
+		})
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start single sign-on",
+		})
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start single sign-on",
+		})
+		return
+	}
+
+	now := time.Now()
+	login := models.OIDCLogin{
+		ID:           primitive.NewObjectID(),
+		StateHash:    hashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    now.Add(oidcLoginTTL),
+		CreatedAt:    now,
+	}
+	if _, err := config.OIDCLoginsCollection.InsertOne(ctx, login); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start single sign-on",
+		})
+		return
+	}
+
+	// Lax lets the cookie come back on the provider's top-level redirect
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcLoginTTL.Seconds()), "/api/auth/oidc", "", secure, true)
+
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, challenge))
+}
+
+// OIDCCallback finishes single sign-on when the identity provider sends the
+// browser back. The user is matched by email, or created if just-in-time
+// provisioning is on, and their department and role are updated from the ID
+// token's claims. Users with two-factor authentication still enter a code.
+func OIDCCallback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		log.Printf("⚠️  OIDC provider returned an error: %s %s", providerError, c.Query("error_description"))
+		redirectSSOError(c, errors.New(providerError))
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", false, true)
+	if state == "" || cookie != state {
+		redirectSSOError(c, errSSOExpired)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// Deleting the login as it is read makes each state usable once
+	var login models.OIDCLogin
+	err := config.OIDCLoginsCollection.FindOneAndDelete(ctx, bson.M{
+		"stateHash": hashToken(state),
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&login)
+	if err != nil {
+		redirectSSOError(c, errSSOExpired)
+		return
+	}
+
+	provider, err := oidc.Default(ctx)
+	if err != nil {
+		log.Printf("⚠️  OIDC provider unavailable: %v", err)
+		redirectSSOError(c, err)
+		return
+	}
+
+	idToken, err := provider.Exchange(ctx, c.Query("code"), login.CodeVerifier)
+	if err != nil {
+		log.Printf("⚠️  OIDC code exchange failed: %v", err)
+		redirectSSOError(c, err)
+		return
+	}
+	claims, err := provider.VerifyIDToken(ctx, idToken, login.Nonce)
+	if err != nil {
+		log.Printf("⚠️  OIDC ID token rejected: %v", err)
+		redirectSSOError(c, err)
+		return
+	}
+
+	user, err := ssoUser(ctx, claims)
+	if err != nil {
+		if _, known := ssoErrorMessages[err]; !known {
+			log.Printf("⚠️  OIDC sign-in for %s failed: %v", claims.String("sub"), err)
+		}
+		redirectSSOError(c, err)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		challengeToken, err := startLoginChallenge(ctx, user.ID)
+		if err != nil {
+			redirectSSOError(c, err)
+			return
+		}
+		redirectToFrontend(c, url.Values{
+			"twoFactorRequired": {"true"},
+			"challengeToken":    {challengeToken},
+		})
+		return
+	}
+
+	tokens, err := middleware.StartSession(ctx, user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		redirectSSOError(c, err)
+		return
+	}
+
+	values := url.Values{
+		"token":        {tokens.AccessToken},
+		"refreshToken": {tokens.RefreshToken},
+		"expiresIn":    {strconv.FormatInt(tokens.ExpiresIn, 10)},
+	}
+	if twoFactorRequired(ctx, user) {
+		values.Set("twoFactorSetupRequired", "true")
+	}
+	redirectToFrontend(c, values)
+}
+
+// findUserByEmail looks a user up by email, ignoring case, since identity
+// providers and directories do not always keep the case people registered with
+func findUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := config.UsersCollection.FindOne(
+		ctx,
+		bson.M{"email": email},
+		options.FindOne().SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ssoUser finds or provisions the user an ID token belongs to and applies
+// the department and role from its claims
+func ssoUser(ctx context.Context, claims oidc.Claims) (*models.User, error) {
+	email := strings.TrimSpace(claims.String("email"))
+	if email == "" || !claims.EmailVerified() {
+		return nil, errSSOEmailUnverified
+	}
+	subject := claims.String("sub")
+	department := ssoDepartment(claims)
+	role := ssoRole(claims)
+
+	user, err := findUserByEmail(ctx, email)
+	if err == mongo.ErrNoDocuments {
+		if !config.GetBool("OIDC_JIT_PROVISIONING", false) {
+			return nil, errSSONoAccount
+		}
+		return provisionSSOUser(ctx, claims, email, department, role)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.OIDCSubject != "" && user.OIDCSubject != subject {
+		return nil, errSSOIdentityMismatch
+	}
+	if !user.IsActive {
+		return nil, errSSODeactivated
+	}
+
+	// The identity provider is the source of truth for claims it sends
+	set := bson.M{}
+	if user.OIDCSubject == "" {
+		set["oidcSubject"] = subject
+		user.OIDCSubject = subject
+	}
+	if department != "" && department != user.Department {
+		set["department"] = department
+		user.Department = department
+	}
+	if role != "" && role != user.Role {
+		set["role"] = role
+		user.Role = role
+	}
+	if len(set) > 0 {
+		set["updatedAt"] = time.Now()
+		if _, err := config.UsersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": set}); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// provisionSSOUser creates an account on first single sign-on. It gets an
+// unusable random password, so it signs in through the provider until the
+// user sets one with a password reset.
+func provisionSSOUser(ctx context.Context, claims oidc.Claims, email, department, role string) (*models.User, error) {
+	user, err := newSSOUser(claims, email, department, role)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	if user.Password, err = utils.HashPassword(password); err != nil {
+		return nil, err
+	}
+	if user.StaffID, err = utils.GenerateStaffID(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := config.UsersCollection.InsertOne(ctx, user); err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, models.AuditLog{
+		Action:  models.AuditUserProvisioned,
+		Target:  user.ID,
+		Details: map[string]interface{}{"source": "oidc", "email": email, "department": user.Department, "role": user.Role},
+	})
+	return user, nil
+}
+
+// newSSOUser builds the account provisioned for an ID token's claims, without
+// its password and staff ID. Without a department claim the user goes to
+// OIDC_DEFAULT_DEPARTMENT; without a role claim they are an employee.
+func newSSOUser(claims oidc.Claims, email, department, role string) (*models.User, error) {
+	if department == "" {
+		department = os.Getenv("OIDC_DEFAULT_DEPARTMENT")
+		if !models.IsValidDepartment(department) {
+			return nil, errSSONoDepartment
+		}
+	}
+	if role == "" {
+		role = "employee"
+	}
+
+	firstName, lastName := claims.String("given_name"), claims.String("family_name")
+	if firstName == "" {
+		name := strings.Fields(claims.String("name"))
+		switch {
+		case len(name) > 1:
+			firstName, lastName = strings.Join(name[:len(name)-1], " "), name[len(name)-1]
+		case len(name) == 1:
+			firstName = name[0]
+		default:
+			firstName = strings.SplitN(email, "@", 2)[0]
+		}
+	}
+
+	now := time.Now()
+	return &models.User{
+		ID:          primitive.NewObjectID(),
+		FirstName:   firstName,
+		LastName:    lastName,
+		Email:       email,
+		Department:  department,
+		Role:        role,
+		OIDCSubject: claims.String("sub"),
+		LeaveBalance: models.LeaveBalance{
+			Total:     28,
+			Available: 28,
+			Used:      0,
+		},
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// ssoClaimName returns the claim configured by key, or fallback when the
+// variable is not set. Setting it to an empty value turns the mapping off.
+func ssoClaimName(key, fallback string) string {
+	if name, ok := os.LookupEnv(key); ok {
+		return name
+	}
+	return fallback
+}
+
+// ssoDepartment maps the department claim (OIDC_DEPARTMENT_CLAIM, default
+// "department") onto a department, ignoring case. It returns "" when the
+// claim is missing or names no known department.
+func ssoDepartment(claims oidc.Claims) string {
+	claim := ssoClaimName("OIDC_DEPARTMENT_CLAIM", "department")
+	if claim == "" {
+		return ""
+	}
+	for _, value := range claims.Strings(claim) {
+		if department := models.CanonicalDepartment(value); department != "" {
+			return department
+		}
+	}
+	return ""
+}
+
+// ssoRole maps the role claim (OIDC_ROLE_CLAIM, default "roles") onto a
+// role. OIDC_ROLE_MAP translates claim values, e.g. "HR-Team=hr,IT-Admins=admin";
+// without it the values must be role names. When several values match, the
+// most privileged role wins. It returns "" when nothing matches.
+func ssoRole(claims oidc.Claims) string {
+	claim := ssoClaimName("OIDC_ROLE_CLAIM", "roles")
+	if claim == "" {
+		return ""
+	}
+
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OIDC_ROLE_MAP"), ",") {
+		if value, role, ok := strings.Cut(pair, "="); ok {
+			mapping[strings.TrimSpace(value)] = strings.TrimSpace(role)
+		}
+	}
+
+	roles := []string{}
+	for _, value := range claims.Strings(claim) {
+		role := value
+		if len(mapping) > 0 {
+			role = mapping[value]
+		}
+		roles = append(roles, role)
+	}
+	return models.HighestRole(roles)
+}
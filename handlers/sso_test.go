@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/flowkit/backend/oidc"
+	"github.com/flowkit/backend/oidc/oidctest"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ssoFragment returns the values the frontend is redirected to with
+func ssoFragment(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want a redirect", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect %q: %v", w.Header().Get("Location"), err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != "https://flowkit.test/sso/callback" {
+		t.Errorf("redirected to %q, want the frontend callback", got)
+	}
+	values, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatalf("invalid fragment %q: %v", location.Fragment, err)
+	}
+	return values
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OIDC_POST_LOGIN_URL", "https://flowkit.test/sso/callback")
+
+	router := gin.New()
+	router.GET("/api/auth/oidc/callback", OIDCCallback)
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		want   string
+	}{
+		{name: "no cookie", query: "state=abc&code=c", want: "sso_expired"},
+		{name: "cookie for another sign-in", query: "state=abc&code=c", cookie: "xyz", want: "sso_expired"},
+		{name: "no state", query: "code=c", cookie: "abc", want: "sso_expired"},
+		{name: "provider error", query: "error=access_denied&state=abc", cookie: "abc", want: "sso_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+tt.query, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			values := ssoFragment(t, w)
+			if values.Get("error") != tt.want {
+				t.Errorf("error = %q, want %q", values.Get("error"), tt.want)
+			}
+			if values.Get("token") != "" {
+				t.Error("a session was started")
+			}
+		})
+	}
+}
+
+func TestSSOClaimMapping(t *testing.T) {
+	tests := []struct {
+		name           string
+		env            map[string]string
+		claims         oidc.Claims
+		wantDepartment string
+		wantRole       string
+	}{
+		{
+			name:           "defaults",
+			claims:         oidc.Claims{"department": " noc ", "roles": []interface{}{"employee", "hr"}},
+			wantDepartment: "NOC",
+			wantRole:       "hr",
+		},
+		{
+			name:           "unknown values",
+			claims:         oidc.Claims{"department": "Sales", "roles": []interface{}{"superuser"}},
+			wantDepartment: "",
+			wantRole:       "",
+		},
+		{
+			name: "custom claims and role map",
+			env: map[string]string{
+				"OIDC_DEPARTMENT_CLAIM": "org.unit",
+				"OIDC_ROLE_CLAIM":       "groups",
+				"OIDC_ROLE_MAP":         "HR-Team=hr, IT-Admins=admin",
+			},
+			claims: oidc.Claims{
+				"org":    map[string]interface{}{"unit": []interface{}{"Unknown", "customer service"}},
+				"groups": []interface{}{"Staff", "HR-Team"},
+			},
+			wantDepartment: "CUSTOMER SERVICE",
+			wantRole:       "hr",
+		},
+		{
+			name:           "role map ignores unmapped values",
+			env:            map[string]string{"OIDC_ROLE_MAP": "IT-Admins=admin"},
+			claims:         oidc.Claims{"roles": []interface{}{"admin"}},
+			wantDepartment: "",
+			wantRole:       "",
+		},
+		{
+			name:           "mapping turned off",
+			env:            map[string]string{"OIDC_DEPARTMENT_CLAIM": "", "OIDC_ROLE_CLAIM": ""},
+			claims:         oidc.Claims{"department": "NOC", "roles": "admin"},
+			wantDepartment: "",
+			wantRole:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if got := ssoDepartment(tt.claims); got != tt.wantDepartment {
+				t.Errorf("department = %q, want %q", got, tt.wantDepartment)
+			}
+			if got := ssoRole(tt.claims); got != tt.wantRole {
+				t.Errorf("role = %q, want %q", got, tt.wantRole)
+			}
+		})
+	}
+}
+
+// signInWithMockProvider runs the code flow against server and returns the
+// verified claims of the ID token it issues for claims
+func signInWithMockProvider(t *testing.T, server *oidctest.Server, claims jwt.MapClaims) oidc.Claims {
+	t.Helper()
+	ctx := context.Background()
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:      server.URL,
+		ClientID:    server.ClientID,
+		RedirectURL: "https://api.flowkit.test/api/auth/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	server.SetClaims(claims)
+	callback := server.SignIn(t, provider.AuthCodeURL("state", "nonce", challenge))
+	idToken, err := provider.Exchange(ctx, callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	verified, err := provider.VerifyIDToken(ctx, idToken, "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	return verified
+}
+
+func TestSSOProvisioning(t *testing.T) {
+	server := oidctest.NewServer(t, "flowkit")
+	t.Setenv("OIDC_ROLE_CLAIM", "groups")
+	t.Setenv("OIDC_ROLE_MAP", "HR-Team=hr")
+	t.Setenv("OIDC_DEFAULT_DEPARTMENT", "ADMIN")
+
+	tests := []struct {
+		name           string
+		claims         jwt.MapClaims
+		wantFirst      string
+		wantLast       string
+		wantDepartment string
+		wantRole       string
+	}{
+		{
+			name: "claims mapped",
+			claims: jwt.MapClaims{
+				"sub": "idp|jane", "email": "jane.doe@flowkit.com", "email_verified": true,
+				"given_name": "Jane", "family_name": "Doe",
+				"department": "vas", "groups": []string{"Staff", "HR-Team"},
+			},
+			wantFirst:      "Jane",
+			wantLast:       "Doe",
+			wantDepartment: "VAS",
+			wantRole:       "hr",
+		},
+		{
+			name: "defaults",
+			claims: jwt.MapClaims{
+				"sub": "idp|kofi", "email": "kofi@flowkit.com",
+				"name": "Kofi Ama Boateng",
+			},
+			wantFirst:      "Kofi Ama",
+			wantLast:       "Boateng",
+			wantDepartment: "ADMIN",
+			wantRole:       "employee",
+		},
+		{
+			name:           "name from email",
+			claims:         jwt.MapClaims{"sub": "idp|esi", "email": "esi@flowkit.com", "department": "NOC"},
+			wantFirst:      "esi",
+			wantDepartment: "NOC",
+			wantRole:       "employee",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := signInWithMockProvider(t, server, tt.claims)
+			email := claims.String("email")
+
+			user, err := newSSOUser(claims, email, ssoDepartment(claims), ssoRole(claims))
+			if err != nil {
+				t.Fatalf("newSSOUser: %v", err)
+			}
+			if user.Email != email || user.OIDCSubject != tt.claims["sub"] {
+				t.Errorf("email, subject = %q, %q", user.Email, user.OIDCSubject)
+			}
+			if user.FirstName != tt.wantFirst || user.LastName != tt.wantLast {
+				t.Errorf("name = %q %q, want %q %q", user.FirstName, user.LastName, tt.wantFirst, tt.wantLast)
+			}
+			if user.Department != tt.wantDepartment || user.Role != tt.wantRole {
+				t.Errorf("department, role = %q, %q, want %q, %q", user.Department, user.Role, tt.wantDepartment, tt.wantRole)
+			}
+			if !user.IsActive || user.LeaveBalance.Available != 28 || user.Password != "" {
+				t.Errorf("user = %+v", user)
+			}
+		})
+	}
+
+	t.Run("no department", func(t *testing.T) {
+		t.Setenv("OIDC_DEFAULT_DEPARTMENT", "")
+		claims := signInWithMockProvider(t, server, jwt.MapClaims{"sub": "idp|yaw", "email": "yaw@flowkit.com"})
+		if _, err := newSSOUser(claims, "yaw@flowkit.com", ssoDepartment(claims), ssoRole(claims)); err != errSSONoDepartment {
+			t.Fatalf("err = %v, want %v", err, errSSONoDepartment)
+		}
+	})
+}
+
+func TestSSOUserRequiresVerifiedEmail(t *testing.T) {
+	for _, claims := range []oidc.Claims{
+		{"sub": "idp|a"},
+		{"sub": "idp|a", "email": "  "},
+		{"sub": "idp|a", "email": "a@flowkit.com", "email_verified": false},
+	} {
+		if _, err := ssoUser(context.Background(), claims); err != errSSOEmailUnverified {
+			t.Errorf("ssoUser(%v) err = %v, want %v", claims, err, errSSOEmailUnverified)
+		}
+	}
+}
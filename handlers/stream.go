@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/middleware"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// streamHeartbeat keeps idle connections open through proxies
+const streamHeartbeat = 25 * time.Second
+
+// StreamEvents streams leave events concerning the current user as
+// Server-Sent Events. Clients reconnecting with Last-Event-ID first receive
+// the events they missed.
+func StreamEvents(c *gin.Context) {
+	userID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Streaming is not supported",
+		})
+		return
+	}
+
+	// Listen before replaying so nothing published in between is lost
+	live, stop := events.Listen(userID)
+	defer stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: 5000\n\n")
+	flusher.Flush()
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	// Events at or before the client's last event, and those replayed below,
+	// may also arrive live and are skipped
+	var resumeAfter primitive.ObjectID
+	replayed := map[primitive.ObjectID]bool{}
+	if after, err := primitive.ObjectIDFromHex(lastEventID); err == nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		missed, err := events.Since(ctx, userID, after)
+		cancel()
+		if err != nil {
+			return
+		}
+
+		resumeAfter = after
+		for _, event := range missed {
+			if writeStreamEvent(c, event) != nil {
+				return
+			}
+			replayed[event.ID] = true
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-live:
+			if replayed[event.ID] || (!resumeAfter.IsZero() && !events.IsAfter(event.ID, resumeAfter)) {
+				continue
+			}
+			if writeStreamEvent(c, event) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStreamEvent writes an event in Server-Sent Events format
+func writeStreamEvent(c *gin.Context, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID.Hex(), event.Type, data)
+	return err
+}
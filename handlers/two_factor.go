@@ -0,0 +1,755 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/utils"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	loginChallengeTTL      = 5 * time.Minute // How long a user has to enter their code after their password
+	loginChallengeAttempts = 5               // Wrong codes allowed per sign-in before starting again
+	recoveryCodeCount      = 10
+)
+
+// InitTwoFactor creates the sign-in challenge indexes. Challenges are
+// deleted once they expire.
+func InitTwoFactor() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.LoginChallengesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create login challenge indexes: %v", err)
+	}
+}
+
+// totpIssuer is the name authenticator apps show for the account (TOTP_ISSUER)
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "FlowKit"
+}
+
+// normalizeRecoveryCode strips the formatting users may type with a recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// newRecoveryCodes generates a set of recovery codes, returning them as shown
+// to the user and as stored
+func newRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// verifyTOTPCode checks a code from the user's authenticator app and records
+// its time step, so each code works once
+func verifyTOTPCode(ctx context.Context, user *models.User, code string) (bool, error) {
+	step, ok := utils.VerifyTOTP(user.TwoFactorSecret, code, time.Now(), user.TwoFactorLastStep)
+	if !ok {
+		return false, nil
+	}
+	result, err := config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "twoFactorLastStep": bson.M{"$not": bson.M{"$gte": step}}},
+		bson.M{"$set": bson.M{"twoFactorLastStep": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// verifyTwoFactorCode accepts either an authenticator code or an unused
+// recovery code, which is then used up. It reports whether a recovery code
+// was used.
+func verifyTwoFactorCode(ctx context.Context, user *models.User, code string) (ok bool, usedRecoveryCode bool, err error) {
+	ok, err = verifyTOTPCode(ctx, user, code)
+	if ok || err != nil {
+		return ok, false, err
+	}
+
+	hash := hashToken(normalizeRecoveryCode(code))
+	result, err := config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "twoFactorRecoveryCodes": hash},
+		bson.M{"$pull": bson.M{"twoFactorRecoveryCodes": hash}},
+	)
+	if err != nil {
+		return false, false, err
+	}
+	return result.ModifiedCount > 0, result.ModifiedCount > 0, nil
+}
+
+// startLoginChallenge records that a user has given their password and
+// returns the token that lets them finish signing in with a code
+func startLoginChallenge(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	challenge := models.LoginChallenge{
+		ID:        primitive.NewObjectID(),
+		User:      userID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(loginChallengeTTL),
+		CreatedAt: now,
+	}
+	if _, err := config.LoginChallengesCollection.InsertOne(ctx, challenge); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// twoFactorRequired reports whether the sign-in policy requires two-factor
+// authentication for the user's role
+func twoFactorRequired(ctx context.Context, user *models.User) bool {
+	settings, err := middleware.GetSecuritySettings(ctx)
+	return err == nil && settings.RequiresTwoFactor(user.Role)
+}
+
+// LoginTwoFactor finishes signing in a user with two-factor authentication,
+// using the challenge token from Login and an authenticator or recovery code
+func LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Counting the attempt before checking the code caps guesses even when they arrive in parallel
+	var challenge models.LoginChallenge
+	err := config.LoginChallengesCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"tokenHash": hashToken(req.ChallengeToken),
+			"expiresAt": bson.M{"$gt": time.Now()},
+			"attempts":  bson.M{"$lt": loginChallengeAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Sign-in has expired. Please sign in again.",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to verify code",
+		})
+		return
+	}
+
+	var user models.User
+	err = config.UsersCollection.FindOne(ctx, bson.M{"_id": challenge.User}).Decode(&user)
+	if err != nil || !user.IsActive || !user.TwoFactorEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Sign-in has expired. Please sign in again.",
+		})
+		return
+	}
+
+	// Wrong codes count against the account like wrong passwords, so starting
+	// new challenges does not give unlimited guesses
+	wait, locked, err := checkLoginThrottle(ctx, user.Email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to verify code",
+		})
+		return
+	}
+	if wait > 0 {
+		rejectThrottledLogin(c, wait, locked)
+		return
+	}
+
+	ok, usedRecoveryCode, err := verifyTwoFactorCode(ctx, &user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to verify code",
+		})
+		return
+	}
+	if !ok {
+		recordLoginFailure(ctx, user.Email, c.ClientIP(), user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success":           false,
+			"message":           "Invalid authentication code",
+			"attemptsRemaining": loginChallengeAttempts - challenge.Attempts - 1,
+		})
+		return
+	}
+
+	// The challenge is used up; deleting it also settles a race between two correct codes
+	result, err := config.LoginChallengesCollection.DeleteOne(ctx, bson.M{"_id": challenge.ID})
+	if err != nil || result.DeletedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Sign-in has expired. Please sign in again.",
+		})
+		return
+	}
+
+	clearLoginFailures(ctx, user.Email)
+
+	tokens, err := middleware.StartSession(ctx, user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate token",
+		})
+		return
+	}
+
+	response := tokens.JSON()
+	response["success"] = true
+	response["message"] = "Login successful"
+	response["user"] = user.ToResponse()
+	if usedRecoveryCode {
+		response["recoveryCodesRemaining"] = len(user.TwoFactorRecoveryCodes) - 1
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetTwoFactorStatus reports whether the current user has two-factor
+// authentication and whether their role requires it
+func GetTwoFactorStatus(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":                true,
+		"enabled":                user.TwoFactorEnabled,
+		"required":               twoFactorRequired(ctx, user),
+		"recoveryCodesRemaining": len(user.TwoFactorRecoveryCodes),
+	})
+}
+
+// EnrollTwoFactor starts setting up two-factor authentication. It returns a
+// new secret and its provisioning URI for the user's authenticator app; the
+// secret is only used once VerifyTwoFactor confirms a code from it.
+func EnrollTwoFactor(c *gin.Context) {
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate secret",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"twoFactorPendingSecret": secret}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to start two-factor setup",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":         true,
+		"message":         "Scan the code with your authenticator app, then confirm with a code from it",
+		"secret":          secret,
+		"provisioningUri": utils.TOTPProvisioningURI(totpIssuer(), user.Email, secret),
+	})
+}
+
+// VerifyTwoFactor finishes setting up two-factor authentication with a code
+// from the newly added authenticator app. It returns recovery codes, which are
+// shown only this once, and signs out the user's other sessions.
+func VerifyTwoFactor(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is already enabled",
+		})
+		return
+	}
+	if user.TwoFactorPendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Start two-factor setup first",
+		})
+		return
+	}
+
+	step, ok := utils.VerifyTOTP(user.TwoFactorPendingSecret, req.Code, time.Now(), 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid authentication code",
+		})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate recovery codes",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Matching the pending secret guards against a second enrolment started meanwhile
+	result, err := config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "twoFactorPendingSecret": user.TwoFactorPendingSecret},
+		bson.M{
+			"$set": bson.M{
+				"twoFactorEnabled":       true,
+				"twoFactorSecret":        user.TwoFactorPendingSecret,
+				"twoFactorRecoveryCodes": hashes,
+				"twoFactorLastStep":      step,
+				"updatedAt":              time.Now(),
+			},
+			"$unset": bson.M{"twoFactorPendingSecret": ""},
+		},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to enable two-factor authentication",
+		})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Two-factor setup was restarted. Please scan the new code.",
+		})
+		return
+	}
+
+	// Other sessions were signed in with just a password
+	currentID, _ := middleware.GetCurrentSessionID(c)
+	if _, err := middleware.RevokeUserSessions(ctx, user.ID, currentID, "two-factor authentication enabled"); err != nil {
+		log.Printf("⚠️  Failed to sign out other sessions for %s: %v", user.ID.Hex(), err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"message":       "Two-factor authentication enabled. Store these recovery codes somewhere safe.",
+		"recoveryCodes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes,
+// confirmed with an authenticator code
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ok, err := verifyTOTPCode(ctx, user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to verify code",
+		})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid authentication code",
+		})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate recovery codes",
+		})
+		return
+	}
+
+	_, err = config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"twoFactorRecoveryCodes": hashes}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to save recovery codes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"message":       "Recovery codes regenerated. The old codes no longer work.",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTwoFactor turns off two-factor authentication for the current user,
+// confirmed with their password and a code. Users whose role requires it
+// cannot turn it off.
+func DisableTwoFactor(c *gin.Context) {
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	user, err := middleware.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if twoFactorRequired(ctx, user) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Two-factor authentication is required for your role",
+		})
+		return
+	}
+
+	if !utils.CheckPassword(req.Password, user.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Password is incorrect",
+		})
+		return
+	}
+
+	ok, _, err := verifyTwoFactorCode(ctx, user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to verify code",
+		})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid authentication code",
+		})
+		return
+	}
+
+	if _, err := clearTwoFactor(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// clearTwoFactor removes a user's two-factor setup and reports whether the user exists
+func clearTwoFactor(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	result, err := config.UsersCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set": bson.M{"twoFactorEnabled": false, "updatedAt": time.Now()},
+			"$unset": bson.M{
+				"twoFactorSecret":        "",
+				"twoFactorPendingSecret": "",
+				"twoFactorRecoveryCodes": "",
+				"twoFactorLastStep":      "",
+			},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// AdminResetTwoFactor removes a user's two-factor setup, e.g. after they lose
+// their phone, and signs them out everywhere (admin only). If their role
+// requires two-factor authentication they must set it up again on next sign-in.
+func AdminResetTwoFactor(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, ok := loadManagedUser(ctx, c, userID, models.PermUserManage); !ok {
+		return
+	}
+
+	found, err := clearTwoFactor(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to reset two-factor authentication",
+		})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	if _, err := middleware.RevokeUserSessions(ctx, userID, primitive.NilObjectID, "two-factor reset by admin"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Two-factor authentication reset, but failed to sign out existing sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication reset successfully",
+	})
+}
+
+// AdminGetTwoFactorPolicy returns the roles that must use two-factor
+// authentication (admin only)
+func AdminGetTwoFactorPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	settings, err := middleware.GetSecuritySettings(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch two-factor policy",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"requiredRoles": settings.TwoFactorRequiredRoles,
+	})
+}
+
+// AdminUpdateTwoFactorPolicy sets the roles that must use two-factor
+// authentication (admin only). Users in those roles without it are held at
+// enrolment until they set it up.
+func AdminUpdateTwoFactorPolicy(c *gin.Context) {
+	var req models.UpdateTwoFactorPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+		})
+		return
+	}
+
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, role := range req.RequiredRoles {
+		if !models.IsValidRole(role) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid role: " + role,
+			})
+			return
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+
+	adminID, _ := middleware.GetCurrentUserID(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.SettingsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": models.SecuritySettingsID},
+		bson.M{"$set": bson.M{
+			"twoFactorRequiredRoles": roles,
+			"updatedBy":              adminID,
+			"updatedAt":              time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to update two-factor policy",
+		})
+		return
+	}
+	middleware.ClearSecuritySettingsCache()
+
+	// Let the admin know how many people will be asked to enrol
+	pending, err := config.UsersCollection.CountDocuments(ctx, bson.M{
+		"role":             bson.M{"$in": roles},
+		"isActive":         true,
+		"twoFactorEnabled": bson.M{"$ne": true},
+	})
+	if err != nil {
+		pending = 0
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":               true,
+		"message":               "Two-factor policy updated successfully",
+		"requiredRoles":         roles,
+		"usersPendingEnrolment": pending,
+	})
+}
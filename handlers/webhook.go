@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/webhooks"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdminCreateWebhook creates a webhook subscription (admin only).
+// The signing secret is only returned here and when it is rotated.
+func AdminCreateWebhook(c *gin.Context) {
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if eventType, ok := validWebhookEvents(req.Events); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Unknown event type: " + eventType,
+		})
+		return
+	}
+
+	adminID, err := middleware.GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "User not found",
+		})
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate webhook secret",
+		})
+		return
+	}
+
+	eventTypes := req.Events
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	now := time.Now()
+	subscription := models.WebhookSubscription{
+		ID:          primitive.NewObjectID(),
+		Name:        req.Name,
+		URL:         req.URL,
+		Events:      eventTypes,
+		Secret:      secret,
+		Description: req.Description,
+		IsActive:    true,
+		CreatedBy:   adminID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := config.WebhooksCollection.InsertOne(ctx, subscription); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to create webhook",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Webhook created successfully. Store the secret now, it will not be shown again",
+		"webhook": subscription,
+		"secret":  secret,
+	})
+}
+
+// AdminGetWebhooks lists all webhook subscriptions (admin only)
+func AdminGetWebhooks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.WebhooksCollection.Find(
+		ctx,
+		bson.M{},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch webhooks",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	subscriptions := []models.WebhookSubscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode webhooks",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"count":    len(subscriptions),
+		"webhooks": subscriptions,
+		"events":   events.Types,
+	})
+}
+
+// AdminUpdateWebhook changes a webhook's URL, event filter or active state (admin only)
+func AdminUpdateWebhook(c *gin.Context) {
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid webhook ID",
+		})
+		return
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	updateFields := bson.M{"updatedAt": time.Now()}
+	if req.Name != "" {
+		updateFields["name"] = req.Name
+	}
+	if req.URL != "" {
+		updateFields["url"] = req.URL
+	}
+	if req.Events != nil {
+		if eventType, ok := validWebhookEvents(*req.Events); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Unknown event type: " + eventType,
+			})
+			return
+		}
+		updateFields["events"] = *req.Events
+	}
+	if req.Description != nil {
+		updateFields["description"] = *req.Description
+	}
+	if req.IsActive != nil {
+		updateFields["isActive"] = *req.IsActive
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var subscription models.WebhookSubscription
+	err = config.WebhooksCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": webhookID},
+		bson.M{"$set": updateFields},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&subscription)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Webhook not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook updated successfully",
+		"webhook": subscription,
+	})
+}
+
+// AdminRotateWebhookSecret replaces a webhook's signing secret (admin only)
+func AdminRotateWebhookSecret(c *gin.Context) {
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid webhook ID",
+		})
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to generate webhook secret",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.WebhooksCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": webhookID},
+		bson.M{"$set": bson.M{"secret": secret, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to rotate webhook secret",
+		})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Webhook not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook secret rotated. Store the new secret now, it will not be shown again",
+		"secret":  secret,
+	})
+}
+
+// AdminDeleteWebhook deletes a webhook subscription (admin only). Its delivery
+// log is kept and any queued deliveries fail.
+func AdminDeleteWebhook(c *gin.Context) {
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid webhook ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := config.WebhooksCollection.DeleteOne(ctx, bson.M{"_id": webhookID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete webhook",
+		})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Webhook not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// AdminGetWebhookDeliveries returns a webhook's delivery log, newest first
+// (admin only). Supports ?status= and ?limit=N (default 50, max 200).
+func AdminGetWebhookDeliveries(c *gin.Context) {
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid webhook ID",
+		})
+		return
+	}
+
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	filter := bson.M{"subscription": webhookID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := config.WebhookDeliveriesCollection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to fetch webhook deliveries",
+		})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to decode webhook deliveries",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"count":      len(deliveries),
+		"deliveries": deliveries,
+	})
+}
+
+// AdminRedeliverWebhook sends an earlier delivery's payload again as a new
+// delivery (admin only)
+func AdminRedeliverWebhook(c *gin.Context) {
+	deliveryID, err := primitive.ObjectIDFromHex(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid delivery ID",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var original models.WebhookDelivery
+	err = config.WebhookDeliveriesCollection.FindOne(ctx, bson.M{"_id": deliveryID}).Decode(&original)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Webhook delivery not found",
+		})
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	err = config.WebhooksCollection.FindOne(ctx, bson.M{"_id": original.Subscription}).Decode(&subscription)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "The webhook for this delivery no longer exists",
+		})
+		return
+	}
+	if !subscription.IsActive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Activate the webhook before redelivering",
+		})
+		return
+	}
+
+	delivery, err := webhooks.Redeliver(ctx, &original)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to queue redelivery",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":  true,
+		"message":  "Redelivery queued",
+		"delivery": delivery,
+	})
+}
+
+// validWebhookEvents checks an event filter against the known event types,
+// returning the first unknown one
+func validWebhookEvents(eventTypes []string) (string, bool) {
+	known := map[string]bool{}
+	for _, eventType := range events.Types {
+		known[eventType] = true
+	}
+	for _, eventType := range eventTypes {
+		if !known[eventType] {
+			return eventType, false
+		}
+	}
+	return "", true
+}
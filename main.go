@@ -2,17 +2,31 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"time"
 
+	"github.com/flowkit/backend/audit"
 	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/handlers"
+	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/notifications"
 	"github.com/flowkit/backend/routes"
+	"github.com/flowkit/backend/scheduler"
+	"github.com/flowkit/backend/storage"
+	"github.com/flowkit/backend/utils"
+	"github.com/flowkit/backend/webhooks"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// -worker runs the scheduled jobs without serving the API
+	worker := flag.Bool("worker", false, "run scheduled jobs only, without the HTTP server")
+	flag.Parse()
+
 	// Load configuration
 	config.LoadEnv()
 
@@ -34,6 +48,48 @@ func main() {
 	config.InitDB(client)
 	log.Println("✅ MongoDB Connected Successfully")
 
+	// Prepare roles, sign-in sessions, API keys, password resets, cancellation
+	// requests, two-factor sign-in, login throttling, single sign-on, rate
+	// limits and the audit log
+	middleware.InitRoles()
+	middleware.InitSessions()
+	middleware.InitAPIKeys()
+	handlers.InitPasswordResets()
+	handlers.InitCancellations()
+	handlers.InitExtensions()
+	handlers.InitTwoFactor()
+	handlers.InitLoginProtection()
+	handlers.InitSSO()
+	utils.InitRateLimits()
+	audit.Init()
+
+	// Initialize attachment storage
+	storage.Init()
+
+	// Start the event bus for live updates
+	events.StartBus(ctx, config.EventsCollection)
+
+	// Start email and in-app notifications
+	notifications.Init()
+
+	// Start outbound webhook deliveries
+	webhooks.Init()
+
+	// Drain the event outbox now that every sink has subscribed
+	events.StartOutbox(ctx, config.OutboxCollection)
+
+	// Scheduled jobs run in the server unless a separate worker handles them
+	handlers.RegisterJobs()
+	scheduler.Init()
+	if *worker {
+		scheduler.Start()
+		log.Println("🛠️  Worker running scheduled jobs")
+		select {}
+	}
+	if config.GetBool("SCHEDULER_ENABLED", true) {
+		scheduler.Start()
+	}
+
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
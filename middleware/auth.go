@@ -16,34 +16,46 @@ import (
 
 // Claims represents JWT claims
 type Claims struct {
-	UserID string `json:"userId"`
+	UserID    string `json:"userId"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token
-func GenerateToken(userID primitive.ObjectID) (string, error) {
+// jwtSecret returns the key access tokens are signed with
+func jwtSecret() []byte {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		secret = "default-secret-key"
 	}
+	return []byte(secret)
+}
 
-	expirationTime := time.Now().Add(720 * time.Hour) // 30 days
+// GenerateToken generates a short-lived access token for a session
+func GenerateToken(userID, sessionID primitive.ObjectID) (string, error) {
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID.Hex(),
+		UserID:    userID.Hex(),
+		SessionID: sessionID.Hex(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return token.SignedString(jwtSecret())
 }
 
-// AuthMiddleware validates JWT token
+// AuthMiddleware validates JWT token or API key
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+
+		// EventSource cannot set headers, so event streams may pass the token in the query
+		if authHeader == "" && c.GetHeader("Accept") == "text/event-stream" && c.Query("access_token") != "" {
+			authHeader = "Bearer " + c.Query("access_token")
+		}
+
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
@@ -65,16 +77,16 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "default-secret-key"
+		if isAPIKey(tokenString) {
+			authenticateAPIKey(c, tokenString)
+			return
 		}
 
 		// Parse and validate token
 		claims := &Claims{}
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
+			return jwtSecret(), nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -96,74 +108,63 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		var user models.User
-		err = config.UsersCollection.FindOne(c.Request.Context(), bson.M{"_id": userID}).Decode(&user)
+		// Tokens from before sessions existed cannot be revoked, so they are refused
+		sessionID, err := primitive.ObjectIDFromHex(claims.SessionID)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": "User not found",
+				"message": "Invalid or expired token",
 			})
 			c.Abort()
 			return
 		}
 
-		if !user.IsActive {
+		session, err := findSession(c.Request.Context(), sessionID)
+		if err != nil || session.User != userID || !session.IsActive(time.Now()) {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": "User account is deactivated",
+				"message": "Session has been revoked or has expired",
 			})
 			c.Abort()
 			return
 		}
 
-		// Set user in context
-		c.Set("user", user)
-		c.Set("userId", userID)
-		c.Next()
-	}
-}
-
-// AuthorizeRoles checks if user has required role
-func AuthorizeRoles(roles ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userInterface, exists := c.Get("user")
-		if !exists {
+		var user models.User
+		err = config.UsersCollection.FindOne(c.Request.Context(), bson.M{"_id": userID}).Decode(&user)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": "User not found in context",
+				"message": "User not found",
 			})
 			c.Abort()
 			return
 		}
 
-		user, ok := userInterface.(models.User)
-		if !ok {
+		if !user.IsActive {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": "Invalid user data",
+				"message": "User account is deactivated",
 			})
 			c.Abort()
 			return
 		}
 
-		// Check if user role is in allowed roles
-		hasRole := false
-		for _, role := range roles {
-			if user.Role == role {
-				hasRole = true
-				break
-			}
-		}
-
-		if !hasRole {
+		if twoFactorSetupPending(c.Request.Context(), &user, c.FullPath()) {
 			c.JSON(http.StatusForbidden, gin.H{
-				"success": false,
-				"message": "User role '" + user.Role + "' is not authorized to access this route",
+				"success":                false,
+				"message":                "Two-factor authentication must be set up before continuing",
+				"twoFactorSetupRequired": true,
 			})
 			c.Abort()
 			return
 		}
 
+		touchSession(c.Request.Context(), session, c.ClientIP())
+
+		// Set user in context
+		c.Set("user", user)
+		c.Set("userId", userID)
+		c.Set("sessionId", sessionID)
 		c.Next()
 	}
 }
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// rolesCacheTTL is how long an instance reuses the roles before reading
+// them again, so changes made on another instance apply within this time
+const rolesCacheTTL = 30 * time.Second
+
+var (
+	rolesMu       sync.Mutex
+	rolesCache    map[string]models.Role
+	rolesLoadedAt time.Time
+)
+
+// InitRoles creates the roles index and adds any missing built-in role.
+// Built-in roles that already exist keep their saved permissions.
+func InitRoles() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.RolesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create role indexes: %v", err)
+	}
+
+	now := time.Now()
+	for _, role := range models.SystemRoles() {
+		role.System = true
+		role.CreatedAt = now
+		role.UpdatedAt = now
+		_, err := config.RolesCollection.UpdateOne(
+			ctx,
+			bson.M{"name": role.Name},
+			bson.M{"$setOnInsert": role},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			log.Printf("Warning: failed to create the %s role: %v", role.Name, err)
+		}
+	}
+}
+
+// GetRoles returns every role by name. When the roles cannot be read it
+// falls back to the last roles read, or to the built-in roles.
+func GetRoles(ctx context.Context) map[string]models.Role {
+	rolesMu.Lock()
+	defer rolesMu.Unlock()
+
+	if rolesCache != nil && time.Since(rolesLoadedAt) < rolesCacheTTL {
+		return rolesCache
+	}
+
+	roles, err := loadRoles(ctx)
+	if err != nil {
+		log.Printf("⚠️  Failed to load roles: %v", err)
+		if rolesCache != nil {
+			return rolesCache
+		}
+		roles = map[string]models.Role{}
+		for _, role := range models.SystemRoles() {
+			roles[role.Name] = role
+		}
+		return roles
+	}
+
+	rolesCache = roles
+	rolesLoadedAt = time.Now()
+	return rolesCache
+}
+
+// ClearRolesCache makes the next GetRoles read from the database; call it
+// after changing a role
+func ClearRolesCache() {
+	rolesMu.Lock()
+	rolesCache = nil
+	rolesMu.Unlock()
+}
+
+// loadRoles reads every role from the database
+func loadRoles(ctx context.Context) (map[string]models.Role, error) {
+	cursor, err := config.RolesCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Role
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	roles := make(map[string]models.Role, len(list))
+	for _, role := range list {
+		roles[role.Name] = role
+	}
+	return roles, nil
+}
+
+// RolePermissions returns the permissions role name carries; the admin role
+// always carries all of them
+func RolePermissions(roles map[string]models.Role, name string) []string {
+	if name == models.AdminRole {
+		return models.AllPermissions()
+	}
+	return roles[name].Permissions
+}
+
+// PrimaryRoleScope returns the department a primary role covers for a user
+// in department: their own for a departmental role, otherwise "" for all
+func PrimaryRoleScope(roles map[string]models.Role, name, department string) string {
+	if role, ok := roles[name]; ok && role.Departmental && name != models.AdminRole {
+		return department
+	}
+	return ""
+}
+
+// UserGrants works out the permissions user holds through their primary
+// role and role assignments. A departmental primary role covers the user's
+// own department; an assignment covers its department, or all of them when
+// it names none. leave.approve.hod is only granted to heads of department
+// (IsHOD), and only over their own department or an assignment's department.
+func UserGrants(ctx context.Context, user *models.User) models.Grants {
+	roles := GetRoles(ctx)
+	grants := models.Grants{}
+
+	grant := func(name, department, hodDepartment string) {
+		for _, perm := range RolePermissions(roles, name) {
+			if perm != models.PermLeaveApproveHOD {
+				grants.Add(perm, department)
+			} else if user.IsHOD && hodDepartment != "" {
+				grants.Add(perm, hodDepartment)
+			}
+		}
+	}
+
+	// A departmental role held without a department has nothing to cover
+	if role := roles[user.Role]; !role.Departmental || user.Role == models.AdminRole || user.Department != "" {
+		grant(user.Role, PrimaryRoleScope(roles, user.Role, user.Department), user.Department)
+	}
+	for _, assignment := range user.RoleAssignments {
+		grant(assignment.Role, assignment.Department, assignment.Department)
+	}
+	return grants
+}
+
+// GetCurrentGrants returns the current user's permissions, working them out
+// once per request
+func GetCurrentGrants(c *gin.Context) models.Grants {
+	if value, exists := c.Get("grants"); exists {
+		if grants, ok := value.(models.Grants); ok {
+			return grants
+		}
+	}
+	user, err := GetCurrentUser(c)
+	if err != nil {
+		return models.Grants{}
+	}
+	grants := UserGrants(c.Request.Context(), user)
+	c.Set("grants", grants)
+	return grants
+}
+
+// RequirePermission checks that the user holds at least one of perms in some
+// department. Handlers check the department of what is acted on.
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := GetCurrentUser(c); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "User not found in context",
+			})
+			c.Abort()
+			return
+		}
+
+		if !GetCurrentGrants(c).HasAny(perms...) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "Missing permission '" + strings.Join(perms, "' or '") + "'",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
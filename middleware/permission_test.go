@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/models"
+)
+
+// useSystemRoles serves the built-in roles from the cache for the test
+func useSystemRoles(t *testing.T) {
+	t.Helper()
+	roles := map[string]models.Role{}
+	for _, role := range models.SystemRoles() {
+		roles[role.Name] = role
+	}
+	rolesMu.Lock()
+	rolesCache, rolesLoadedAt = roles, time.Now().Add(time.Hour)
+	rolesMu.Unlock()
+	t.Cleanup(ClearRolesCache)
+}
+
+func TestUserGrantsHODStage(t *testing.T) {
+	useSystemRoles(t)
+
+	tests := []struct {
+		name   string
+		user   models.User
+		covers map[string]bool
+	}{
+		{
+			name:   "head of department",
+			user:   models.User{Role: "hod", IsHOD: true, Department: "NOC"},
+			covers: map[string]bool{"NOC": true, "VAS": false},
+		},
+		{
+			name:   "hod role without the flag",
+			user:   models.User{Role: "hod", Department: "NOC"},
+			covers: map[string]bool{"NOC": false},
+		},
+		{
+			name:   "admin flagged as head of department",
+			user:   models.User{Role: models.AdminRole, IsHOD: true, Department: "ADMIN"},
+			covers: map[string]bool{"ADMIN": true, "NOC": false},
+		},
+		{
+			name:   "admin",
+			user:   models.User{Role: models.AdminRole, Department: "ADMIN"},
+			covers: map[string]bool{"ADMIN": false, "NOC": false},
+		},
+		{
+			name: "assignment",
+			user: models.User{Role: "employee", IsHOD: true, Department: "NOC", RoleAssignments: []models.RoleAssignment{
+				{Role: "hod", Department: "VAS"},
+				{Role: "hod"},
+			}},
+			covers: map[string]bool{"VAS": true, "NOC": false, "FIELD": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grants := UserGrants(context.Background(), &tt.user)
+			for department, want := range tt.covers {
+				if got := grants.Covers(models.PermLeaveApproveHOD, department); got != want {
+					t.Errorf("covers HOD stage in %s = %v, want %v", department, got, want)
+				}
+			}
+		})
+	}
+
+	// Everything else the admin role carries still covers every department
+	admin := UserGrants(context.Background(), &models.User{Role: models.AdminRole, Department: "ADMIN"})
+	if !admin.Covers(models.PermLeaveApproveAny, "NOC") || !admin.Covers(models.PermUserManage, "NOC") {
+		t.Errorf("admin grants = %v", admin.List())
+	}
+}
+
+func TestStagePermissions(t *testing.T) {
+	if got := models.StagePermissions("HOD"); len(got) != 1 || got[0] != models.PermLeaveApproveHOD {
+		t.Errorf("HOD stage = %v, want only %s", got, models.PermLeaveApproveHOD)
+	}
+	for _, stage := range []string{"HR", "GED"} {
+		if got := models.StagePermissions(stage); len(got) != 2 || got[1] != models.PermLeaveApproveAny {
+			t.Errorf("%s stage = %v, want its permission and %s", stage, got, models.PermLeaveApproveAny)
+		}
+	}
+	if got := models.StagePermissions("CEO"); got != nil {
+		t.Errorf("unknown stage = %v", got)
+	}
+}
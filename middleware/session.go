@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	keptTokenHashes  = 10          // Rotated refresh tokens remembered per session for reuse detection
+	lastSeenInterval = time.Minute // How stale lastSeenAt may get before a request updates it
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// TokenPair is issued when a session starts and each time it is refreshed
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // Access token lifetime in seconds
+}
+
+// JSON returns the tokens as response fields. The access token keeps the
+// "token" key existing clients read.
+func (p *TokenPair) JSON() gin.H {
+	return gin.H{
+		"token":        p.AccessToken,
+		"refreshToken": p.RefreshToken,
+		"expiresIn":    p.ExpiresIn,
+	}
+}
+
+// InitSessions creates the session indexes. Sessions are deleted once they
+// expire, revoked or not.
+func InitSessions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.SessionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "refreshTokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "previousTokenHashes", Value: 1}}},
+		{Keys: bson.D{{Key: "user", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create session indexes: %v", err)
+	}
+}
+
+// accessTokenTTL is how long an access token is accepted (ACCESS_TOKEN_TTL_MINUTES)
+func accessTokenTTL() time.Duration {
+	return time.Duration(config.GetInt64("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+}
+
+// refreshTokenTTL is how long a session lasts from sign-in (REFRESH_TOKEN_TTL_HOURS)
+func refreshTokenTTL() time.Duration {
+	return time.Duration(config.GetInt64("REFRESH_TOKEN_TTL_HOURS", 720)) * time.Hour
+}
+
+// hashToken returns the stored form of a refresh token. The tokens are
+// random, so a plain SHA-256 is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken generates a refresh token and its hash
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// issueTokens signs an access token for the session and pairs it with the
+// session's new refresh token
+func issueTokens(userID, sessionID primitive.ObjectID, refreshToken string) (*TokenPair, error) {
+	accessToken, err := GenerateToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL().Seconds()),
+	}, nil
+}
+
+// StartSession signs a user in on a new session from the given client
+func StartSession(ctx context.Context, userID primitive.ObjectID, ipAddress, userAgent string) (*TokenPair, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:                  primitive.NewObjectID(),
+		User:                userID,
+		RefreshTokenHash:    hash,
+		PreviousTokenHashes: []string{},
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(refreshTokenTTL()),
+		IPAddress:           ipAddress,
+		UserAgent:           userAgent,
+		LastSeenAt:          now,
+	}
+	if _, err := config.SessionsCollection.InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return issueTokens(userID, session.ID, refreshToken)
+}
+
+// RefreshSession swaps a refresh token for a new token pair. Presenting a
+// token that was already swapped means it has been copied, so the session is
+// revoked and ErrRefreshTokenReused returned. The user must still be checked
+// by the caller.
+func RefreshSession(ctx context.Context, refreshToken, ipAddress, userAgent string) (*models.Session, *TokenPair, error) {
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash := hashToken(refreshToken)
+	now := time.Now()
+
+	var session models.Session
+	err = config.SessionsCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"refreshTokenHash": hash, "revokedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": now}},
+		bson.M{
+			"$set": bson.M{
+				"refreshTokenHash": newHash,
+				"rotatedAt":        now,
+				"ipAddress":        ipAddress,
+				"userAgent":        userAgent,
+				"lastSeenAt":       now,
+			},
+			"$push": bson.M{"previousTokenHashes": bson.M{
+				"$each":  []string{hash},
+				"$slice": -keptTokenHashes,
+			}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		result, err := config.SessionsCollection.UpdateOne(
+			ctx,
+			bson.M{"previousTokenHashes": hash, "revokedAt": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"revokedAt": now, "revokedReason": "refresh token reused"}},
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		if result.ModifiedCount > 0 {
+			return nil, nil, ErrRefreshTokenReused
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := issueTokens(session.User, session.ID, newToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &session, tokens, nil
+}
+
+// RevokeSession ends a session; access tokens issued for it stop working
+// straight away
+func RevokeSession(ctx context.Context, sessionID primitive.ObjectID, reason string) error {
+	_, err := config.SessionsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": sessionID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now(), "revokedReason": reason}},
+	)
+	return err
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to. It reports
+// false if the token does not belong to a live session.
+func RevokeRefreshToken(ctx context.Context, refreshToken, reason string) (bool, error) {
+	result, err := config.SessionsCollection.UpdateOne(
+		ctx,
+		bson.M{"refreshTokenHash": hashToken(refreshToken), "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now(), "revokedReason": reason}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// RevokeUserSessions ends every live session of a user except the one given,
+// which may be nil, and returns how many were ended
+func RevokeUserSessions(ctx context.Context, userID, except primitive.ObjectID, reason string) (int64, error) {
+	filter := bson.M{"user": userID, "revokedAt": bson.M{"$exists": false}}
+	if !except.IsZero() {
+		filter["_id"] = bson.M{"$ne": except}
+	}
+
+	result, err := config.SessionsCollection.UpdateMany(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"revokedAt": time.Now(), "revokedReason": reason}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ListSessions returns a user's live sessions, most recently used first
+func ListSessions(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	cursor, err := config.SessionsCollection.Find(
+		ctx,
+		bson.M{"user": userID, "revokedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// touchSession records that a session was just used, at most once per
+// lastSeenInterval to keep writes off the hot path
+func touchSession(ctx context.Context, session *models.Session, ipAddress string) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < lastSeenInterval && session.IPAddress == ipAddress {
+		return
+	}
+	_, err := config.SessionsCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": session.ID},
+		bson.M{"$set": bson.M{"lastSeenAt": now, "ipAddress": ipAddress}},
+	)
+	if err != nil {
+		log.Printf("⚠️  Failed to update session %s: %v", session.ID.Hex(), err)
+	}
+}
+
+// findSession loads a session by ID
+func findSession(ctx context.Context, sessionID primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	if err := config.SessionsCollection.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetCurrentSessionID gets the session the request was authenticated with
+func GetCurrentSessionID(c *gin.Context) (primitive.ObjectID, error) {
+	sessionID, ok := c.Get("sessionId")
+	if !ok {
+		return primitive.NilObjectID, jwt.ErrTokenMalformed
+	}
+	id, ok := sessionID.(primitive.ObjectID)
+	if !ok {
+		return primitive.NilObjectID, jwt.ErrTokenMalformed
+	}
+	return id, nil
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// settingsCacheTTL is how long an instance reuses the security settings
+// before reading them again, so changes made on another instance apply
+// within this time
+const settingsCacheTTL = 30 * time.Second
+
+var (
+	settingsMu       sync.Mutex
+	settingsCache    *models.SecuritySettings
+	settingsLoadedAt time.Time
+)
+
+// GetSecuritySettings returns the sign-in policy, with empty defaults when
+// none has been saved
+func GetSecuritySettings(ctx context.Context) (*models.SecuritySettings, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	if settingsCache != nil && time.Since(settingsLoadedAt) < settingsCacheTTL {
+		return settingsCache, nil
+	}
+
+	settings := models.SecuritySettings{ID: models.SecuritySettingsID, TwoFactorRequiredRoles: []string{}}
+	err := config.SettingsCollection.FindOne(ctx, bson.M{"_id": models.SecuritySettingsID}).Decode(&settings)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	settingsCache = &settings
+	settingsLoadedAt = time.Now()
+	return settingsCache, nil
+}
+
+// ClearSecuritySettingsCache makes the next GetSecuritySettings read from
+// the database; call it after saving the settings
+func ClearSecuritySettingsCache() {
+	settingsMu.Lock()
+	settingsCache = nil
+	settingsMu.Unlock()
+}
+
+// twoFactorSetupPending reports whether the user's role requires two-factor
+// authentication that they have not set up yet. Such users may only reach the
+// /auth routes, which include enrolment.
+func twoFactorSetupPending(ctx context.Context, user *models.User, path string) bool {
+	if user.TwoFactorEnabled || strings.HasPrefix(path, "/api/auth/") {
+		return false
+	}
+	settings, err := GetSecuritySettings(ctx)
+	if err != nil {
+		// Failing closed would lock every user out while the database is unreachable
+		return false
+	}
+	return settings.RequiresTwoFactor(user.Role)
+}
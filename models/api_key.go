@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// API key scopes. Each scope opens a set of read routes to keys that hold it.
+const (
+	ScopeLeavesRead = "leaves:read"
+	ScopeUsersRead  = "users:read"
+	ScopeAuditRead  = "audit:read"
+)
+
+// APIKeyScopes describes the scopes keys can be issued with
+var APIKeyScopes = map[string]string{
+	ScopeLeavesRead: "List leave requests across the organisation",
+	ScopeUsersRead:  "List users and their leave balances",
+	ScopeAuditRead:  "Read the security audit log",
+}
+
+// APIKey lets an integration call the API without signing in as a person.
+// Only a hash of the key is stored; the key itself is shown once, when issued.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"` // Start of the key, to tell keys apart
+	KeyHash    string             `bson:"keyHash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedBy  primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"expiresAt"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	LastUsedIP string             `bson:"lastUsedIp,omitempty" json:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	RevokedBy  primitive.ObjectID `bson:"revokedBy,omitempty" json:"revokedBy,omitempty"`
+}
+
+// IsActive reports whether the key can still be used
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
+
+// HasScope reports whether the key was issued with scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest is the data for issuing an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1,max=1825"` // Defaults to API_KEY_TTL_DAYS
+}
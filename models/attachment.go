@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attachment is a supporting document uploaded against a leave request,
+// such as a medical certificate. The file itself lives in the blob store.
+type Attachment struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Leave       primitive.ObjectID `bson:"leave" json:"leave"`
+	FileName    string             `bson:"fileName" json:"fileName"`
+	ContentType string             `bson:"contentType" json:"contentType"`
+	Size        int64              `bson:"size" json:"size"`
+	StorageKey  string             `bson:"storageKey" json:"-"`
+	UploadedBy  primitive.ObjectID `bson:"uploadedBy" json:"uploadedBy"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// Content types accepted for attachments, detected from the file contents
+var AllowedAttachmentTypes = []string{
+	"application/pdf", "image/jpeg", "image/png",
+}
+
+// IsAllowedAttachmentType checks if a detected content type may be uploaded
+func IsAllowedAttachmentType(contentType string) bool {
+	for _, t := range AllowedAttachmentTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit log actions
+const (
+	AuditAccountLocked     = "auth.account_locked"
+	AuditAccountUnlocked   = "auth.account_unlocked"
+	AuditIPLocked          = "auth.ip_locked"
+	AuditIPUnlocked        = "auth.ip_unlocked"
+	AuditUserProvisioned   = "user.provisioned"
+	AuditUserDeprovisioned = "user.deprovisioned"
+	AuditAPIKeyCreated     = "api_key.created"
+	AuditAPIKeyRevoked     = "api_key.revoked"
+	AuditRoleCreated       = "role.created"
+	AuditRoleUpdated       = "role.updated"
+	AuditRoleDeleted       = "role.deleted"
+	AuditRolesAssigned     = "user.roles_assigned"
+)
+
+// AuditLog records a security-relevant action for later review
+type AuditLog struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	Action    string                 `bson:"action" json:"action"`
+	Actor     primitive.ObjectID     `bson:"actor,omitempty" json:"actor,omitempty"`   // Who did it; empty when the system acted on its own
+	Target    primitive.ObjectID     `bson:"target,omitempty" json:"target,omitempty"` // User affected, if any
+	IPAddress string                 `bson:"ipAddress,omitempty" json:"ipAddress,omitempty"`
+	Details   map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CancellationRequest represents a request to cancel some or all of an approved leave
+type CancellationRequest struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Leave    primitive.ObjectID `bson:"leave" json:"leave"`
+	Employee primitive.ObjectID `bson:"employee" json:"employee"`
+	FromDate time.Time          `bson:"fromDate" json:"fromDate"` // First day to cancel, through the leave's last day
+	Partial  bool               `bson:"partial" json:"partial"`
+	Reason   string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	Status   string             `bson:"status" json:"status"`
+
+	RequestWorkflow `bson:",inline"`
+
+	RefundedDays int        `bson:"refundedDays" json:"refundedDays"` // Set once approved
+	DecidedAt    *time.Time `bson:"decidedAt,omitempty" json:"decidedAt,omitempty"`
+	CreatedAt    time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// CreateCancellationRequest represents cancellation request data
+type CreateCancellationRequest struct {
+	FromDate string `json:"fromDate,omitempty"` // Optional, cancels the whole remaining leave when omitted
+	Reason   string `json:"reason"`
+}
+
+// Valid cancellation request statuses
+var ValidCancellationStatuses = []string{
+	"Pending", "Approved", "Rejected", "Withdrawn",
+}
+
+// FirstUntakenDay returns the first day of leave that has not been taken yet
+func FirstUntakenDay(leave *Leave, now time.Time) time.Time {
+	today := now.Truncate(24 * time.Hour)
+	if today.Before(leave.FromDate) {
+		return leave.FromDate
+	}
+	return today.Add(24 * time.Hour)
+}
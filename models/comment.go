@@ -0,0 +1,43 @@
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CommentEditWindow is how long after posting a comment its author may edit it
+const CommentEditWindow = 15 * time.Minute
+
+// Comment is a message in the discussion thread on a leave request
+type Comment struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Leave     primitive.ObjectID   `bson:"leave" json:"leave"`
+	Author    primitive.ObjectID   `bson:"author" json:"author"`
+	Body      string               `bson:"body" json:"body"`
+	Mentions  []primitive.ObjectID `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	EditedAt  *time.Time           `bson:"editedAt,omitempty" json:"editedAt,omitempty"`
+	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
+}
+
+// CommentRequest represents the body of a new or edited comment
+type CommentRequest struct {
+	Body string `json:"body" binding:"required,max=2000"`
+}
+
+// mentionPattern matches "@" followed by an email address, e.g. "@jane@example.com"
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+// ParseMentions returns the distinct email addresses mentioned in a comment body
+func ParseMentions(body string) []string {
+	seen := map[string]bool{}
+	emails := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			emails = append(emails, match[1])
+		}
+	}
+	return emails
+}
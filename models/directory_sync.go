@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DirectoryLink ties a user to their LDAP directory entry
+type DirectoryLink struct {
+	DN       string    `bson:"dn" json:"dn"`
+	SyncedAt time.Time `bson:"syncedAt" json:"syncedAt"`
+
+	// Set when the sync deactivated the account, so it is reactivated if the entry comes back
+	Deactivated bool `bson:"deactivated,omitempty" json:"deactivated,omitempty"`
+}
+
+// DirectorySyncReport lists what a directory sync changed, or would change on a dry run
+type DirectorySyncReport struct {
+	DryRun      bool                  `json:"dryRun"`
+	Entries     int                   `json:"entries"` // Users found in the directory
+	Created     []DirectorySyncChange `json:"created"`
+	Updated     []DirectorySyncChange `json:"updated"`
+	Reactivated []DirectorySyncChange `json:"reactivated"`
+	Deactivated []DirectorySyncChange `json:"deactivated"`
+	Skipped     []DirectorySyncSkip   `json:"skipped"`
+	Unchanged   int                   `json:"unchanged"`
+	StartedAt   time.Time             `json:"startedAt"`
+	FinishedAt  time.Time             `json:"finishedAt"`
+}
+
+// DirectorySyncChange is one user created, updated or deactivated by a sync
+type DirectorySyncChange struct {
+	UserID  primitive.ObjectID            `json:"userId,omitempty"`
+	Email   string                        `json:"email"`
+	DN      string                        `json:"dn,omitempty"`
+	Changes map[string]DirectoryFieldDiff `json:"changes,omitempty"`
+}
+
+// DirectoryFieldDiff is the old and new value of a field
+type DirectoryFieldDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DirectorySyncSkip is a directory entry the sync could not apply
+type DirectorySyncSkip struct {
+	DN     string `json:"dn"`
+	Email  string `json:"email,omitempty"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExtensionRequest represents a request to extend an active leave
+type ExtensionRequest struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Leave     primitive.ObjectID `bson:"leave" json:"leave"`
+	Employee  primitive.ObjectID `bson:"employee" json:"employee"`
+	NewToDate time.Time          `bson:"newToDate" json:"newToDate"`
+	ExtraDays int                `bson:"extraDays" json:"extraDays"` // Deducted from balance when filed
+	Reason    string             `bson:"reason" json:"reason"`
+	Status    string             `bson:"status" json:"status"`
+
+	RequestWorkflow `bson:",inline"`
+
+	DecidedAt *time.Time `bson:"decidedAt,omitempty" json:"decidedAt,omitempty"`
+	CreatedAt time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// CreateExtensionRequest represents extension request data
+type CreateExtensionRequest struct {
+	NewToDate string `json:"newToDate" binding:"required"`
+	Reason    string `json:"reason" binding:"required"`
+}
+
+// Valid extension request statuses
+var ValidExtensionStatuses = []string{
+	"Pending", "Approved", "Rejected", "Withdrawn",
+}
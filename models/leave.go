@@ -26,16 +26,34 @@ type Leave struct {
 	HODApprovalDate    *time.Time         `bson:"hodApprovalDate,omitempty" json:"hodApprovalDate,omitempty"`
 	HODApprovalComment string             `bson:"hodApprovalComment,omitempty" json:"hodApprovalComment,omitempty"`
 	HODApprover        primitive.ObjectID `bson:"hodApprover,omitempty" json:"hodApprover,omitempty"`
+	HODDelegate        primitive.ObjectID `bson:"hodDelegate,omitempty" json:"hodDelegate,omitempty"`
 
 	HRApprovalStatus  string             `bson:"hrApprovalStatus" json:"hrApprovalStatus"`
 	HRApprovalDate    *time.Time         `bson:"hrApprovalDate,omitempty" json:"hrApprovalDate,omitempty"`
 	HRApprovalComment string             `bson:"hrApprovalComment,omitempty" json:"hrApprovalComment,omitempty"`
 	HRApprover        primitive.ObjectID `bson:"hrApprover,omitempty" json:"hrApprover,omitempty"`
+	HRDelegate        primitive.ObjectID `bson:"hrDelegate,omitempty" json:"hrDelegate,omitempty"`
 
 	GEDApprovalStatus  string             `bson:"gedApprovalStatus" json:"gedApprovalStatus"`
 	GEDApprovalDate    *time.Time         `bson:"gedApprovalDate,omitempty" json:"gedApprovalDate,omitempty"`
 	GEDApprovalComment string             `bson:"gedApprovalComment,omitempty" json:"gedApprovalComment,omitempty"`
 	GEDApprover        primitive.ObjectID `bson:"gedApprover,omitempty" json:"gedApprover,omitempty"`
+	GEDDelegate        primitive.ObjectID `bson:"gedDelegate,omitempty" json:"gedDelegate,omitempty"`
+
+	// Return-for-changes tracking
+	ReturnedStage string              `bson:"returnedStage,omitempty" json:"returnedStage,omitempty"`
+	History       []LeaveHistoryEntry `bson:"history,omitempty" json:"history,omitempty"`
+
+	// Set when the employee is called back before the leave ends
+	Recall *LeaveRecall `bson:"recall,omitempty" json:"recall,omitempty"`
+
+	// Set when HR records the leave on the employee's behalf
+	FiledBy   primitive.ObjectID `bson:"filedBy,omitempty" json:"filedBy,omitempty"`
+	Backdated bool               `bson:"backdated,omitempty" json:"backdated,omitempty"`
+
+	// Set by the scheduled jobs chasing approvals that have stalled
+	ReminderSentAt *time.Time `bson:"reminderSentAt,omitempty" json:"reminderSentAt,omitempty"`
+	EscalatedAt    *time.Time `bson:"escalatedAt,omitempty" json:"escalatedAt,omitempty"`
 
 	IsEditable bool      `bson:"isEditable" json:"isEditable"`
 	IsActive   bool      `bson:"isActive" json:"isActive"`
@@ -43,6 +61,77 @@ type Leave struct {
 	UpdatedAt  time.Time `bson:"updatedAt" json:"updatedAt"`
 }
 
+// LeaveHistoryEntry records one workflow action taken on a leave request
+type LeaveHistoryEntry struct {
+	Action   string                 `bson:"action" json:"action"`
+	Stage    string                 `bson:"stage,omitempty" json:"stage,omitempty"`
+	Actor    primitive.ObjectID     `bson:"actor" json:"actor"`
+	Comments string                 `bson:"comments,omitempty" json:"comments,omitempty"`
+	Changes  map[string]interface{} `bson:"changes,omitempty" json:"changes,omitempty"`
+	Date     time.Time              `bson:"date" json:"date"`
+}
+
+// PendingStage returns the approval stage ("HOD", "HR" or "GED") currently
+// awaiting a decision, or an empty string if none is
+func (l *Leave) PendingStage() string {
+	switch {
+	case l.HODApprovalStatus == "pending":
+		return "HOD"
+	case !IsStageCleared(l.HODApprovalStatus):
+		return ""
+	case l.HRApprovalStatus == "pending":
+		return "HR"
+	case !IsStageCleared(l.HRApprovalStatus):
+		return ""
+	case l.GEDApprovalStatus == "pending":
+		return "GED"
+	}
+	return ""
+}
+
+// IsFinalStage reports whether approving the given stage completes the
+// workflow, i.e. every later stage has been skipped
+func (l *Leave) IsFinalStage(stage string) bool {
+	switch stage {
+	case "HOD":
+		return l.HRApprovalStatus == "skipped" && l.GEDApprovalStatus == "skipped"
+	case "HR":
+		return l.GEDApprovalStatus == "skipped"
+	case "GED":
+		return true
+	}
+	return false
+}
+
+// StageStatus returns the approval status recorded for a stage
+func (l *Leave) StageStatus(stage string) string {
+	switch stage {
+	case "HOD":
+		return l.HODApprovalStatus
+	case "HR":
+		return l.HRApprovalStatus
+	case "GED":
+		return l.GEDApprovalStatus
+	}
+	return ""
+}
+
+// LeaveRecall records an employee being called back early from leave
+type LeaveRecall struct {
+	ReturnDate     time.Time          `bson:"returnDate" json:"returnDate"` // First working day back
+	OriginalToDate time.Time          `bson:"originalToDate" json:"originalToDate"`
+	RefundedDays   int                `bson:"refundedDays" json:"refundedDays"`
+	Reason         string             `bson:"reason" json:"reason"`
+	RecalledBy     primitive.ObjectID `bson:"recalledBy" json:"recalledBy"`
+	RecalledAt     time.Time          `bson:"recalledAt" json:"recalledAt"`
+}
+
+// RecallLeaveRequest represents recall/early return data
+type RecallLeaveRequest struct {
+	ReturnDate string `json:"returnDate" binding:"required"`
+	Reason     string `json:"reason" binding:"required"`
+}
+
 // ApprovalStep represents one approval in the workflow
 type ApprovalStep struct {
 	Approver primitive.ObjectID `bson:"approver" json:"approver"`
@@ -52,6 +141,21 @@ type ApprovalStep struct {
 	Date     time.Time          `bson:"date" json:"date"`
 }
 
+// RequestWorkflow tracks a configurable approval path for follow-up requests on a leave
+type RequestWorkflow struct {
+	Path        []string       `bson:"path" json:"path"`
+	CurrentStep int            `bson:"currentStep" json:"currentStep"`
+	Approvals   []ApprovalStep `bson:"approvals" json:"approvals"`
+}
+
+// CurrentStage returns the stage awaiting a decision, or an empty string once the path is complete
+func (w *RequestWorkflow) CurrentStage() string {
+	if w.CurrentStep < len(w.Path) {
+		return w.Path[w.CurrentStep]
+	}
+	return ""
+}
+
 // LeaveResponse includes populated user data
 type LeaveResponse struct {
 	ID             primitive.ObjectID   `json:"id"`
@@ -83,6 +187,12 @@ type LeaveResponse struct {
 	GEDApprovalComment string        `json:"gedApprovalComment,omitempty"`
 	GEDApprover        *ApproverInfo `json:"gedApprover,omitempty"`
 
+	ReturnedStage string              `json:"returnedStage,omitempty"`
+	History       []LeaveHistoryEntry `json:"history,omitempty"`
+	Recall        *LeaveRecall        `json:"recall,omitempty"`
+	FiledBy       *ApproverInfo       `json:"filedBy,omitempty"`
+	Backdated     bool                `json:"backdated,omitempty"`
+
 	IsEditable bool      `json:"isEditable"`
 	IsActive   bool      `json:"isActive"`
 	CreatedAt  time.Time `json:"createdAt"`
@@ -116,6 +226,21 @@ type CreateLeaveRequest struct {
 	Reliever       string `json:"reliever" binding:"required"`
 }
 
+// RecordLeaveRequest represents leave recorded by HR on an employee's behalf.
+// ApprovalPath lists the stages that still need to review the leave and
+// defaults to the full HOD, HR, GED workflow; PreApproved skips review entirely.
+type RecordLeaveRequest struct {
+	Employee       string   `json:"employee" binding:"required"`
+	LeaveType      string   `json:"leaveType" binding:"required"`
+	OtherLeaveType string   `json:"otherLeaveType,omitempty"`
+	FromDate       string   `json:"fromDate" binding:"required"`
+	ToDate         string   `json:"toDate" binding:"required"`
+	Reason         string   `json:"reason" binding:"required"`
+	Reliever       string   `json:"reliever,omitempty"`
+	ApprovalPath   []string `json:"approvalPath,omitempty"`
+	PreApproved    bool     `json:"preApproved"`
+}
+
 // UpdateLeaveRequest represents leave update data
 type UpdateLeaveRequest struct {
 	LeaveType      string `json:"leaveType"`
@@ -138,7 +263,7 @@ var ValidLeaveTypes = []string{
 
 // Valid leave statuses
 var ValidLeaveStatuses = []string{
-	"Pending", "Active", "Approved", "Rejected", "Over", "Cancelled",
+	"Pending", "Active", "Approved", "Rejected", "Over", "Cancelled", "Returned",
 }
 
 // Valid approval roles
@@ -148,7 +273,28 @@ var ValidApprovalRoles = []string{
 
 // Valid approval stage statuses
 var ValidApprovalStageStatuses = []string{
-	"pending", "approved", "rejected",
+	"pending", "approved", "rejected", "skipped", "returned",
+}
+
+// Valid leave history actions
+var ValidLeaveHistoryActions = []string{
+	"returned", "resubmitted", "cancellation_approved", "recalled", "extended", "recorded",
+	"escalated",
+}
+
+// Stage statuses that let the workflow move on to the next stage
+var ClearedApprovalStageStatuses = []string{
+	"approved", "skipped",
+}
+
+// IsStageCleared checks if an approval stage no longer blocks the next one
+func IsStageCleared(status string) bool {
+	for _, s := range ClearedApprovalStageStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
 }
 
 // IsValidLeaveType checks if leave type is valid
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Login throttling subjects
+const (
+	LoginSubjectAccount = "account"
+	LoginSubjectIP      = "ip"
+)
+
+// LoginAttempts tracks recent failed sign-ins for one account or IP address
+type LoginAttempts struct {
+	ID            string     `bson:"_id" json:"id"`          // Kind and subject, e.g. "account:jane@example.com"
+	Kind          string     `bson:"kind" json:"kind"`       // LoginSubjectAccount or LoginSubjectIP
+	Subject       string     `bson:"subject" json:"subject"` // Lower-cased email or IP address
+	Failures      int64      `bson:"failures" json:"failures"`
+	LastFailureAt time.Time  `bson:"lastFailureAt" json:"lastFailureAt"`
+	BlockedUntil  *time.Time `bson:"blockedUntil,omitempty" json:"blockedUntil,omitempty"` // Progressive delay before the next try
+	LockedUntil   *time.Time `bson:"lockedUntil,omitempty" json:"lockedUntil,omitempty"`   // Lockout after too many failures
+	ExpiresAt     time.Time  `bson:"expiresAt" json:"-"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification channels
+const (
+	ChannelEmail = "email"
+	ChannelInApp = "inApp"
+)
+
+// DailyDigest is the notification type of the daily summary. It is not a
+// leave event but has channel preferences like one.
+const DailyDigest = "digest.daily"
+
+// Notification is an entry in a user's in-app notification inbox
+type Notification struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	User      primitive.ObjectID     `bson:"user" json:"user"`
+	Event     primitive.ObjectID     `bson:"event,omitempty" json:"-"` // Event that caused it, unique per user
+	Type      string                 `bson:"type" json:"type"`
+	Leave     primitive.ObjectID     `bson:"leave" json:"leave"`
+	Actor     primitive.ObjectID     `bson:"actor,omitempty" json:"actor,omitempty"`
+	Title     string                 `bson:"title" json:"title"`
+	Data      map[string]interface{} `bson:"data,omitempty" json:"data,omitempty"`
+	Read      bool                   `bson:"read" json:"read"`
+	ReadAt    *time.Time             `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	CreatedAt time.Time              `bson:"createdAt" json:"createdAt"`
+}
+
+// NotificationChannels records which channels a user wants an event type on
+type NotificationChannels struct {
+	Email bool `bson:"email" json:"email"`
+	InApp bool `bson:"inApp" json:"inApp"`
+}
+
+// UpdateNotificationPreferencesRequest represents notification preference
+// changes keyed by event type, and when the daily digest should arrive
+type UpdateNotificationPreferencesRequest struct {
+	Preferences map[string]NotificationChannels `json:"preferences"`
+	DigestTime  *string                         `json:"digestTime"` // "HH:MM" in the user's timezone
+	Timezone    *string                         `json:"timezone"`   // IANA name such as "Africa/Lagos"
+}
+
+// NotificationPreferenceKey returns the key an event type's preference is
+// stored under. Dots would be read as nested fields by MongoDB.
+func NotificationPreferenceKey(eventType string) string {
+	return strings.ReplaceAll(eventType, ".", "_")
+}
+
+// WantsNotification reports whether the user wants eventType delivered on channel
+func (u *User) WantsNotification(eventType, channel string) bool {
+	channels, ok := u.NotificationPreferences[NotificationPreferenceKey(eventType)]
+	if !ok {
+		return true
+	}
+
+	switch channel {
+	case ChannelEmail:
+		return channels.Email
+	case ChannelInApp:
+		return channels.InApp
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OIDCLogin is a single sign-on attempt waiting for the provider to send the
+// user back. It is looked up by the hash of the state sent to the provider.
+type OIDCLogin struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StateHash    string             `bson:"stateHash" json:"-"`
+	CodeVerifier string             `bson:"codeVerifier" json:"-"` // PKCE verifier proving this server started the flow
+	Nonce        string             `bson:"nonce" json:"-"`
+	ExpiresAt    time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
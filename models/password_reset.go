@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PasswordReset is an emailed, single-use token for choosing a new password.
+// Only a hash of the token is stored.
+type PasswordReset struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	User        primitive.ObjectID `bson:"user" json:"user"`
+	TokenHash   string             `bson:"tokenHash" json:"-"`
+	RequestedIP string             `bson:"requestedIp" json:"requestedIp"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+	UsedAt      *time.Time         `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// ForgotPasswordRequest asks for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest sets a new password with an emailed token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required,min=6"`
+}
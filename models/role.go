@@ -0,0 +1,230 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Permissions roles are made of
+const (
+	PermLeaveView        = "leave.view"
+	PermLeaveApproveHOD  = "leave.approve.hod"
+	PermLeaveApproveHR   = "leave.approve.hr"
+	PermLeaveApproveGED  = "leave.approve.ged"
+	PermLeaveApproveAny  = "leave.approve.any"
+	PermLeaveRecord      = "leave.record"
+	PermLeaveRecall      = "leave.recall"
+	PermLeaveManage      = "leave.manage"
+	PermLeaveAttachments = "leave.attachments"
+	PermUserManage       = "user.manage"
+	PermBalanceAdjust    = "balance.adjust"
+	PermRoleManage       = "role.manage"
+	PermAuditRead        = "audit.read"
+	PermSystemManage     = "system.manage"
+)
+
+// Permissions describes every permission
+var Permissions = map[string]string{
+	PermLeaveView:        "See other employees' leave requests and follow-up requests",
+	PermLeaveApproveHOD:  "Decide leave at the HOD stage (heads of department only)",
+	PermLeaveApproveHR:   "Decide leave at the HR stage",
+	PermLeaveApproveGED:  "Decide leave at the GED stage",
+	PermLeaveApproveAny:  "Decide leave at the HR and GED stages",
+	PermLeaveRecord:      "Record leave on an employee's behalf",
+	PermLeaveRecall:      "Recall employees from approved leave",
+	PermLeaveManage:      "Edit, cancel and delete other employees' leave",
+	PermLeaveAttachments: "Add and remove attachments on other employees' leave",
+	PermUserManage:       "Create, update, deactivate and sign out users",
+	PermBalanceAdjust:    "Adjust leave balances",
+	PermRoleManage:       "Manage roles and role assignments",
+	PermAuditRead:        "Read the audit log",
+	PermSystemManage:     "Manage security settings, API keys, webhooks, jobs and directory sync",
+}
+
+// ApprovePermissions are the permissions to decide leave at some stage
+var ApprovePermissions = []string{
+	PermLeaveApproveHOD, PermLeaveApproveHR, PermLeaveApproveGED, PermLeaveApproveAny,
+}
+
+// StagePermission returns the permission to decide leave at stage ("HOD", "HR" or "GED")
+func StagePermission(stage string) string {
+	switch stage {
+	case "HOD":
+		return PermLeaveApproveHOD
+	case "HR":
+		return PermLeaveApproveHR
+	case "GED":
+		return PermLeaveApproveGED
+	}
+	return ""
+}
+
+// StagePermissions returns the permissions that decide leave at stage.
+// leave.approve.any stands in for HR and GED, but the HOD stage is left to
+// heads of department.
+func StagePermissions(stage string) []string {
+	perm := StagePermission(stage)
+	switch {
+	case perm == "":
+		return nil
+	case stage == "HOD":
+		return []string{perm}
+	}
+	return []string{perm, PermLeaveApproveAny}
+}
+
+// AllPermissions returns every permission, sorted
+func AllPermissions() []string {
+	perms := make([]string, 0, len(Permissions))
+	for perm := range Permissions {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// IsValidPermission checks if perm is a known permission
+func IsValidPermission(perm string) bool {
+	_, ok := Permissions[perm]
+	return ok
+}
+
+// AdminRole always holds every permission, so admins cannot lock themselves out
+const AdminRole = "admin"
+
+// Role is a named bundle of permissions. Users hold their primary role
+// (User.Role) plus any role assignments.
+type Role struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Permissions []string           `bson:"permissions" json:"permissions"`
+	// Held as a primary role, the role covers the holder's own department only
+	Departmental bool      `bson:"departmental" json:"departmental"`
+	System       bool      `bson:"system" json:"system"` // Built-in role; cannot be deleted
+	CreatedAt    time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// SystemRoles are the built-in roles, granting what each role could do
+// before permissions existed. They are created on startup when missing.
+// leave.approve.hod only takes effect for users flagged IsHOD, and only over
+// their own department when it comes from their primary role.
+func SystemRoles() []Role {
+	return []Role{
+		{
+			Name:        "employee",
+			Description: "Requests and manages their own leave",
+			Permissions: []string{},
+		},
+		{
+			Name:         "hod",
+			Description:  "Head of department; first approver for their department",
+			Permissions:  []string{PermLeaveView, PermLeaveApproveHOD, PermLeaveRecall},
+			Departmental: true,
+		},
+		{
+			Name:        "hr",
+			Description: "Human resources; second approver and leave records",
+			Permissions: []string{PermLeaveView, PermLeaveApproveHR, PermLeaveRecord, PermLeaveRecall, PermLeaveAttachments},
+		},
+		{
+			Name:        "ged",
+			Description: "Group executive director; final approver",
+			Permissions: []string{PermLeaveView, PermLeaveApproveGED},
+		},
+		{
+			Name:        AdminRole,
+			Description: "Full access",
+			Permissions: AllPermissions(),
+		},
+	}
+}
+
+// RoleAssignment grants a role in addition to the user's primary role,
+// limited to one department or, with no department, covering all of them
+type RoleAssignment struct {
+	Role       string `bson:"role" json:"role" binding:"required"`
+	Department string `bson:"department,omitempty" json:"department,omitempty"`
+}
+
+// Grants maps each permission a user holds to the departments it covers;
+// the empty department stands for all departments
+type Grants map[string]map[string]bool
+
+// Add grants perm over department, or over all departments when department is empty
+func (g Grants) Add(perm, department string) {
+	if g[perm] == nil {
+		g[perm] = map[string]bool{}
+	}
+	g[perm][department] = true
+}
+
+// Has reports whether perm is held over any department
+func (g Grants) Has(perm string) bool {
+	return len(g[perm]) > 0
+}
+
+// HasAny reports whether any of perms is held over any department
+func (g Grants) HasAny(perms ...string) bool {
+	for _, perm := range perms {
+		if g.Has(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether perm is held over department
+func (g Grants) Covers(perm, department string) bool {
+	return g[perm][""] || (department != "" && g[perm][department])
+}
+
+// Departments returns the departments perm covers, with all set when it
+// covers every department
+func (g Grants) Departments(perm string) (departments []string, all bool) {
+	for department := range g[perm] {
+		if department == "" {
+			return nil, true
+		}
+		departments = append(departments, department)
+	}
+	sort.Strings(departments)
+	return departments, false
+}
+
+// List returns the grants for display: each permission with the departments
+// it covers, or "*" for all departments
+func (g Grants) List() map[string][]string {
+	list := map[string][]string{}
+	for perm := range g {
+		departments, all := g.Departments(perm)
+		if all {
+			departments = []string{"*"}
+		}
+		list[perm] = departments
+	}
+	return list
+}
+
+// CreateRoleRequest is the request to add a custom role
+type CreateRoleRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Description  string   `json:"description"`
+	Permissions  []string `json:"permissions" binding:"required"`
+	Departmental bool     `json:"departmental"`
+}
+
+// UpdateRoleRequest changes a role; omitted fields are left alone
+type UpdateRoleRequest struct {
+	Description  *string  `json:"description"`
+	Permissions  []string `json:"permissions"`
+	Departmental *bool    `json:"departmental"`
+}
+
+// UpdateRoleAssignmentsRequest replaces a user's role assignments
+type UpdateRoleAssignmentsRequest struct {
+	Assignments []RoleAssignment `json:"assignments" binding:"dive"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a signed-in device. Its refresh token rotates on every use and
+// only a hash of it is stored.
+type Session struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	User                primitive.ObjectID `bson:"user" json:"user"`
+	RefreshTokenHash    string             `bson:"refreshTokenHash" json:"-"`
+	PreviousTokenHashes []string           `bson:"previousTokenHashes" json:"-"` // Recently rotated tokens, to detect reuse
+	CreatedAt           time.Time          `bson:"createdAt" json:"createdAt"`
+	RotatedAt           *time.Time         `bson:"rotatedAt,omitempty" json:"rotatedAt,omitempty"`
+	ExpiresAt           time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt           *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+	RevokedReason       string             `bson:"revokedReason,omitempty" json:"revokedReason,omitempty"`
+
+	// Where the session is used from, updated as it is used
+	IPAddress  string    `bson:"ipAddress" json:"ipAddress"`
+	UserAgent  string    `bson:"userAgent" json:"userAgent"`
+	LastSeenAt time.Time `bson:"lastSeenAt" json:"lastSeenAt"`
+
+	Current bool `bson:"-" json:"current"` // Set when listing the requester's own sessions
+}
+
+// IsActive reports whether the session can still be used at now
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshTokenRequest carries a refresh token for /auth/refresh and /auth/logout
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SecuritySettingsID is the _id of the security settings document
+const SecuritySettingsID = "security"
+
+// SecuritySettings holds the organisation-wide sign-in policy set by admins
+type SecuritySettings struct {
+	ID                     string             `bson:"_id" json:"-"`
+	TwoFactorRequiredRoles []string           `bson:"twoFactorRequiredRoles" json:"twoFactorRequiredRoles"` // Roles that must use two-factor authentication
+	UpdatedBy              primitive.ObjectID `bson:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+	UpdatedAt              time.Time          `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// RequiresTwoFactor reports whether users with role must use two-factor authentication
+func (s *SecuritySettings) RequiresTwoFactor(role string) bool {
+	for _, r := range s.TwoFactorRequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginChallenge is the half-finished sign-in of a user with two-factor
+// authentication, waiting for their code. Only a hash of its token is stored.
+type LoginChallenge struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	User      primitive.ObjectID `bson:"user" json:"user"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	Attempts  int                `bson:"attempts" json:"attempts"` // Wrong codes entered so far
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// TwoFactorCodeRequest carries a code from the user's authenticator app
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginRequest completes a sign-in with an authenticator or recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest turns two-factor authentication off
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// UpdateTwoFactorPolicyRequest sets which roles must use two-factor authentication
+type UpdateTwoFactorPolicyRequest struct {
+	RequiredRoles []string `json:"requiredRoles"`
+}
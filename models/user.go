@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,12 +17,41 @@ type User struct {
 	StaffID      string             `bson:"staffId" json:"staffId"`
 	Department   string             `bson:"department" json:"department" binding:"required"`
 	Role         string             `bson:"role" json:"role"`
-	IsHOD        bool               `bson:"isHOD" json:"isHOD"` // Head of Department flag
+	IsHOD        bool               `bson:"isHOD" json:"isHOD"`                       // Head of Department flag
+	Deputy       primitive.ObjectID `bson:"deputy,omitempty" json:"deputy,omitempty"` // Alternate approver for this user's own leave
 	Signature    string             `bson:"signature,omitempty" json:"signature,omitempty"`
 	LeaveBalance LeaveBalance       `bson:"leaveBalance" json:"leaveBalance"`
 	IsActive     bool               `bson:"isActive" json:"isActive"`
 	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
 	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
+
+	// Roles held on top of Role, each optionally limited to a department
+	RoleAssignments []RoleAssignment `bson:"roleAssignments,omitempty" json:"roleAssignments,omitempty"`
+
+	// Per event type channel choices, keyed by NotificationPreferenceKey; event types not listed use every channel
+	NotificationPreferences map[string]NotificationChannels `bson:"notificationPreferences,omitempty" json:"-"`
+
+	// When the daily digest arrives; empty fields use the server defaults
+	DigestTime   string `bson:"digestTime,omitempty" json:"-"`   // "HH:MM" in Timezone
+	Timezone     string `bson:"timezone,omitempty" json:"-"`     // IANA name such as "Africa/Lagos"
+	DigestSentOn string `bson:"digestSentOn,omitempty" json:"-"` // Local date of the last digest
+
+	// TOTP two-factor authentication. The pending secret is held until the
+	// user proves their authenticator app works; recovery codes are hashed.
+	TwoFactorEnabled       bool     `bson:"twoFactorEnabled" json:"twoFactorEnabled"`
+	TwoFactorSecret        string   `bson:"twoFactorSecret,omitempty" json:"-"`
+	TwoFactorPendingSecret string   `bson:"twoFactorPendingSecret,omitempty" json:"-"`
+	TwoFactorRecoveryCodes []string `bson:"twoFactorRecoveryCodes,omitempty" json:"-"`
+	TwoFactorLastStep      int64    `bson:"twoFactorLastStep,omitempty" json:"-"` // Last TOTP time step used, so codes cannot be replayed
+
+	// Subject of the corporate identity the account signs in with, linked on first single sign-on
+	OIDCSubject string `bson:"oidcSubject,omitempty" json:"-"`
+
+	// Identifier the provisioning identity provider knows the account by (SCIM externalId)
+	ExternalID string `bson:"externalId,omitempty" json:"-"`
+
+	// Directory entry the account is kept in step with by the LDAP sync
+	Directory *DirectoryLink `bson:"directory,omitempty" json:"-"`
 }
 
 // LeaveBalance represents user's leave balance
@@ -29,6 +59,9 @@ type LeaveBalance struct {
 	Total     int `bson:"total" json:"total"`
 	Available int `bson:"available" json:"available"`
 	Used      int `bson:"used" json:"used"`
+
+	// Month ("2006-01") of the last accrual credited by the scheduler
+	AccruedThrough string `bson:"accruedThrough,omitempty" json:"accruedThrough,omitempty"`
 }
 
 // UserResponse is the response structure (without password)
@@ -41,11 +74,16 @@ type UserResponse struct {
 	Department   string             `json:"department"`
 	Role         string             `json:"role"`
 	IsHOD        bool               `json:"isHOD"`
+	Deputy       primitive.ObjectID `json:"deputy,omitempty"`
 	Signature    string             `json:"signature,omitempty"`
 	LeaveBalance LeaveBalance       `json:"leaveBalance"`
 	IsActive     bool               `json:"isActive"`
 	CreatedAt    time.Time          `json:"createdAt"`
 	UpdatedAt    time.Time          `json:"updatedAt"`
+
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
+
+	RoleAssignments []RoleAssignment `json:"roleAssignments,omitempty"`
 }
 
 // ToResponse converts User to UserResponse
@@ -59,11 +97,15 @@ func (u *User) ToResponse() UserResponse {
 		Department:   u.Department,
 		Role:         u.Role,
 		IsHOD:        u.IsHOD,
+		Deputy:       u.Deputy,
 		Signature:    u.Signature,
 		LeaveBalance: u.LeaveBalance,
 		IsActive:     u.IsActive,
 		CreatedAt:    u.CreatedAt,
 		UpdatedAt:    u.UpdatedAt,
+
+		TwoFactorEnabled: u.TwoFactorEnabled,
+		RoleAssignments:  u.RoleAssignments,
 	}
 }
 
@@ -131,3 +173,32 @@ func IsValidRole(role string) bool {
 	}
 	return false
 }
+
+// CanonicalDepartment returns the department matching dept regardless of
+// case and surrounding spaces, or "" when there is none
+func CanonicalDepartment(dept string) string {
+	dept = strings.TrimSpace(dept)
+	for _, d := range ValidDepartments {
+		if strings.EqualFold(d, dept) {
+			return d
+		}
+	}
+	return ""
+}
+
+// HighestRole returns the most privileged of roles, or "" when none is valid
+func HighestRole(roles []string) string {
+	best := -1
+	for _, role := range roles {
+		// ValidRoles runs from least to most privileged
+		for i, valid := range ValidRoles {
+			if role == valid && i > best {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return ValidRoles[best]
+}
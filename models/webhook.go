@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookSubscription sends leave events to an external system such as payroll
+type WebhookSubscription struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	URL         string             `bson:"url" json:"url"`
+	Events      []string           `bson:"events" json:"events"` // Empty means every event type
+	Secret      string             `bson:"secret" json:"-"`      // HMAC key for the signature header
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	IsActive    bool               `bson:"isActive" json:"isActive"`
+	CreatedBy   primitive.ObjectID `bson:"createdBy" json:"createdBy"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Wants reports whether the subscription receives events of the given type
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, t := range s.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to a subscription
+type WebhookDelivery struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Key            string              `bson:"key,omitempty" json:"-"` // Event and subscription; unset on redeliveries
+	Subscription   primitive.ObjectID  `bson:"subscription" json:"subscription"`
+	EventID        primitive.ObjectID  `bson:"eventId" json:"eventId"`
+	EventType      string              `bson:"eventType" json:"eventType"`
+	Payload        string              `bson:"payload" json:"payload"` // Exact request body that is signed
+	Status         string              `bson:"status" json:"status"`
+	Attempts       int                 `bson:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time           `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time          `bson:"lastAttemptAt,omitempty" json:"lastAttemptAt,omitempty"`
+	ResponseStatus int                 `bson:"responseStatus,omitempty" json:"responseStatus,omitempty"`
+	LastError      string              `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	RedeliveryOf   *primitive.ObjectID `bson:"redeliveryOf,omitempty" json:"redeliveryOf,omitempty"`
+	DeliveredAt    *time.Time          `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time           `bson:"createdAt" json:"createdAt"`
+}
+
+// CreateWebhookRequest represents a new webhook subscription
+type CreateWebhookRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	URL         string   `json:"url" binding:"required,url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+// UpdateWebhookRequest represents changes to a webhook subscription
+type UpdateWebhookRequest struct {
+	Name        string    `json:"name"`
+	URL         string    `json:"url" binding:"omitempty,url"`
+	Events      *[]string `json:"events"`
+	Description *string   `json:"description"`
+	IsActive    *bool     `json:"isActive"`
+}
@@ -0,0 +1,38 @@
+package notifications
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/models"
+)
+
+// PasswordResetData is passed to the password reset template
+type PasswordResetData struct {
+	Recipient models.User
+	ResetURL  string
+	ExpiresIn string
+}
+
+// SendPasswordReset emails a password reset link. Account email ignores
+// notification preferences.
+func SendPasswordReset(recipient models.User, token string, ttl time.Duration) error {
+	rendered, err := render("auth.password_reset", PasswordResetData{
+		Recipient: recipient,
+		ResetURL:  strings.TrimRight(appURL, "/") + "/reset-password?token=" + url.QueryEscape(token),
+		ExpiresIn: fmt.Sprintf("%d minutes", int(ttl.Minutes())),
+	})
+	if err != nil {
+		return err
+	}
+
+	queueEmail(Message{
+		To:      recipient.Email,
+		Subject: rendered.Subject,
+		Text:    rendered.Text,
+		HTML:    rendered.HTML,
+	})
+	return nil
+}
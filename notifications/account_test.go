@@ -0,0 +1,38 @@
+package notifications_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/notifications"
+	"github.com/flowkit/backend/notifications/notificationstest"
+)
+
+func TestSendPasswordReset(t *testing.T) {
+	notifications.SetAppURL("https://flowkit.test/")
+	t.Cleanup(func() { notifications.SetAppURL("") })
+	mailer := notificationstest.UseMailer(t)
+
+	// Account email goes out even with every notification turned off
+	user := models.User{FirstName: "Ama", Email: "ama@example.com", NotificationPreferences: map[string]models.NotificationChannels{}}
+	if err := notifications.SendPasswordReset(user, "a+b/c=", 45*time.Minute); err != nil {
+		t.Fatalf("SendPasswordReset: %v", err)
+	}
+
+	msg := mailer.Receive(t, 1)[0]
+	mailer.ExpectNone(t)
+	if msg.To != user.Email || msg.Subject != "Reset your FlowKit password" {
+		t.Errorf("sent %q to %s", msg.Subject, msg.To)
+	}
+	link := "https://flowkit.test/reset-password?token=a%2Bb%2Fc%3D"
+	for _, want := range []string{"Hello Ama", link, "expires in 45 minutes"} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("Text does not contain %q:\n%s", want, msg.Text)
+		}
+	}
+	if !strings.Contains(msg.HTML, `href="`+link+`"`) {
+		t.Errorf("HTML does not link to %s:\n%s", link, msg.HTML)
+	}
+}
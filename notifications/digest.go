@@ -0,0 +1,127 @@
+package notifications
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+	_ "time/tzdata" // Users' timezones must resolve on images without a zoneinfo database
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultDigestTime = "08:00"
+	defaultTimezone   = "UTC"
+)
+
+// Digest is one user's daily summary
+type Digest struct {
+	Date             time.Time // Midnight UTC of the recipient's local date
+	PendingApprovals []DigestItem
+	UpcomingLeave    []DigestItem // Colleagues in the recipient's department going on leave
+	ReliefDuties     []DigestItem // Leave the recipient is covering for
+}
+
+// DigestItem is a leave request listed in a digest
+type DigestItem struct {
+	Leave    models.Leave
+	Employee models.User
+	Stage    string // Stage awaiting the recipient, for pending approvals
+}
+
+// IsEmpty reports whether the digest has nothing worth sending
+func (d *Digest) IsEmpty() bool {
+	return len(d.PendingApprovals) == 0 && len(d.UpcomingLeave) == 0 && len(d.ReliefDuties) == 0
+}
+
+// DigestData is passed to the digest template
+type DigestData struct {
+	Recipient models.User
+	Digest    Digest
+	AppURL    string
+}
+
+// DigestTime returns when the user wants their digest, falling back to
+// DIGEST_DEFAULT_TIME
+func DigestTime(user *models.User) string {
+	if user.DigestTime != "" {
+		return user.DigestTime
+	}
+	if value := os.Getenv("DIGEST_DEFAULT_TIME"); value != "" {
+		return value
+	}
+	return defaultDigestTime
+}
+
+// Timezone returns the user's timezone, falling back to DEFAULT_TIMEZONE
+func Timezone(user *models.User) string {
+	if user.Timezone != "" {
+		return user.Timezone
+	}
+	if value := os.Getenv("DEFAULT_TIMEZONE"); value != "" {
+		return value
+	}
+	return defaultTimezone
+}
+
+// DigestDue reports whether the user's digest time has passed on their local
+// date at now, and returns that date as "2006-01-02"
+func DigestDue(user *models.User, now time.Time) (string, bool) {
+	location, err := time.LoadLocation(Timezone(user))
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+	today := local.Format("2006-01-02")
+
+	at, err := time.Parse("15:04", DigestTime(user))
+	if err != nil {
+		at, _ = time.Parse("15:04", defaultDigestTime)
+	}
+	sendAt := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, location)
+	return today, !local.Before(sendAt)
+}
+
+// SendDigest delivers a digest on the channels the recipient has enabled for it
+func SendDigest(ctx context.Context, recipient models.User, digest Digest) error {
+	rendered, err := render(models.DailyDigest, DigestData{
+		Recipient: recipient,
+		Digest:    digest,
+		AppURL:    appURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	if recipient.WantsNotification(models.DailyDigest, models.ChannelInApp) {
+		notification := models.Notification{
+			ID:    primitive.NewObjectID(),
+			User:  recipient.ID,
+			Type:  models.DailyDigest,
+			Title: rendered.Subject,
+			Data: map[string]interface{}{
+				"date":             digest.Date.Format("2006-01-02"),
+				"pendingApprovals": len(digest.PendingApprovals),
+				"upcomingLeave":    len(digest.UpcomingLeave),
+				"reliefDuties":     len(digest.ReliefDuties),
+			},
+			Read:      false,
+			CreatedAt: time.Now(),
+		}
+		if _, err := config.NotificationsCollection.InsertOne(ctx, notification); err != nil {
+			log.Printf("⚠️  Failed to store digest for %s: %v", recipient.ID.Hex(), err)
+		}
+	}
+	if recipient.WantsNotification(models.DailyDigest, models.ChannelEmail) && recipient.Email != "" {
+		queueEmail(Message{
+			To:      recipient.Email,
+			Subject: rendered.Subject,
+			Text:    rendered.Text,
+			HTML:    rendered.HTML,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package notifications
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	emailQueueSize   = 256
+	emailMaxAttempts = 5
+	emailRetryDelay  = 30 * time.Second // Doubled after each failed attempt
+)
+
+type emailJob struct {
+	msg     Message
+	attempt int
+}
+
+var (
+	mailer     Mailer
+	emailQueue chan emailJob
+)
+
+// initEmail configures the mailer from the environment and starts the
+// delivery worker. Without SMTP_HOST, mail is written to MAIL_DIR if set and
+// logged otherwise.
+func initEmail() {
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "FlowKit <no-reply@flowkit.local>"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		mailer = &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		log.Printf("✉️  Email notifications via %s:%s", host, port)
+	} else if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		mailer = DirMailer{Dir: dir, From: from}
+		log.Printf("✉️  SMTP_HOST not set, emails will be written to %s", dir)
+	} else {
+		mailer = LogMailer{}
+		log.Println("✉️  SMTP_HOST not set, email notifications will be logged")
+	}
+
+	emailQueue = make(chan emailJob, emailQueueSize)
+	go deliveryWorker()
+}
+
+// SetMailer replaces the mailer chosen from the environment, e.g. with one
+// that captures messages in tests, and starts delivery if Init has not
+func SetMailer(m Mailer) {
+	mailer = m
+	if emailQueue == nil {
+		emailQueue = make(chan emailJob, emailQueueSize)
+		go deliveryWorker()
+	}
+}
+
+// queueEmail schedules a message for delivery
+func queueEmail(msg Message) {
+	emailQueue <- emailJob{msg: msg}
+}
+
+// deliveryWorker sends queued emails, retrying failures with exponential backoff
+func deliveryWorker() {
+	for job := range emailQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := mailer.Send(ctx, job.msg)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		job.attempt++
+		if job.attempt >= emailMaxAttempts {
+			log.Printf("❌ Giving up on email to %s (%s) after %d attempts: %v", job.msg.To, job.msg.Subject, job.attempt, err)
+			continue
+		}
+
+		delay := emailRetryDelay << (job.attempt - 1)
+		log.Printf("⚠️  Email to %s failed (attempt %d), retrying in %s: %v", job.msg.To, job.attempt, delay, err)
+		retry := job
+		time.AfterFunc(delay, func() { emailQueue <- retry })
+	}
+}
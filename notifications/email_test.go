@@ -0,0 +1,227 @@
+package notifications_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/models"
+	"github.com/flowkit/backend/notifications"
+	"github.com/flowkit/backend/notifications/notificationstest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// emailOnly turns off in-app delivery for every event type, so delivering
+// to the user needs no database
+func emailOnly() map[string]models.NotificationChannels {
+	prefs := map[string]models.NotificationChannels{}
+	for _, eventType := range events.Types {
+		prefs[models.NotificationPreferenceKey(eventType)] = models.NotificationChannels{Email: true}
+	}
+	return prefs
+}
+
+func testUser(first, last, email string) models.User {
+	return models.User{
+		ID:                      primitive.NewObjectID(),
+		FirstName:               first,
+		LastName:                last,
+		Email:                   email,
+		IsActive:                true,
+		NotificationPreferences: emailOnly(),
+	}
+}
+
+func TestDeliverSendsEmailPerEventType(t *testing.T) {
+	notifications.SetAppURL("https://flowkit.test")
+	t.Cleanup(func() { notifications.SetAppURL("") })
+
+	employee := testUser("Ama", "Mensah", "ama@example.com")
+	approver := testUser("Kofi", "Boateng", "kofi@example.com")
+	reliever := testUser("Efua", "Owusu", "efua@example.com")
+	users := map[primitive.ObjectID]models.User{
+		employee.ID: employee,
+		approver.ID: approver,
+		reliever.ID: reliever,
+	}
+
+	from := time.Date(2026, 11, 2, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 11, 6, 0, 0, 0, 0, time.UTC)
+	leave := models.Leave{
+		ID:        primitive.NewObjectID(),
+		Employee:  employee.ID,
+		Reliever:  reliever.ID,
+		LeaveType: "Annual Leave",
+		FromDate:  from,
+		ToDate:    to,
+	}
+
+	tests := []struct {
+		eventType string
+		recipient models.User
+		data      map[string]interface{}
+		subject   string
+		body      []string
+	}{
+		{
+			eventType: events.LeaveCreated,
+			recipient: approver,
+			data:      map[string]interface{}{"stage": "HOD"},
+			subject:   "Leave request from Ama Mensah awaiting review",
+			body:      []string{"Hello Kofi", "Mon 2 Nov 2026"},
+		},
+		{
+			eventType: events.LeaveStageApproved,
+			recipient: employee,
+			data:      map[string]interface{}{"stage": "HOD", "nextStage": "HR", "comments": "Enjoy"},
+			subject:   "Your leave was approved by HOD",
+			body:      []string{"Hello Ama", "Kofi Boateng", "Comments: Enjoy", "Next step: HR review."},
+		},
+		{
+			eventType: events.LeaveStageRejected,
+			recipient: employee,
+			data:      map[string]interface{}{"stage": "HR", "comments": "Too busy"},
+			subject:   "Your leave request was rejected by HR",
+			body:      []string{"Hello Ama", "Too busy"},
+		},
+		{
+			eventType: events.LeaveApproved,
+			recipient: reliever,
+			subject:   "You are covering for Ama Mensah",
+			body:      []string{"Hello Efua"},
+		},
+		{
+			eventType: events.LeaveCancelled,
+			recipient: employee,
+			subject:   "Your leave has been cancelled",
+			body:      []string{"Hello Ama"},
+		},
+		{
+			eventType: events.LeaveReturned,
+			recipient: employee,
+			data:      map[string]interface{}{"stage": "HOD", "comments": "Pick a reliever"},
+			subject:   "Your leave request needs changes (HOD)",
+			body:      []string{"Pick a reliever"},
+		},
+		{
+			eventType: events.LeaveExtended,
+			recipient: reliever,
+			data:      map[string]interface{}{"previousToDate": from},
+			subject:   "Ama Mensah's leave has been extended",
+			body:      []string{"Hello Efua"},
+		},
+		{
+			eventType: events.RelieverAssigned,
+			recipient: reliever,
+			subject:   "You have been named reliever for Ama Mensah",
+			body:      []string{"Hello Efua"},
+		},
+		{
+			eventType: events.LeaveRecalled,
+			recipient: employee,
+			data:      map[string]interface{}{"reason": "Audit", "returnDate": to, "refundedDays": 2},
+			subject:   "You have been recalled from leave",
+			body:      []string{"Audit"},
+		},
+		{
+			eventType: events.LeaveCommented,
+			recipient: employee,
+			data:      map[string]interface{}{"excerpt": "Please attach the letter"},
+			subject:   "New comment on your leave request",
+			body:      []string{"Please attach the letter"},
+		},
+		{
+			eventType: events.LeaveMentioned,
+			recipient: reliever,
+			data:      map[string]interface{}{"excerpt": "@efua can you cover?"},
+			subject:   "Kofi Boateng mentioned you on a leave request",
+			body:      []string{"@efua can you cover?"},
+		},
+		{
+			eventType: events.ApprovalReminder,
+			recipient: approver,
+			data:      map[string]interface{}{"stage": "HOD", "pendingSince": from},
+			subject:   "Reminder: leave request from Ama Mensah awaiting your review",
+			body:      []string{"Hello Kofi"},
+		},
+		{
+			eventType: events.LeaveEscalated,
+			recipient: approver,
+			data:      map[string]interface{}{"stage": "HR", "pendingSince": from},
+			subject:   "Escalated: leave request from Ama Mensah stalled at HR",
+			body:      []string{"Hello Kofi"},
+		},
+		{
+			eventType: events.LeaveStartingSoon,
+			recipient: employee,
+			data:      map[string]interface{}{"reliever": "Efua Owusu"},
+			subject:   "Your leave starts tomorrow",
+			body:      []string{"Hello Ama"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			mailer := notificationstest.UseMailer(t)
+
+			notifications.Deliver(context.Background(), events.Event{
+				ID:         primitive.NewObjectID(),
+				Type:       tt.eventType,
+				LeaveID:    leave.ID,
+				Employee:   employee.ID,
+				Actor:      approver.ID,
+				Recipients: []primitive.ObjectID{tt.recipient.ID},
+				Data:       tt.data,
+			}, leave, users)
+
+			msg := mailer.Receive(t, 1)[0]
+			mailer.ExpectNone(t)
+
+			if msg.To != tt.recipient.Email {
+				t.Errorf("To = %q, want %q", msg.To, tt.recipient.Email)
+			}
+			if msg.Subject != tt.subject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.subject)
+			}
+			for _, want := range append(tt.body, "https://flowkit.test") {
+				if !strings.Contains(msg.Text, want) {
+					t.Errorf("Text does not contain %q:\n%s", want, msg.Text)
+				}
+			}
+			if !strings.Contains(msg.HTML, "<p>") {
+				t.Errorf("HTML part missing:\n%s", msg.HTML)
+			}
+		})
+	}
+}
+
+func TestDeliverRespectsRecipients(t *testing.T) {
+	employee := testUser("Ama", "Mensah", "ama@example.com")
+	optedOut := testUser("Kofi", "Boateng", "kofi@example.com")
+	optedOut.NotificationPreferences[models.NotificationPreferenceKey(events.LeaveApproved)] = models.NotificationChannels{}
+	inactive := testUser("Efua", "Owusu", "efua@example.com")
+	inactive.IsActive = false
+	users := map[primitive.ObjectID]models.User{
+		employee.ID: employee,
+		optedOut.ID: optedOut,
+		inactive.ID: inactive,
+	}
+	leave := models.Leave{ID: primitive.NewObjectID(), Employee: employee.ID}
+
+	mailer := notificationstest.UseMailer(t)
+	notifications.Deliver(context.Background(), events.Event{
+		ID:         primitive.NewObjectID(),
+		Type:       events.LeaveApproved,
+		LeaveID:    leave.ID,
+		Employee:   employee.ID,
+		Recipients: []primitive.ObjectID{optedOut.ID, inactive.ID, primitive.NewObjectID(), employee.ID},
+	}, leave, users)
+
+	msgs := mailer.Receive(t, 1)
+	mailer.ExpectNone(t)
+	if msgs[0].To != employee.Email || msgs[0].Subject != "Your leave has been approved" {
+		t.Errorf("sent %q to %s, want the approval sent only to %s", msgs[0].Subject, msgs[0].To, employee.Email)
+	}
+}
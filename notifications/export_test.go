@@ -0,0 +1,9 @@
+package notifications
+
+// Deliver lets the external tests deliver an event without the database
+var Deliver = deliver
+
+// SetAppURL sets the link back to the app used in email
+func SetAppURL(url string) {
+	appURL = url
+}
@@ -0,0 +1,42 @@
+package notifications
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// storeInApp adds an entry to the recipient's notification inbox. It returns
+// false if the recipient already has an entry for the event.
+func storeInApp(ctx context.Context, event events.Event, recipient primitive.ObjectID, title string) bool {
+	notification := models.Notification{
+		ID:        primitive.NewObjectID(),
+		User:      recipient,
+		Event:     event.ID,
+		Type:      event.Type,
+		Leave:     event.LeaveID,
+		Actor:     event.Actor,
+		Title:     title,
+		Data:      event.Data,
+		Read:      false,
+		CreatedAt: event.OccurredAt,
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+
+	_, err := config.NotificationsCollection.InsertOne(ctx, notification)
+	if mongo.IsDuplicateKeyError(err) {
+		return false
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to store %s notification for %s: %v", event.Type, recipient.Hex(), err)
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package notifications_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/flowkit/backend/notifications"
+)
+
+// smtpDelivery is what an SMTP client sent in one session
+type smtpDelivery struct {
+	auth string
+	from string
+	to   []string
+	data []byte
+}
+
+// startSMTPSink accepts one SMTP session on a local port, speaking just
+// enough of the protocol for net/smtp, and hands back what it received
+func startSMTPSink(t *testing.T) (string, <-chan smtpDelivery) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan smtpDelivery, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var delivery smtpDelivery
+		text.PrintfLine("220 sink ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				text.PrintfLine("250-sink")
+				text.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				delivery.auth = arg
+				text.PrintfLine("235 2.7.0 Authenticated")
+			case "MAIL":
+				delivery.from = arg
+				text.PrintfLine("250 2.1.0 OK")
+			case "RCPT":
+				delivery.to = append(delivery.to, arg)
+				text.PrintfLine("250 2.1.5 OK")
+			case "DATA":
+				text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				if delivery.data, err = text.ReadDotBytes(); err != nil {
+					return
+				}
+				text.PrintfLine("250 2.0.0 Queued")
+			case "QUIT":
+				text.PrintfLine("221 2.0.0 Bye")
+				received <- delivery
+				return
+			default:
+				text.PrintfLine("502 5.5.2 Not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, received := startSMTPSink(t)
+	host, port, _ := net.SplitHostPort(addr)
+	mailer := &notifications.SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: "flowkit",
+		Password: "secret",
+		From:     "FlowKit <no-reply@flowkit.local>",
+	}
+
+	msg := notifications.Message{
+		To:      "ama@example.com",
+		Subject: "Your leave was approved – enjoy",
+		Text:    "Hello Ama,\n\nYour Annual Leave from Mon 2 Nov 2026 to Fri 6 Nov 2026 was approved by HOD. View it at https://flowkit.test/leaves/1\n",
+		HTML:    `<p>Hello Ama,</p><p>Your <strong>Annual Leave</strong> was approved. <a href="https://flowkit.test/leaves/1">View it</a></p>`,
+	}
+	if err := mailer.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	delivery := <-received
+
+	// Envelope
+	if want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00flowkit\x00secret")); delivery.auth != want {
+		t.Errorf("AUTH %s, want %s", delivery.auth, want)
+	}
+	if delivery.from != "FROM:<no-reply@flowkit.local>" {
+		t.Errorf("MAIL %s, want the bare sender address", delivery.from)
+	}
+	if len(delivery.to) != 1 || delivery.to[0] != "TO:<ama@example.com>" {
+		t.Errorf("RCPT %v, want only the recipient", delivery.to)
+	}
+
+	// Quoted-printable keeps body lines within 76 characters
+	_, body, _ := strings.Cut(string(delivery.data), "\n\n")
+	for _, line := range strings.Split(body, "\n") {
+		if len(line) > 76 {
+			t.Errorf("body line longer than 76 characters: %q", line)
+		}
+	}
+
+	// Headers
+	parsed, err := mail.ReadMessage(bytes.NewReader(delivery.data))
+	if err != nil {
+		t.Fatalf("reading the message: %v\n%s", err, delivery.data)
+	}
+	for name, want := range map[string]string{
+		"From":         "FlowKit <no-reply@flowkit.local>",
+		"To":           "ama@example.com",
+		"MIME-Version": "1.0",
+	} {
+		if got := parsed.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+
+	// Body: the text and HTML alternatives, quoted-printable on the wire
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/alternative", parsed.Header.Get("Content-Type"), err)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("reading the %s part: %v", want.contentType, err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type = %q, want %q", got, want.contentType)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("reading the %s part: %v", want.contentType, err)
+		}
+		if string(body) != want.body {
+			t.Errorf("%s part = %q, want %q", want.contentType, body, want.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("more parts after the HTML one: %v", err)
+	}
+}
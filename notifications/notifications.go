@@ -0,0 +1,117 @@
+package notifications
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var appURL string
+
+// Init subscribes notifications to leave events. Each event is rendered once
+// per recipient and delivered on the channels the recipient has enabled for
+// that event type.
+func Init() {
+	appURL = os.Getenv("APP_URL")
+	initEmail()
+
+	// Lets retried events recognise recipients that were already notified
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := config.NotificationsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "event", Value: 1}, {Key: "user", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"event": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create notification indexes: %v", err)
+	}
+
+	events.Subscribe("notifications", dispatch)
+}
+
+// dispatch renders the event for each recipient and delivers it in-app and by
+// email. Only failing to load the leave is worth retrying; problems with one
+// recipient are logged so the others are not notified twice.
+func dispatch(ctx context.Context, event events.Event) error {
+	var leave models.Leave
+	err := config.LeavesCollection.FindOne(ctx, bson.M{"_id": event.LeaveID}).Decode(&leave)
+	if err == mongo.ErrNoDocuments {
+		log.Printf("⚠️  Notification %s skipped: leave %s not found", event.Type, event.LeaveID.Hex())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	users := loadUsers(ctx, append([]primitive.ObjectID{event.Employee, event.Actor}, event.Recipients...))
+	deliver(ctx, event, leave, users)
+	return nil
+}
+
+// deliver renders the event for each of its recipients found in users and
+// stores or queues it on the channels they want
+func deliver(ctx context.Context, event events.Event, leave models.Leave, users map[primitive.ObjectID]models.User) {
+	for _, id := range event.Recipients {
+		recipient, ok := users[id]
+		if !ok || !recipient.IsActive {
+			continue
+		}
+
+		rendered, err := renderEmail(TemplateData{
+			Event:     event,
+			Recipient: recipient,
+			Employee:  users[event.Employee],
+			Actor:     users[event.Actor],
+			Leave:     leave,
+			AppURL:    appURL,
+		})
+		if err != nil {
+			log.Printf("⚠️  Notification %s skipped: %v", event.Type, err)
+			return
+		}
+
+		// A stored in-app entry means this recipient was handled by an earlier attempt
+		if recipient.WantsNotification(event.Type, models.ChannelInApp) {
+			if !storeInApp(ctx, event, recipient.ID, rendered.Subject) {
+				continue
+			}
+		}
+		if recipient.WantsNotification(event.Type, models.ChannelEmail) && recipient.Email != "" {
+			queueEmail(Message{
+				To:      recipient.Email,
+				Subject: rendered.Subject,
+				Text:    rendered.Text,
+				HTML:    rendered.HTML,
+			})
+		}
+	}
+}
+
+// loadUsers fetches the given users keyed by ID
+func loadUsers(ctx context.Context, ids []primitive.ObjectID) map[primitive.ObjectID]models.User {
+	users := map[primitive.ObjectID]models.User{}
+
+	cursor, err := config.UsersCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return users
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if cursor.Decode(&user) == nil {
+			users[user.ID] = user
+		}
+	}
+	return users
+}
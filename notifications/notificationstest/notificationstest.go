@@ -0,0 +1,62 @@
+// Package notificationstest captures the email the notifications package
+// sends, so tests can check what would have gone out.
+package notificationstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/notifications"
+)
+
+// How long Receive waits for a message, and ExpectNone for a stray one
+const (
+	receiveTimeout = 2 * time.Second
+	quietPeriod    = 50 * time.Millisecond
+)
+
+// Mailer hands every message it is asked to send to the test
+type Mailer struct {
+	sent chan notifications.Message
+}
+
+// UseMailer routes email sent during the test through a new Mailer
+func UseMailer(t testing.TB) *Mailer {
+	t.Helper()
+	m := &Mailer{sent: make(chan notifications.Message, 256)}
+	notifications.SetMailer(m)
+	t.Cleanup(func() { notifications.SetMailer(notifications.LogMailer{}) })
+	return m
+}
+
+// Send captures msg
+func (m *Mailer) Send(ctx context.Context, msg notifications.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// Receive waits for the next n messages sent
+func (m *Mailer) Receive(t testing.TB, n int) []notifications.Message {
+	t.Helper()
+	msgs := []notifications.Message{}
+	for len(msgs) < n {
+		select {
+		case msg := <-m.sent:
+			msgs = append(msgs, msg)
+		case <-time.After(receiveTimeout):
+			t.Fatalf("got %d emails, want %d", len(msgs), n)
+		}
+	}
+	return msgs
+}
+
+// ExpectNone fails if anything else is sent shortly after
+func (m *Mailer) ExpectNone(t testing.TB) {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		t.Fatalf("unexpected email to %s: %q", msg.To, msg.Subject)
+	case <-time.After(quietPeriod):
+	}
+}
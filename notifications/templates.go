@@ -0,0 +1,99 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Email templates, one file per event type (e.g. templates/email/leave.created.tmpl)
+// plus digest.daily.tmpl for the daily digest.
+// Each file defines "subject", "text" and "html" templates.
+//
+//go:embed templates/email/*.tmpl
+var emailTemplates embed.FS
+
+// TemplateData is passed to every notification template
+type TemplateData struct {
+	Event     events.Event
+	Recipient models.User
+	Employee  models.User
+	Actor     models.User
+	Leave     models.Leave
+	AppURL    string
+}
+
+// IsEmployee reports whether the recipient is the employee who owns the leave
+func (d TemplateData) IsEmployee() bool {
+	return d.Recipient.ID == d.Employee.ID
+}
+
+var templateFuncs = map[string]interface{}{
+	"date": func(value interface{}) string {
+		switch t := value.(type) {
+		case time.Time:
+			return t.Format("Mon 2 Jan 2006")
+		case primitive.DateTime:
+			return t.Time().UTC().Format("Mon 2 Jan 2006")
+		}
+		return ""
+	},
+	"name": func(u models.User) string {
+		return strings.TrimSpace(u.FirstName + " " + u.LastName)
+	},
+}
+
+// Rendered is the output of a notification template
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// renderEmail renders the templates for data's event type
+func renderEmail(data TemplateData) (*Rendered, error) {
+	return render(data.Event.Type, data)
+}
+
+// render renders the named template file with data
+func render(name string, data interface{}) (*Rendered, error) {
+	file := "templates/email/" + name + ".tmpl"
+	source, err := emailTemplates.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("no email template for %s", name)
+	}
+
+	text, err := texttemplate.New(name).Funcs(templateFuncs).Parse(string(source))
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(string(source))
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, body, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := text.ExecuteTemplate(&body, "text", data); err != nil {
+		return nil, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "html", data); err != nil {
+		return nil, err
+	}
+
+	return &Rendered{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
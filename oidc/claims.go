@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Claims are the claims of a verified ID token
+type Claims map[string]interface{}
+
+// Lookup returns the claim at path. Dots reach into nested objects, as in
+// "realm_access.roles".
+func (c Claims) Lookup(path string) (interface{}, bool) {
+	var value interface{} = map[string]interface{}(c)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// String returns a string claim, or "" if it is missing or not a string
+func (c Claims) String(path string) string {
+	value, _ := c.Lookup(path)
+	s, _ := value.(string)
+	return s
+}
+
+// Strings returns a claim holding a string or a list of strings, such as a
+// group membership claim
+func (c Claims) Strings(path string) []string {
+	value, ok := c.Lookup(path)
+	if !ok {
+		return nil
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			} else if item != nil {
+				values = append(values, fmt.Sprint(item))
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// EmailVerified reports whether the provider vouches for the email claim.
+// Providers that leave the claim out are trusted to only issue verified emails.
+func (c Claims) EmailVerified() bool {
+	value, ok := c.Lookup("email_verified")
+	if !ok {
+		return true
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
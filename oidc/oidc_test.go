@@ -0,0 +1,316 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowkit/backend/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "flowkit"
+
+// newTestProvider starts a test provider and discovers it
+func newTestProvider(t *testing.T) (*oidctest.Server, *Provider) {
+	t.Helper()
+	server := oidctest.NewServer(t, testClientID)
+	provider, err := NewProvider(context.Background(), Config{
+		Issuer:      server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://flowkit.test/api/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return server, provider
+}
+
+func TestNewPKCE(t *testing.T) {
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+
+	// RFC 7636 verifiers are 43 to 128 unreserved characters
+	if len(verifier) < 43 || len(verifier) > 128 || strings.ContainsAny(verifier, "+/=") {
+		t.Errorf("verifier %q is not a valid PKCE verifier", verifier)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); challenge != want {
+		t.Errorf("challenge = %q, want S256 of the verifier %q", challenge, want)
+	}
+
+	again, _, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	if again == verifier {
+		t.Error("NewPKCE returned the same verifier twice")
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	server, provider := newTestProvider(t)
+
+	authURL, err := url.Parse(provider.AuthCodeURL("the-state", "the-nonce", "the-challenge"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if got := authURL.Scheme + "://" + authURL.Host + authURL.Path; got != server.URL+"/authorize" {
+		t.Errorf("endpoint = %q, want %q", got, server.URL+"/authorize")
+	}
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://flowkit.test/api/auth/oidc/callback",
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        "the-challenge",
+		"code_challenge_method": "S256",
+	} {
+		if got := authURL.Query().Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+}
+
+func TestNewProviderRejectsIssuerMismatch(t *testing.T) {
+	server := oidctest.NewServer(t, testClientID)
+	_, err := NewProvider(context.Background(), Config{Issuer: server.URL + "/other", ClientID: testClientID})
+	if err == nil {
+		t.Fatal("NewProvider accepted a provider reporting a different issuer")
+	}
+}
+
+func TestCodeFlow(t *testing.T) {
+	server, provider := newTestProvider(t)
+	server.SetClaims(jwt.MapClaims{"sub": "user-1", "email": "jane@flowkit.com"})
+	ctx := context.Background()
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	callback := server.SignIn(t, provider.AuthCodeURL("the-state", "the-nonce", challenge))
+	if callback.Get("state") != "the-state" {
+		t.Fatalf("state = %q, want it returned unchanged", callback.Get("state"))
+	}
+
+	idToken, err := provider.Exchange(ctx, callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(ctx, idToken, "the-nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.String("sub") != "user-1" || claims.String("email") != "jane@flowkit.com" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// The code was used up by the exchange
+	if _, err := provider.Exchange(ctx, callback.Get("code"), verifier); err == nil {
+		t.Error("Exchange accepted a code twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	server, provider := newTestProvider(t)
+	server.SetClaims(jwt.MapClaims{"sub": "user-1"})
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	other, _, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	callback := server.SignIn(t, provider.AuthCodeURL("state", "nonce", challenge))
+
+	_, err = provider.Exchange(context.Background(), callback.Get("code"), other)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("Exchange with another verifier: err = %v, want invalid_grant", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	server, provider := newTestProvider(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   func() string
+		nonce   string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			token: func() string { return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "n"})) },
+			nonce: "n",
+		},
+		{
+			name:    "nonce mismatch",
+			token:   func() string { return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "other"})) },
+			nonce:   "n",
+			wantErr: "nonce does not match",
+		},
+		{
+			name:    "nonce missing",
+			token:   func() string { return server.Sign(t, server.Token(nil)) },
+			nonce:   "n",
+			wantErr: "nonce does not match",
+		},
+		{
+			name: "signed by another key",
+			token: func() string {
+				return oidctest.SignWith(t, otherKey, oidctest.KeyID, server.Token(jwt.MapClaims{"nonce": "n"}))
+			},
+			nonce:   "n",
+			wantErr: "signature is invalid",
+		},
+		{
+			name: "unknown key ID",
+			token: func() string {
+				return oidctest.SignWith(t, otherKey, "rotated", server.Token(jwt.MapClaims{"nonce": "n"}))
+			},
+			nonce:   "n",
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "HMAC signed",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, server.Token(jwt.MapClaims{"nonce": "n"}))
+				signed, _ := token.SignedString([]byte("secret"))
+				return signed
+			},
+			nonce:   "n",
+			wantErr: "signing method",
+		},
+		{
+			name:    "wrong audience",
+			token:   func() string { return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "n", "aud": "someone-else"})) },
+			nonce:   "n",
+			wantErr: "audience",
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "n", "iss": "https://evil.test"}))
+			},
+			nonce:   "n",
+			wantErr: "issuer",
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "n", "exp": now.Add(-2 * time.Minute).Unix()}))
+			},
+			nonce:   "n",
+			wantErr: "expired",
+		},
+		{
+			name: "expiry missing",
+			token: func() string {
+				claims := server.Token(jwt.MapClaims{"nonce": "n"})
+				delete(claims, "exp")
+				return server.Sign(t, claims)
+			},
+			nonce:   "n",
+			wantErr: "exp claim is required",
+		},
+		{
+			name: "issued in the future",
+			token: func() string {
+				return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "n", "iat": now.Add(time.Hour).Unix()}))
+			},
+			nonce:   "n",
+			wantErr: "used before issued",
+		},
+		{
+			name: "authorized party is another client",
+			token: func() string {
+				return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "n", "aud": []string{testClientID, "other"}, "azp": "other"}))
+			},
+			nonce:   "n",
+			wantErr: "issued for another client",
+		},
+		{
+			name:    "subject missing",
+			token:   func() string { return server.Sign(t, server.Token(jwt.MapClaims{"nonce": "n", "sub": ""})) },
+			nonce:   "n",
+			wantErr: "missing subject",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(context.Background(), tt.token(), tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("VerifyIDToken: %v", err)
+				}
+				if claims.String("sub") != "test|subject" {
+					t.Errorf("sub = %q", claims.String("sub"))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaims(t *testing.T) {
+	claims := Claims{
+		"email":  "jane@flowkit.com",
+		"groups": []interface{}{"HR-Team", "Staff", 7},
+		"single": "admins",
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"hr"},
+		},
+	}
+
+	if got := claims.String("email"); got != "jane@flowkit.com" {
+		t.Errorf("String(email) = %q", got)
+	}
+	if got := claims.String("groups"); got != "" {
+		t.Errorf("String of a list = %q, want empty", got)
+	}
+	if got := strings.Join(claims.Strings("groups"), ","); got != "HR-Team,Staff,7" {
+		t.Errorf("Strings(groups) = %q", got)
+	}
+	if got := strings.Join(claims.Strings("single"), ","); got != "admins" {
+		t.Errorf("Strings(single) = %q", got)
+	}
+	if got := strings.Join(claims.Strings("realm_access.roles"), ","); got != "hr" {
+		t.Errorf("Strings(realm_access.roles) = %q", got)
+	}
+	if _, ok := claims.Lookup("realm_access.missing"); ok {
+		t.Error("Lookup found a missing nested claim")
+	}
+
+	for value, want := range map[interface{}]bool{true: true, false: false, "true": true, "false": false} {
+		if got := (Claims{"email_verified": value}).EmailVerified(); got != want {
+			t.Errorf("EmailVerified with %v = %v, want %v", value, got, want)
+		}
+	}
+	if !(Claims{}).EmailVerified() {
+		t.Error("EmailVerified without the claim = false, want true")
+	}
+}
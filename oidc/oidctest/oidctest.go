@@ -0,0 +1,243 @@
+// Package oidctest runs an in-process OpenID Connect provider for tests. It
+// serves discovery, JWKS, the authorization code flow with PKCE (S256) and
+// RS256-signed ID tokens, like cmd/mock-oidc, but signs in straight away with
+// the claims the test sets.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID is the ID of the provider's signing key
+const KeyID = "test-1"
+
+// grant is an issued authorization code waiting to be exchanged
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+// Server is a running test provider
+type Server struct {
+	*httptest.Server
+	Key      *rsa.PrivateKey
+	ClientID string
+
+	mu     sync.Mutex
+	claims jwt.MapClaims
+	grants map[string]grant
+}
+
+// NewServer starts a provider accepting clientID, closed when the test ends
+func NewServer(t testing.TB, clientID string) *Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating signing key: %v", err)
+	}
+
+	s := &Server{Key: key, ClientID: clientID, grants: map[string]grant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SetClaims sets the claims the next sign-ins are issued for, on top of the
+// registered claims the provider adds itself
+func (s *Server) SetClaims(claims jwt.MapClaims) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims = claims
+}
+
+// SignIn follows authURL as a browser would and returns the query the
+// provider redirects back with, holding the code and state or an error
+func (s *Server) SignIn(t testing.TB, authURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("signing in: %v", err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil {
+		t.Fatalf("sign-in returned status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+// Token returns claims with the registered claims of a valid ID token for
+// the client filled in where claims leaves them out
+func (s *Server) Token(claims jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	token := jwt.MapClaims{
+		"iss": s.URL,
+		"aud": s.ClientID,
+		"sub": "test|subject",
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		token[k] = v
+	}
+	return token
+}
+
+// Sign signs claims with the provider's key
+func (s *Server) Sign(t testing.TB, claims jwt.MapClaims) string {
+	t.Helper()
+	return SignWith(t, s.Key, KeyID, claims)
+}
+
+// SignWith signs claims with key under the key ID kid, e.g. to forge a token
+func SignWith(t testing.TB, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+// discovery serves the provider metadata
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                           s.URL,
+		"authorization_endpoint":           s.URL + "/authorize",
+		"token_endpoint":                   s.URL + "/token",
+		"jwks_uri":                         s.URL + "/jwks",
+		"code_challenge_methods_supported": []string{"S256"},
+	})
+}
+
+// jwks serves the public signing key
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize issues an authorization code for the current claims
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != s.ClientID || redirectURI == "" {
+		http.Error(w, "unknown client or missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	values := url.Values{"state": {query.Get("state")}}
+	if query.Get("response_type") != "code" || query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		values.Set("error", "invalid_request")
+	} else {
+		code := randomString()
+		s.mu.Lock()
+		s.grants[code] = grant{
+			redirectURI:   redirectURI,
+			codeChallenge: query.Get("code_challenge"),
+			nonce:         query.Get("nonce"),
+			claims:        s.claims,
+		}
+		s.mu.Unlock()
+		values.Set("code", code)
+	}
+	http.Redirect(w, r, redirectURI+"?"+values.Encode(), http.StatusFound)
+}
+
+// token exchanges an authorization code for an ID token, checking the PKCE
+// verifier against the challenge the code was issued for
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != s.ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes work once
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+	claims = s.Token(claims)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	idToken, err := token.SignedString(s.Key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
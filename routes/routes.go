@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/flowkit/backend/handlers"
 	"github.com/flowkit/backend/middleware"
+	"github.com/flowkit/backend/models"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,6 +26,14 @@ func SetupRoutes(router *gin.Engine) {
 	{
 		auth.POST("/register", handlers.Register)
 		auth.POST("/login", handlers.Login)
+		auth.POST("/login/2fa", handlers.LoginTwoFactor)
+		auth.POST("/refresh", handlers.RefreshToken)
+		auth.POST("/logout", handlers.Logout)
+		auth.POST("/forgot-password", handlers.ForgotPassword)
+		auth.POST("/reset-password", handlers.ResetPassword)
+		auth.GET("/oidc", handlers.GetSSOConfig)
+		auth.GET("/oidc/login", handlers.OIDCLogin)
+		auth.GET("/oidc/callback", handlers.OIDCCallback)
 	}
 
 	// Protected routes - require authentication
@@ -36,14 +45,22 @@ func SetupRoutes(router *gin.Engine) {
 		{
 			authProtected.GET("/me", handlers.GetMe)
 			authProtected.PUT("/update-password", handlers.UpdatePassword)
+			authProtected.GET("/sessions", handlers.GetMySessions)
+			authProtected.DELETE("/sessions", handlers.RevokeOtherSessions)
+			authProtected.DELETE("/sessions/:id", handlers.RevokeMySession)
+			authProtected.GET("/2fa", handlers.GetTwoFactorStatus)
+			authProtected.POST("/2fa/enroll", handlers.EnrollTwoFactor)
+			authProtected.POST("/2fa/verify", handlers.VerifyTwoFactor)
+			authProtected.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+			authProtected.POST("/2fa/disable", handlers.DisableTwoFactor)
 		}
 
 		// User routes
 		users := protected.Group("/users")
 		{
-			users.GET("", handlers.GetUsers)
+			users.GET("", middleware.RequireScope(models.ScopeUsersRead), handlers.GetUsers)
 			users.GET("/relievers", handlers.GetRelievers)
-			users.GET("/:id", handlers.GetUserByID)
+			users.GET("/:id", middleware.RequireScope(models.ScopeUsersRead), handlers.GetUserByID)
 			users.PUT("/profile", handlers.UpdateProfile)
 			users.POST("/signature", handlers.UploadSignature)
 		}
@@ -57,38 +74,87 @@ func SetupRoutes(router *gin.Engine) {
 			leaves.PUT("/:id", handlers.UpdateLeave)
 			leaves.DELETE("/:id", handlers.DeleteLeave)
 			leaves.PUT("/:id/cancel", handlers.CancelLeave)
+			leaves.POST("/:id/cancellations", handlers.RequestLeaveCancellation)
+			leaves.GET("/:id/cancellations", handlers.GetLeaveCancellations)
+			leaves.POST("/:id/extensions", handlers.RequestLeaveExtension)
+			leaves.GET("/:id/extensions", handlers.GetLeaveExtensions)
+			leaves.POST("/:id/attachments", handlers.UploadLeaveAttachment)
+			leaves.GET("/:id/attachments", handlers.GetLeaveAttachments)
+			leaves.GET("/:id/attachments/:attachmentId", handlers.DownloadLeaveAttachment)
+			leaves.DELETE("/:id/attachments/:attachmentId", handlers.DeleteLeaveAttachment)
+			leaves.GET("/:id/comments", handlers.GetLeaveComments)
+			leaves.POST("/:id/comments", handlers.AddLeaveComment)
+			leaves.PUT("/:id/comments/:commentId", handlers.UpdateLeaveComment)
 
 			// General approver routes (for backward compatibility)
-			leaves.GET("", middleware.AuthorizeRoles("hod", "hr", "ged", "admin"), handlers.GetAllLeaves)
-			leaves.PUT("/:id/approve", middleware.AuthorizeRoles("hod", "hr", "ged", "admin"), handlers.ApproveLeave)
-			leaves.PUT("/:id/reject", middleware.AuthorizeRoles("hod", "hr", "ged", "admin"), handlers.RejectLeave)
+			leaves.GET("", middleware.RequireScope(models.ScopeLeavesRead), middleware.RequirePermission(models.PermLeaveView), handlers.GetAllLeaves)
+			leaves.PUT("/:id/approve", middleware.RequirePermission(models.ApprovePermissions...), handlers.ApproveLeave)
+			leaves.PUT("/:id/reject", middleware.RequirePermission(models.ApprovePermissions...), handlers.RejectLeave)
+			leaves.PUT("/:id/return", middleware.RequirePermission(models.ApprovePermissions...), handlers.ReturnLeave)
+			leaves.PUT("/:id/recall", middleware.RequirePermission(models.PermLeaveRecall), handlers.RecallLeave)
 		}
 
 		// HOD-specific approval routes
 		hod := protected.Group("/hod")
-		hod.Use(middleware.AuthorizeRoles("hod", "admin"))
+		hod.Use(middleware.RequirePermission(models.StagePermissions("HOD")...))
 		{
 			hod.GET("/leaves", handlers.GetHODLeaves)                // Get department leaves
 			hod.PUT("/leaves/:id/approve", handlers.HODApproveLeave) // HOD approve
 			hod.PUT("/leaves/:id/reject", handlers.HODRejectLeave)   // HOD reject
+			hod.PUT("/leaves/:id/return", handlers.HODReturnLeave)   // HOD request changes
 		}
 
 		// HR-specific approval routes
 		hr := protected.Group("/hr")
-		hr.Use(middleware.AuthorizeRoles("hr", "admin"))
+		hr.Use(middleware.RequirePermission(models.PermLeaveApproveHR, models.PermLeaveApproveAny, models.PermLeaveRecord))
 		{
-			hr.GET("/leaves", handlers.GetHRLeaves)                // Get HOD-approved leaves
-			hr.PUT("/leaves/:id/approve", handlers.HRApproveLeave) // HR approve
-			hr.PUT("/leaves/:id/reject", handlers.HRRejectLeave)   // HR reject
+			hr.GET("/leaves", handlers.GetHRLeaves)                                                               // Get HOD-approved leaves
+			hr.PUT("/leaves/:id/approve", handlers.HRApproveLeave)                                                // HR approve
+			hr.PUT("/leaves/:id/reject", handlers.HRRejectLeave)                                                  // HR reject
+			hr.PUT("/leaves/:id/return", handlers.HRReturnLeave)                                                  // HR request changes
+			hr.POST("/leaves/record", middleware.RequirePermission(models.PermLeaveRecord), handlers.RecordLeave) // Record leave on an employee's behalf
 		}
 
 		// GED-specific approval routes
 		ged := protected.Group("/ged")
-		ged.Use(middleware.AuthorizeRoles("ged", "admin"))
+		ged.Use(middleware.RequirePermission(models.PermLeaveApproveGED, models.PermLeaveApproveAny))
 		{
 			ged.GET("/leaves", handlers.GetGEDLeaves)                // Get HR-approved leaves
 			ged.PUT("/leaves/:id/approve", handlers.GEDApproveLeave) // GED approve (final)
 			ged.PUT("/leaves/:id/reject", handlers.GEDRejectLeave)   // GED reject
+			ged.PUT("/leaves/:id/return", handlers.GEDReturnLeave)   // GED request changes
+		}
+
+		// Cancellation requests for approved leave
+		cancellations := protected.Group("/cancellations")
+		{
+			cancellations.PUT("/:id/withdraw", handlers.WithdrawCancellation)
+			cancellations.GET("/pending", middleware.RequirePermission(models.ApprovePermissions...), handlers.GetPendingCancellations)
+			cancellations.PUT("/:id/approve", middleware.RequirePermission(models.ApprovePermissions...), handlers.ApproveCancellation)
+			cancellations.PUT("/:id/reject", middleware.RequirePermission(models.ApprovePermissions...), handlers.RejectCancellation)
+		}
+
+		// Extension requests for active leave
+		extensions := protected.Group("/extensions")
+		{
+			extensions.PUT("/:id/withdraw", handlers.WithdrawExtension)
+			extensions.GET("/pending", middleware.RequirePermission(models.ApprovePermissions...), handlers.GetPendingExtensions)
+			extensions.PUT("/:id/approve", middleware.RequirePermission(models.ApprovePermissions...), handlers.ApproveExtension)
+			extensions.PUT("/:id/reject", middleware.RequirePermission(models.ApprovePermissions...), handlers.RejectExtension)
+		}
+
+		// Live leave events (Server-Sent Events)
+		protected.GET("/events/stream", handlers.StreamEvents)
+
+		// In-app notification inbox
+		notifications := protected.Group("/notifications")
+		{
+			notifications.GET("", handlers.GetNotifications)
+			notifications.GET("/unread-count", handlers.GetUnreadNotificationCount)
+			notifications.PUT("/read-all", handlers.MarkAllNotificationsRead)
+			notifications.PUT("/:id/read", handlers.MarkNotificationRead)
+			notifications.GET("/preferences", handlers.GetNotificationPreferences)
+			notifications.PUT("/preferences", handlers.UpdateNotificationPreferences)
 		}
 
 		// Dashboard routes
@@ -101,21 +167,101 @@ func SetupRoutes(router *gin.Engine) {
 		}
 	}
 
-	// Admin routes
+	// Admin routes, grouped by the permission they need
 	admin := api.Group("/admin")
-	admin.Use(middleware.AuthMiddleware(), middleware.AuthorizeRoles("admin"))
+	admin.Use(middleware.AuthMiddleware())
 	{
-		// Dashboard
-		admin.GET("/dashboard/stats", handlers.GetAdminDashboardStats) // Admin dashboard stats
-
 		// User Management
-		admin.POST("/users", handlers.AdminCreateUser)                              // Create user
-		admin.GET("/users", handlers.AdminGetAllUsers)                              // Get all users (with filters)
-		admin.PUT("/users/:id", handlers.AdminUpdateUser)                           // Update user info
-		admin.PUT("/users/:id/activate", handlers.AdminActivateUser)                // Activate user
-		admin.PUT("/users/:id/deactivate", handlers.AdminDeactivateUser)            // Deactivate user
-		admin.PUT("/users/:id/password", handlers.AdminResetUserPassword)           // Reset password
-		admin.PUT("/users/:id/leave-balance", handlers.AdminUpdateUserLeaveBalance) // Update leave balance
+		userAdmin := admin.Group("", middleware.RequirePermission(models.PermUserManage))
+		{
+			userAdmin.GET("/dashboard/stats", handlers.GetAdminDashboardStats)                                 // Admin dashboard stats
+			userAdmin.POST("/users", handlers.AdminCreateUser)                                                 // Create user
+			userAdmin.GET("/users", middleware.RequireScope(models.ScopeUsersRead), handlers.AdminGetAllUsers) // Get all users (with filters)
+			userAdmin.PUT("/users/:id", handlers.AdminUpdateUser)                                              // Update user info
+			userAdmin.PUT("/users/:id/activate", handlers.AdminActivateUser)                                   // Activate user
+			userAdmin.PUT("/users/:id/deactivate", handlers.AdminDeactivateUser)                               // Deactivate user
+			userAdmin.PUT("/users/:id/password", handlers.AdminResetUserPassword)                              // Reset password
+			userAdmin.GET("/users/:id/sessions", handlers.AdminGetUserSessions)                                // List sessions
+			userAdmin.POST("/users/:id/logout", handlers.AdminLogoutUser)                                      // Force logout
+			userAdmin.DELETE("/users/:id/2fa", handlers.AdminResetTwoFactor)                                   // Reset two-factor authentication
+			userAdmin.POST("/users/:id/unlock", handlers.AdminUnlockUser)                                      // Clear failed sign-ins and lockout
+		}
+
+		// Leave balances
+		admin.PUT("/users/:id/leave-balance", middleware.RequirePermission(models.PermBalanceAdjust), handlers.AdminUpdateUserLeaveBalance) // Update leave balance
+
+		// Roles and permissions
+		roleAdmin := admin.Group("", middleware.RequirePermission(models.PermRoleManage))
+		{
+			roleAdmin.GET("/roles", handlers.AdminGetRoles)                            // Roles and the permissions available
+			roleAdmin.POST("/roles", handlers.AdminCreateRole)                         // Create role
+			roleAdmin.PUT("/roles/:name", handlers.AdminUpdateRole)                    // Update role
+			roleAdmin.DELETE("/roles/:name", handlers.AdminDeleteRole)                 // Delete unused custom role
+			roleAdmin.GET("/users/:id/roles", handlers.AdminGetUserRoles)              // Role assignments and permissions
+			roleAdmin.PUT("/users/:id/roles", handlers.AdminUpdateUserRoleAssignments) // Replace role assignments
+		}
+
+		// Audit log
+		admin.GET("/audit-logs", middleware.RequireScope(models.ScopeAuditRead), middleware.RequirePermission(models.PermAuditRead), handlers.AdminGetAuditLogs) // Audit log
+
+		systemAdmin := admin.Group("", middleware.RequirePermission(models.PermSystemManage))
+		{
+			// Sign-in security
+			systemAdmin.GET("/security/2fa", handlers.AdminGetTwoFactorPolicy)      // Roles required to use 2FA
+			systemAdmin.PUT("/security/2fa", handlers.AdminUpdateTwoFactorPolicy)   // Set roles required to use 2FA
+			systemAdmin.GET("/security/lockouts", handlers.AdminGetLockouts)        // Locked accounts and IP addresses
+			systemAdmin.DELETE("/security/lockouts/ip/:ip", handlers.AdminUnlockIP) // Unlock an IP address
+
+			// API keys
+			systemAdmin.POST("/api-keys", handlers.AdminCreateAPIKey)       // Issue an API key
+			systemAdmin.GET("/api-keys", handlers.AdminGetAPIKeys)          // List API keys
+			systemAdmin.DELETE("/api-keys/:id", handlers.AdminRevokeAPIKey) // Revoke an API key
+
+			// Webhooks
+			systemAdmin.POST("/webhooks", handlers.AdminCreateWebhook)                                    // Create webhook
+			systemAdmin.GET("/webhooks", handlers.AdminGetWebhooks)                                       // List webhooks
+			systemAdmin.PUT("/webhooks/:id", handlers.AdminUpdateWebhook)                                 // Update webhook
+			systemAdmin.DELETE("/webhooks/:id", handlers.AdminDeleteWebhook)                              // Delete webhook
+			systemAdmin.POST("/webhooks/:id/rotate-secret", handlers.AdminRotateWebhookSecret)            // Rotate signing secret
+			systemAdmin.GET("/webhooks/:id/deliveries", handlers.AdminGetWebhookDeliveries)               // Delivery log
+			systemAdmin.POST("/webhook-deliveries/:deliveryId/redeliver", handlers.AdminRedeliverWebhook) // Redeliver
+
+			// Event outbox
+			systemAdmin.GET("/outbox/stuck", handlers.AdminGetStuckOutboxMessages)  // Failed or overdue events
+			systemAdmin.POST("/outbox/:id/retry", handlers.AdminRetryOutboxMessage) // Retry an event
+
+			// Scheduled jobs
+			systemAdmin.GET("/jobs", handlers.AdminGetJobs)                // Jobs and their state
+			systemAdmin.GET("/jobs/:name/runs", handlers.AdminGetJobRuns)  // Run history
+			systemAdmin.POST("/jobs/:name/run", handlers.AdminTriggerJob)  // Run now
+			systemAdmin.PUT("/jobs/:name/pause", handlers.AdminPauseJob)   // Pause schedule
+			systemAdmin.PUT("/jobs/:name/resume", handlers.AdminResumeJob) // Resume schedule
+
+			// Directory sync
+			systemAdmin.GET("/directory-sync/preview", handlers.AdminPreviewDirectorySync) // Dry-run diff against LDAP
+		}
+	}
+
+	// SCIM 2.0 provisioning for identity providers
+	scimAPI := router.Group("/scim/v2")
+	scimAPI.Use(middleware.SCIMAuth())
+	{
+		scimAPI.GET("/ServiceProviderConfig", handlers.SCIMServiceProviderConfig)
+		scimAPI.GET("/ResourceTypes", handlers.SCIMResourceTypes)
+
+		scimAPI.GET("/Users", handlers.SCIMGetUsers)
+		scimAPI.POST("/Users", handlers.SCIMCreateUser)
+		scimAPI.GET("/Users/:id", handlers.SCIMGetUser)
+		scimAPI.PUT("/Users/:id", handlers.SCIMReplaceUser)
+		scimAPI.PATCH("/Users/:id", handlers.SCIMPatchUser)
+		scimAPI.DELETE("/Users/:id", handlers.SCIMDeleteUser) // Deactivates
+
+		scimAPI.GET("/Groups", handlers.SCIMGetGroups)
+		scimAPI.POST("/Groups", handlers.SCIMGroupsReadOnly)
+		scimAPI.GET("/Groups/:id", handlers.SCIMGetGroup)
+		scimAPI.PUT("/Groups/:id", handlers.SCIMReplaceGroup)
+		scimAPI.PATCH("/Groups/:id", handlers.SCIMPatchGroup)
+		scimAPI.DELETE("/Groups/:id", handlers.SCIMGroupsReadOnly)
 	}
 
 	// Health check
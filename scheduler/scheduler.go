@@ -0,0 +1,393 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Job run statuses
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// What started a run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+const (
+	pollInterval   = 30 * time.Second
+	defaultTimeout = 10 * time.Minute
+	runRetention   = 30 * 24 * time.Hour
+)
+
+// Job is a task that runs every Interval on whichever instance holds its lease
+type Job struct {
+	Name        string
+	Description string
+	Interval    time.Duration
+	Timeout     time.Duration // Longest a run may take; defaults to 10 minutes
+
+	// Run does the work and returns a short summary for the run history
+	Run func(ctx context.Context) (string, error)
+}
+
+// JobState is a job's schedule and lease, shared by every instance
+type JobState struct {
+	Name         string     `bson:"_id" json:"name"`
+	Paused       bool       `bson:"paused" json:"paused"`
+	RunRequested bool       `bson:"runRequested" json:"runRequested"` // Set by a manual trigger
+	LeaseOwner   string     `bson:"leaseOwner,omitempty" json:"leaseOwner,omitempty"`
+	LeaseUntil   time.Time  `bson:"leaseUntil" json:"-"`
+	NextRunAt    time.Time  `bson:"nextRunAt" json:"nextRunAt"`
+	LastRunAt    *time.Time `bson:"lastRunAt,omitempty" json:"lastRunAt,omitempty"`
+	LastStatus   string     `bson:"lastStatus,omitempty" json:"lastStatus,omitempty"`
+	LastError    string     `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	UpdatedAt    time.Time  `bson:"updatedAt" json:"updatedAt"`
+}
+
+// JobInfo describes a registered job and its current state
+type JobInfo struct {
+	JobState
+	Description string `json:"description"`
+	Interval    string `json:"interval"`
+	Running     bool   `json:"running"`
+}
+
+// JobRun is one entry in a job's run history
+type JobRun struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Job        string             `bson:"job" json:"job"`
+	Trigger    string             `bson:"trigger" json:"trigger"`
+	Instance   string             `bson:"instance" json:"instance"`
+	Status     string             `bson:"status" json:"status"`
+	Summary    string             `bson:"summary,omitempty" json:"summary,omitempty"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt  time.Time          `bson:"startedAt" json:"startedAt"`
+	FinishedAt *time.Time         `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+	DurationMs int64              `bson:"durationMs" json:"durationMs"`
+}
+
+// Jobs are registered in code and scheduled through MongoDB: each job has a
+// state document whose lease makes sure only one instance runs it at a time,
+// and every run is recorded in the run history.
+var (
+	mu       sync.RWMutex
+	registry = map[string]*Job{}
+	instance string
+	wakeups  = make(chan struct{}, 1)
+)
+
+// Register adds a job to the scheduler. Call it before Init.
+func Register(job Job) {
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	registry[job.Name] = &job
+}
+
+// Init creates the state documents for registered jobs so they can be listed,
+// paused and triggered from any instance, including ones not running jobs
+func Init() {
+	hostname, _ := os.Hostname()
+	instance = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.JobRunsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "startedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "startedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(runRetention.Seconds()))},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create job run indexes: %v", err)
+	}
+
+	now := time.Now()
+	for _, job := range registered() {
+		_, err := config.JobsCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": job.Name},
+			bson.M{"$setOnInsert": bson.M{
+				"paused":       false,
+				"runRequested": false,
+				"leaseUntil":   time.Time{},
+				"nextRunAt":    now,
+				"updatedAt":    now,
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			log.Printf("Warning: failed to register job %s: %v", job.Name, err)
+		}
+	}
+}
+
+// Start runs due jobs in the background until the process exits
+func Start() {
+	log.Printf("⏱️  Scheduler running %d jobs as %s", len(registered()), instance)
+	go loop()
+}
+
+// registered returns the registered jobs sorted by name
+func registered() []*Job {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(registry))
+	for _, job := range registry {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// lookup returns a registered job by name
+func lookup(name string) (*Job, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	job, ok := registry[name]
+	return job, ok
+}
+
+// wake nudges the scheduler to look for due jobs now
+func wake() {
+	select {
+	case wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// loop starts every job that is due and not leased elsewhere, polling for
+// schedules coming due and for triggers from other instances
+func loop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, job := range registered() {
+			trigger, ok := claim(job)
+			if ok {
+				go run(job, trigger)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wakeups:
+		}
+	}
+}
+
+// claim takes the lease on a job that is due or was triggered by hand. The
+// lease outlasts the job's timeout, so it cannot expire mid-run.
+func claim(job *Job) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var previous JobState
+	err := config.JobsCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id":        job.Name,
+			"leaseUntil": bson.M{"$lte": now},
+			"$or": []bson.M{
+				{"runRequested": true},
+				{"paused": false, "nextRunAt": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{"$set": bson.M{
+			"leaseOwner":   instance,
+			"leaseUntil":   now.Add(job.Timeout + time.Minute),
+			"runRequested": false,
+			"updatedAt":    now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("⚠️  Failed to claim job %s: %v", job.Name, err)
+		}
+		return "", false
+	}
+
+	if previous.RunRequested {
+		return TriggerManual, true
+	}
+	return TriggerSchedule, true
+}
+
+// run executes a claimed job, records the run and releases the lease
+func run(job *Job, trigger string) {
+	startedAt := time.Now()
+	entry := JobRun{
+		ID:        primitive.NewObjectID(),
+		Job:       job.Name,
+		Trigger:   trigger,
+		Instance:  instance,
+		Status:    RunRunning,
+		StartedAt: startedAt,
+	}
+
+	bookkeeping, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Holding the lease means any run still marked running was cut short
+	config.JobRunsCollection.UpdateMany(
+		bookkeeping,
+		bson.M{"job": job.Name, "status": RunRunning},
+		bson.M{"$set": bson.M{"status": RunFailed, "error": "abandoned: the instance running it stopped"}},
+	)
+	if _, err := config.JobRunsCollection.InsertOne(bookkeeping, entry); err != nil {
+		log.Printf("⚠️  Failed to record start of job %s: %v", job.Name, err)
+	}
+	cancel()
+
+	summary, err := execute(job)
+
+	finishedAt := time.Now()
+	entry.Summary = summary
+	entry.FinishedAt = &finishedAt
+	entry.DurationMs = finishedAt.Sub(startedAt).Milliseconds()
+	entry.Status = RunSucceeded
+	if err != nil {
+		entry.Status = RunFailed
+		entry.Error = err.Error()
+		log.Printf("⚠️  Job %s failed: %v", job.Name, err)
+	}
+
+	bookkeeping, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := config.JobRunsCollection.ReplaceOne(bookkeeping, bson.M{"_id": entry.ID}, entry); err != nil {
+		log.Printf("⚠️  Failed to record run of job %s: %v", job.Name, err)
+	}
+
+	_, err = config.JobsCollection.UpdateOne(
+		bookkeeping,
+		bson.M{"_id": job.Name, "leaseOwner": instance},
+		bson.M{"$set": bson.M{
+			"leaseOwner": "",
+			"leaseUntil": time.Time{},
+			"nextRunAt":  startedAt.Add(job.Interval),
+			"lastRunAt":  startedAt,
+			"lastStatus": entry.Status,
+			"lastError":  entry.Error,
+			"updatedAt":  finishedAt,
+		}},
+	)
+	if err != nil {
+		log.Printf("⚠️  Failed to release job %s: %v", job.Name, err)
+	}
+}
+
+// execute calls the job with its timeout, turning a panic into a failed run
+func execute(job *Job) (summary string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), job.Timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// Jobs lists every registered job with its current state
+func Jobs(ctx context.Context) ([]JobInfo, error) {
+	cursor, err := config.JobsCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var states []JobState
+	if err := cursor.All(ctx, &states); err != nil {
+		return nil, err
+	}
+	byName := map[string]JobState{}
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	now := time.Now()
+	jobs := []JobInfo{}
+	for _, job := range registered() {
+		state, ok := byName[job.Name]
+		if !ok {
+			state = JobState{Name: job.Name}
+		}
+		jobs = append(jobs, JobInfo{
+			JobState:    state,
+			Description: job.Description,
+			Interval:    job.Interval.String(),
+			Running:     state.LeaseUntil.After(now),
+		})
+	}
+	return jobs, nil
+}
+
+// Runs returns a job's run history, newest first
+func Runs(ctx context.Context, name string, limit int64) ([]JobRun, error) {
+	cursor, err := config.JobRunsCollection.Find(
+		ctx,
+		bson.M{"job": name},
+		options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	runs := []JobRun{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// Trigger asks for a job to run as soon as an instance can take its lease,
+// even while it is paused. It reports false for unknown jobs.
+func Trigger(ctx context.Context, name string) (bool, error) {
+	return update(ctx, name, bson.M{"runRequested": true})
+}
+
+// SetPaused stops or resumes a job's schedule. A run already in progress
+// finishes. It reports false for unknown jobs.
+func SetPaused(ctx context.Context, name string, paused bool) (bool, error) {
+	return update(ctx, name, bson.M{"paused": paused})
+}
+
+// update changes a registered job's state and wakes the local scheduler
+func update(ctx context.Context, name string, set bson.M) (bool, error) {
+	if _, ok := lookup(name); !ok {
+		return false, nil
+	}
+
+	set["updatedAt"] = time.Now()
+	result, err := config.JobsCollection.UpdateOne(ctx, bson.M{"_id": name}, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, nil
+	}
+
+	wake()
+	return true, nil
+}
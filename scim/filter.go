@@ -0,0 +1,386 @@
+package scim
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Filter is a parsed filter expression (RFC 7644 section 3.4.2.2). Leaves
+// compare an attribute; branches combine filters with "and", "or" or "not".
+type Filter struct {
+	Op       string      // Comparison ("eq", "co", "pr", ...) or logical ("and", "or", "not") operator
+	Attr     string      // Attribute path in lower case, e.g. "name.givenname"
+	Value    interface{} // Comparison value: string, float64, bool or nil
+	Children []*Filter
+}
+
+// Resolver translates one comparison into a MongoDB condition. attr is the
+// lower-cased attribute path; attributes inside a value filter such as
+// emails[type eq "work"] are prefixed with their parent, as "emails.type".
+type Resolver func(attr, op string, value interface{}) (bson.M, error)
+
+var comparisonOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(input string) (*Filter, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	filter, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, BadRequest(ErrInvalidFilter, "unexpected %q in filter", p.peek().text)
+	}
+	return filter, nil
+}
+
+// Mongo translates the filter into a MongoDB query, resolving each
+// comparison with resolve
+func (f *Filter) Mongo(resolve Resolver) (bson.M, error) {
+	switch f.Op {
+	case "and", "or":
+		conditions := bson.A{}
+		for _, child := range f.Children {
+			condition, err := child.Mongo(resolve)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+		return bson.M{"$" + f.Op: conditions}, nil
+	case "not":
+		condition, err := f.Children[0].Mongo(resolve)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$nor": bson.A{condition}}, nil
+	}
+	return resolve(f.Attr, f.Op, f.Value)
+}
+
+// Matches evaluates the filter against a resource held in memory. get
+// returns the values of an attribute; string comparisons ignore case.
+func (f *Filter) Matches(get func(attr string) []string) bool {
+	switch f.Op {
+	case "and":
+		for _, child := range f.Children {
+			if !child.Matches(get) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, child := range f.Children {
+			if child.Matches(get) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !f.Children[0].Matches(get)
+	}
+
+	values := get(f.Attr)
+	if f.Op == "pr" {
+		return len(values) > 0
+	}
+	want := strings.ToLower(fmt.Sprint(f.Value))
+	matched := false
+	for _, value := range values {
+		value = strings.ToLower(value)
+		switch f.Op {
+		case "eq", "ne":
+			matched = value == want
+		case "co":
+			matched = strings.Contains(value, want)
+		case "sw":
+			matched = strings.HasPrefix(value, want)
+		case "ew":
+			matched = strings.HasSuffix(value, want)
+		case "gt":
+			matched = value > want
+		case "ge":
+			matched = value >= want
+		case "lt":
+			matched = value < want
+		case "le":
+			matched = value <= want
+		}
+		if matched {
+			break
+		}
+	}
+	if f.Op == "ne" {
+		return !matched
+	}
+	return matched
+}
+
+// Compare builds the MongoDB condition for a comparison on field. Strings
+// compare case-insensitively unless caseExact is set; "meta" timestamps
+// arrive as RFC 3339 strings and are compared as dates.
+func Compare(field, op string, value interface{}, caseExact bool) (bson.M, error) {
+	if op == "pr" {
+		return bson.M{field: bson.M{"$exists": true, "$nin": bson.A{nil, ""}}}, nil
+	}
+
+	s, isString := value.(string)
+	if isString {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			value, isString = t, false
+		}
+	}
+
+	if isString && !caseExact {
+		quoted := regexp.QuoteMeta(s)
+		pattern := map[string]string{
+			"eq": "^" + quoted + "$",
+			"ne": "^" + quoted + "$",
+			"co": quoted,
+			"sw": "^" + quoted,
+			"ew": quoted + "$",
+		}[op]
+		if pattern != "" {
+			regex := bson.M{"$regex": pattern, "$options": "i"}
+			if op == "ne" {
+				return bson.M{field: bson.M{"$not": regex}}, nil
+			}
+			return bson.M{field: regex}, nil
+		}
+	}
+
+	switch op {
+	case "eq":
+		return bson.M{field: value}, nil
+	case "ne":
+		return bson.M{field: bson.M{"$ne": value}}, nil
+	case "gt", "lt":
+	case "ge":
+		op = "gte"
+	case "le":
+		op = "lte"
+	case "co", "sw", "ew":
+		if !isString {
+			return nil, BadRequest(ErrInvalidFilter, "%q needs a string value", op)
+		}
+		quoted := regexp.QuoteMeta(s)
+		pattern := map[string]string{"co": quoted, "sw": "^" + quoted, "ew": quoted + "$"}[op]
+		return bson.M{field: bson.M{"$regex": pattern}}, nil
+	}
+	if value == nil {
+		return nil, BadRequest(ErrInvalidFilter, "%q needs a value", op)
+	}
+	return bson.M{field: bson.M{"$" + op: value}}, nil
+}
+
+type token struct {
+	kind string // "word", "string", "number", "(", ")", "[", "]"
+	text string
+}
+
+// tokenize splits a filter into words, quoted strings, numbers and brackets
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("()[]", r):
+			tokens = append(tokens, token{kind: string(r), text: string(r)})
+			i++
+		case r == '"':
+			// Strings follow JSON escaping rules
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, BadRequest(ErrInvalidFilter, "unterminated string in filter")
+			}
+			text, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, BadRequest(ErrInvalidFilter, "invalid string in filter")
+			}
+			tokens = append(tokens, token{kind: "string", text: text})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()[]\"", runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			kind := "word"
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				kind = "number"
+			}
+			tokens = append(tokens, token{kind: kind, text: word})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// isKeyword reports whether the next token is the given case-insensitive keyword
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == "word" && strings.EqualFold(t.text, keyword)
+}
+
+// parseOr parses filters joined by "or". prefix is the parent attribute
+// inside a value filter.
+func (p *parser) parseOr(prefix string) (*Filter, error) {
+	left, err := p.parseAnd(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "or", Children: []*Filter{left, right}}
+	}
+	return left, nil
+}
+
+// parseAnd parses filters joined by "and", which binds tighter than "or"
+func (p *parser) parseAnd(prefix string) (*Filter, error) {
+	left, err := p.parseNot(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseNot(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "and", Children: []*Filter{left, right}}
+	}
+	return left, nil
+}
+
+// parseNot parses a negated, parenthesised, value or attribute filter
+func (p *parser) parseNot(prefix string) (*Filter, error) {
+	if p.isKeyword("not") {
+		p.next()
+		if p.peek().kind != "(" {
+			return nil, BadRequest(ErrInvalidFilter, "expected ( after not")
+		}
+		inner, err := p.parseNot(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "not", Children: []*Filter{inner}}, nil
+	}
+
+	if p.peek().kind == "(" {
+		p.next()
+		inner, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != ")" {
+			return nil, BadRequest(ErrInvalidFilter, "expected ) in filter")
+		}
+		return inner, nil
+	}
+
+	attr := p.next()
+	if attr.kind != "word" {
+		return nil, BadRequest(ErrInvalidFilter, "expected an attribute in filter")
+	}
+	path := strings.ToLower(attr.text)
+	if prefix != "" {
+		path = prefix + "." + path
+	}
+
+	// A value filter such as emails[type eq "work"] applies to the parent's sub-attributes
+	if p.peek().kind == "[" {
+		p.next()
+		inner, err := p.parseOr(path)
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != "]" {
+			return nil, BadRequest(ErrInvalidFilter, "expected ] in filter")
+		}
+		return inner, nil
+	}
+
+	op := strings.ToLower(p.next().text)
+	if op == "pr" {
+		return &Filter{Op: "pr", Attr: path}, nil
+	}
+	if !comparisonOps[op] {
+		return nil, BadRequest(ErrInvalidFilter, "unknown operator %q in filter", op)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Op: op, Attr: path, Value: value}, nil
+}
+
+// parseValue parses a comparison value: a string, number, true, false or null
+func (p *parser) parseValue() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case "string":
+		return t.text, nil
+	case "number":
+		n, _ := strconv.ParseFloat(t.text, 64)
+		return n, nil
+	case "word":
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, BadRequest(ErrInvalidFilter, "expected a value in filter")
+}
@@ -0,0 +1,93 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// User is a User resource with the enterprise extension
+type User struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	UserName    string          `json:"userName"`
+	Name        *Name           `json:"name,omitempty"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Emails      []MultiValue    `json:"emails,omitempty"`
+	Active      *Boolean        `json:"active,omitempty"`
+	Roles       []MultiValue    `json:"roles,omitempty"`
+	Groups      []MultiValue    `json:"groups,omitempty"` // Read-only
+	Enterprise  *EnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *Meta           `json:"meta,omitempty"`
+}
+
+// Name is the components of a user's name
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// EnterpriseUser holds the enterprise extension attributes
+type EnterpriseUser struct {
+	EmployeeNumber string `json:"employeeNumber,omitempty"`
+	Department     string `json:"department,omitempty"`
+}
+
+// MultiValue is one value of a multi-valued attribute such as emails or roles
+type MultiValue struct {
+	Value   string  `json:"value"`
+	Display string  `json:"display,omitempty"`
+	Type    string  `json:"type,omitempty"`
+	Primary Boolean `json:"primary,omitempty"`
+	Ref     string  `json:"$ref,omitempty"`
+}
+
+// Group is a Group resource
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// Boolean is a boolean that also accepts the strings some providers send, such as "False"
+type Boolean bool
+
+// UnmarshalJSON accepts JSON booleans and boolean strings
+func (b *Boolean) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if value == nil {
+		*b = false
+		return nil
+	}
+	v, ok := Bool(value)
+	if !ok {
+		return BadRequest(ErrInvalidValue, "%s is not a boolean", strings.TrimSpace(string(data)))
+	}
+	*b = Boolean(v)
+	return nil
+}
+
+// NewBoolean returns a pointer to a Boolean, for optional attributes
+func NewBoolean(v bool) *Boolean {
+	b := Boolean(v)
+	return &b
+}
+
+// Primary returns the primary value, or the first one when none is marked primary
+func Primary(values []MultiValue) (MultiValue, bool) {
+	for _, value := range values {
+		if value.Primary {
+			return value, true
+		}
+	}
+	if len(values) > 0 {
+		return values[0], true
+	}
+	return MultiValue{}, false
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores uploaded files such as leave attachments
+type BlobStore interface {
+	// Put writes the contents of r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns a reader for the blob stored under key
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key
+	Delete(ctx context.Context, key string) error
+}
+
+// Attachments is the store used for leave attachments
+var Attachments BlobStore
+
+// Init sets up the attachment store from the environment
+func Init() {
+	dir := os.Getenv("ATTACHMENT_STORAGE_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		log.Fatal("Failed to initialise attachment storage:", err)
+	}
+	Attachments = store
+	log.Printf("📎 Attachment storage: %s", dir)
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InitRateLimits creates the index that clears rate limit counters once
+// their window has passed
+func InitRateLimits() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.RateLimitsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create rate limit indexes: %v", err)
+	}
+}
+
+// AllowRate counts an attempt against key and reports whether it is within
+// limit attempts per window. Counters live in MongoDB so every instance
+// shares them; windows are fixed, starting on multiples of window.
+func AllowRate(ctx context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	start := time.Now().Truncate(window)
+
+	var counter struct {
+		Count int64 `bson:"count"`
+	}
+	count := func() error {
+		return config.RateLimitsCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": key + "@" + start.Format(time.RFC3339)},
+			bson.M{
+				"$inc":         bson.M{"count": 1},
+				"$setOnInsert": bson.M{"expiresAt": start.Add(window)},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&counter)
+	}
+
+	// Two first attempts in a window can race to create the counter; the
+	// loser finds it on a second try
+	err := count()
+	if mongo.IsDuplicateKeyError(err) {
+		err = count()
+	}
+	if err != nil {
+		return false, err
+	}
+	return counter.Count <= limit, nil
+}
@@ -0,0 +1,185 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxAttempts  = 8
+	firstBackoff = 30 * time.Second // Doubles after every failed attempt
+	pollInterval = 10 * time.Second
+	claimLease   = 2 * time.Minute // Long enough to cover one request
+)
+
+var (
+	client  = &http.Client{Timeout: 15 * time.Second}
+	wakeups = make(chan struct{}, 1)
+
+	// errSubscriptionUnavailable fails a delivery without retrying
+	errSubscriptionUnavailable = errors.New("subscription was deleted or deactivated")
+)
+
+// wake nudges the delivery worker to look for due deliveries now
+func wake() {
+	select {
+	case wakeups <- struct{}{}:
+	default:
+	}
+}
+
+// deliveryWorker sends due deliveries, polling for retries and for deliveries
+// queued by other instances
+func deliveryWorker() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), claimLease)
+			delivery, err := claimNext(ctx)
+			if err != nil {
+				cancel()
+				if err != mongo.ErrNoDocuments {
+					log.Printf("⚠️  Failed to claim webhook delivery: %v", err)
+				}
+				break
+			}
+			attempt(ctx, delivery)
+			cancel()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wakeups:
+		}
+	}
+}
+
+// findSubscription loads a subscription by ID
+func findSubscription(ctx context.Context, id primitive.ObjectID) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := config.WebhooksCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&subscription)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// claimNext leases the oldest due delivery so no other instance sends it meanwhile
+func claimNext(ctx context.Context) (*models.WebhookDelivery, error) {
+	now := time.Now()
+
+	var delivery models.WebhookDelivery
+	err := config.WebhookDeliveriesCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"status": models.WebhookDeliveryPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": now.Add(claimLease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry
+// with exponential backoff when the subscriber did not accept it
+func attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+	set := bson.M{
+		"attempts":      attempts,
+		"lastAttemptAt": now,
+	}
+
+	statusCode, err := send(ctx, delivery)
+	if statusCode != 0 {
+		set["responseStatus"] = statusCode
+	}
+
+	switch {
+	case err == nil:
+		set["status"] = models.WebhookDeliverySucceeded
+		set["deliveredAt"] = now
+		set["lastError"] = ""
+	case err == errSubscriptionUnavailable || attempts >= maxAttempts:
+		set["status"] = models.WebhookDeliveryFailed
+		set["lastError"] = err.Error()
+		log.Printf("⚠️  Webhook delivery %s failed after %d attempts: %v", delivery.ID.Hex(), attempts, err)
+	default:
+		set["nextAttemptAt"] = now.Add(firstBackoff << (attempts - 1))
+		set["lastError"] = err.Error()
+	}
+
+	_, err = config.WebhookDeliveriesCollection.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("⚠️  Failed to record webhook delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
+
+// send POSTs the signed payload to the subscription URL. Any 2xx response
+// counts as delivered.
+func send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	subscription, err := findSubscription(ctx, delivery.Subscription)
+	if err == mongo.ErrNoDocuments || (err == nil && !subscription.IsActive) {
+		return 0, errSubscriptionUnavailable
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FlowKit-Webhooks/1.0")
+	req.Header.Set("X-FlowKit-Event", delivery.EventType)
+	req.Header.Set("X-FlowKit-Event-ID", delivery.EventID.Hex())
+	req.Header.Set("Idempotency-Key", delivery.EventID.Hex())
+	req.Header.Set("X-FlowKit-Delivery", delivery.ID.Hex())
+	req.Header.Set("X-FlowKit-Timestamp", timestamp)
+	req.Header.Set("X-FlowKit-Signature", "sha256="+Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.payload". Receivers recompute
+// it with their copy of the secret and compare it to X-FlowKit-Signature.
+func Sign(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
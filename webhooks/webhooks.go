@@ -0,0 +1,200 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/flowkit/backend/config"
+	"github.com/flowkit/backend/events"
+	"github.com/flowkit/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Payload is the JSON body sent to subscribers. ID stays the same across
+// retries and redeliveries so receivers can discard duplicates.
+type Payload struct {
+	ID         primitive.ObjectID     `json:"id"`
+	Type       string                 `json:"type"`
+	OccurredAt time.Time              `json:"occurredAt"`
+	Leave      LeaveSnapshot          `json:"leave"`
+	Actor      *primitive.ObjectID    `json:"actor,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// LeaveSnapshot is the state of the leave when the event occurred
+type LeaveSnapshot struct {
+	ID        primitive.ObjectID `json:"id"`
+	Employee  EmployeeSnapshot   `json:"employee"`
+	LeaveType string             `json:"leaveType"`
+	FromDate  time.Time          `json:"fromDate"`
+	ToDate    time.Time          `json:"toDate"`
+	TotalDays int                `json:"totalDays"`
+	Status    string             `json:"status"`
+}
+
+// EmployeeSnapshot identifies the employee for systems keyed by staff ID or email
+type EmployeeSnapshot struct {
+	ID         primitive.ObjectID `json:"id"`
+	StaffID    string             `json:"staffId,omitempty"`
+	Name       string             `json:"name"`
+	Email      string             `json:"email"`
+	Department string             `json:"department"`
+}
+
+// Init subscribes webhooks to leave events and starts the delivery worker.
+// Deliveries are queued in MongoDB, so retries survive restarts and several
+// API instances can share the work.
+func Init() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.WebhookDeliveriesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		{Keys: bson.D{{Key: "subscription", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+	})
+	if err != nil {
+		log.Printf("Warning: failed to create webhook delivery indexes: %v", err)
+	}
+
+	events.Subscribe("webhooks", enqueue)
+	go deliveryWorker()
+}
+
+// NewSecret generates a signing secret for a subscription
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// enqueue records a pending delivery for every active subscription that wants
+// the event. Deliveries are keyed by event and subscription, so handling the
+// same event again queues nothing new.
+func enqueue(ctx context.Context, event events.Event) error {
+	cursor, err := config.WebhooksCollection.Find(ctx, bson.M{"isActive": true})
+	if err != nil {
+		return err
+	}
+	var subscriptions []models.WebhookSubscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return err
+	}
+
+	var deliveries []interface{}
+	var payload string
+	for _, subscription := range subscriptions {
+		if !subscription.Wants(event.Type) {
+			continue
+		}
+
+		// Build the payload once, and only if someone wants it
+		if payload == "" {
+			if payload, err = buildPayload(ctx, event); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:            primitive.NewObjectID(),
+			Key:           event.ID.Hex() + ":" + subscription.ID.Hex(),
+			Subscription:  subscription.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	_, err = config.WebhookDeliveriesCollection.InsertMany(ctx, deliveries, options.InsertMany().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	// Send straight away rather than waiting for the next poll
+	wake()
+	return nil
+}
+
+// buildPayload renders the JSON body for an event from the current leave state
+func buildPayload(ctx context.Context, event events.Event) (string, error) {
+	var leave models.Leave
+	if err := config.LeavesCollection.FindOne(ctx, bson.M{"_id": event.LeaveID}).Decode(&leave); err != nil {
+		return "", err
+	}
+
+	var employee models.User
+	if err := config.UsersCollection.FindOne(ctx, bson.M{"_id": leave.Employee}).Decode(&employee); err != nil {
+		return "", err
+	}
+
+	payload := Payload{
+		ID:         event.ID,
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+		Leave: LeaveSnapshot{
+			ID: leave.ID,
+			Employee: EmployeeSnapshot{
+				ID:         employee.ID,
+				StaffID:    employee.StaffID,
+				Name:       employee.FirstName + " " + employee.LastName,
+				Email:      employee.Email,
+				Department: employee.Department,
+			},
+			LeaveType: leave.LeaveType,
+			FromDate:  leave.FromDate,
+			ToDate:    leave.ToDate,
+			TotalDays: leave.TotalDays,
+			Status:    leave.Status,
+		},
+		Data: event.Data,
+	}
+	if !event.Actor.IsZero() {
+		payload.Actor = &event.Actor
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// Redeliver queues a fresh delivery of an earlier payload. The original
+// delivery keeps its history in the log.
+func Redeliver(ctx context.Context, original *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		ID:            primitive.NewObjectID(),
+		Subscription:  original.Subscription,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: now,
+		RedeliveryOf:  &original.ID,
+		CreatedAt:     now,
+	}
+
+	if _, err := config.WebhookDeliveriesCollection.InsertOne(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	wake()
+	return &delivery, nil
+}